@@ -0,0 +1,189 @@
+// Package analytics turns click counts into reports over a time range,
+// bucketed by hour, day, week or month in the viewer's time zone
+package analytics
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	// Time zones are looked up by name, and the runtime image has no
+	// zoneinfo database
+	_ "time/tzdata"
+)
+
+// Granularity is the width of the buckets of a time series
+type Granularity string
+
+const (
+	Hour  Granularity = "hour"
+	Day   Granularity = "day"
+	Week  Granularity = "week"
+	Month Granularity = "month"
+)
+
+const (
+	// DefaultPeriod is the range reported when none is given
+	DefaultPeriod = 30 * 24 * time.Hour
+	// MaxBuckets bounds the length of a time series
+	MaxBuckets = 2000
+)
+
+// dateLayout is the layout of dates without a time, which start at
+// midnight in the range's time zone
+const dateLayout = "2006-01-02"
+
+// ParseGranularity reads a granularity name
+func ParseGranularity(value string) (Granularity, error) {
+	switch g := Granularity(strings.ToLower(value)); g {
+	case Hour, Day, Week, Month:
+		return g, nil
+	}
+	return "", fmt.Errorf("unknown granularity %q (expected hour, day, week or month)", value)
+}
+
+// Truncate returns the start of the bucket holding t in loc. Weeks start
+// on Monday.
+func (g Granularity) Truncate(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	year, month, day := t.Date()
+	switch g {
+	case Hour:
+		return time.Date(year, month, day, t.Hour(), 0, 0, 0, loc)
+	case Week:
+		daysSinceMonday := (int(t.Weekday()) + 6) % 7
+		return time.Date(year, month, day-daysSinceMonday, 0, 0, 0, 0, loc)
+	case Month:
+		return time.Date(year, month, 1, 0, 0, 0, 0, loc)
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, loc)
+}
+
+// Next returns the start of the bucket after the one starting at start
+func (g Granularity) Next(start time.Time) time.Time {
+	year, month, day := start.Date()
+	loc := start.Location()
+	switch g {
+	case Hour:
+		return start.Add(time.Hour)
+	case Week:
+		return time.Date(year, month, day+7, 0, 0, 0, 0, loc)
+	case Month:
+		return time.Date(year, month+1, 1, 0, 0, 0, 0, loc)
+	}
+	return time.Date(year, month, day+1, 0, 0, 0, 0, loc)
+}
+
+// Range is the period a report covers, from From up to but not including
+// To, and how its time series is bucketed
+type Range struct {
+	From        time.Time
+	To          time.Time
+	Granularity Granularity
+	Location    *time.Location
+}
+
+// ParseRange reads a report range from request parameters, any of which
+// may be empty. from and to are RFC 3339 times or dates; a date for to
+// includes that whole day. The range defaults to the DefaultPeriod before
+// now, by day, in UTC.
+func ParseRange(from, to, granularity, timezone string, now time.Time) (Range, error) {
+	r := Range{Granularity: Day, Location: time.UTC}
+	if timezone != "" {
+		loc, err := time.LoadLocation(timezone)
+		if err != nil || timezone == "Local" {
+			return Range{}, fmt.Errorf("unknown time zone %q", timezone)
+		}
+		r.Location = loc
+	}
+	if granularity != "" {
+		g, err := ParseGranularity(granularity)
+		if err != nil {
+			return Range{}, err
+		}
+		r.Granularity = g
+	}
+
+	r.To = now
+	if to != "" {
+		t, err := parseBound(to, r.Location, true)
+		if err != nil {
+			return Range{}, fmt.Errorf("to: %v", err)
+		}
+		r.To = t
+	}
+	r.From = r.To.Add(-DefaultPeriod)
+	if from != "" {
+		t, err := parseBound(from, r.Location, false)
+		if err != nil {
+			return Range{}, fmt.Errorf("from: %v", err)
+		}
+		r.From = t
+	}
+
+	if !r.From.Before(r.To) {
+		return Range{}, errors.New("from must be before to")
+	}
+	if r.bucketCount() > MaxBuckets {
+		return Range{}, fmt.Errorf("range has more than %d %s buckets; use a shorter range or a coarser granularity", MaxBuckets, r.Granularity)
+	}
+	return r, nil
+}
+
+// parseBound reads an RFC 3339 time or a date in loc. A date that ends a
+// range stands for the end of that day.
+func parseBound(value string, loc *time.Location, end bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation(dateLayout, value, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not an RFC 3339 time or a YYYY-MM-DD date", value)
+	}
+	if end {
+		t = Day.Next(t)
+	}
+	return t, nil
+}
+
+// bucketCount is the number of buckets in the range, counting no further
+// than one past MaxBuckets
+func (r Range) bucketCount() int {
+	n := 0
+	for start := r.Granularity.Truncate(r.From, r.Location); start.Before(r.To) && n <= MaxBuckets; start = r.Granularity.Next(start) {
+		n++
+	}
+	return n
+}
+
+// Buckets returns the start of every bucket the range overlaps, in order
+func (r Range) Buckets() []time.Time {
+	var buckets []time.Time
+	for start := r.Granularity.Truncate(r.From, r.Location); start.Before(r.To); start = r.Granularity.Next(start) {
+		buckets = append(buckets, start)
+	}
+	return buckets
+}
+
+// Point is the number of clicks in the bucket starting at Start
+type Point struct {
+	Start  time.Time
+	Clicks int64
+}
+
+// Fill returns the time series of the range with counts, keyed by the
+// Unix time of their bucket's start; buckets without clicks are zero
+func (r Range) Fill(counts map[int64]int64) []Point {
+	buckets := r.Buckets()
+	points := make([]Point, len(buckets))
+	for i, start := range buckets {
+		points[i] = Point{Start: start, Clicks: counts[start.Unix()]}
+	}
+	return points
+}
+
+// WallClock interprets the date and clock of t, as returned for a
+// timestamp without time zone, in the range's time zone
+func (r Range) WallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), r.Location)
+}
@@ -0,0 +1,104 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTruncate(t *testing.T) {
+	jakarta, err := time.LoadLocation("Asia/Jakarta")
+	require.NoError(t, err)
+	// Wednesday 2024-05-01 22:30 UTC is Thursday 05:30 in Jakarta
+	at := time.Date(2024, 5, 1, 22, 30, 0, 0, time.UTC)
+
+	assert.Equal(t, time.Date(2024, 5, 2, 5, 0, 0, 0, jakarta), Hour.Truncate(at, jakarta))
+	assert.Equal(t, time.Date(2024, 5, 2, 0, 0, 0, 0, jakarta), Day.Truncate(at, jakarta))
+	assert.Equal(t, time.Date(2024, 4, 29, 0, 0, 0, 0, jakarta), Week.Truncate(at, jakarta))
+	assert.Equal(t, time.Date(2024, 5, 1, 0, 0, 0, 0, jakarta), Month.Truncate(at, jakarta))
+	assert.Equal(t, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), Day.Truncate(at, time.UTC))
+
+	// Sundays belong to the week that started the Monday before
+	sunday := time.Date(2024, 5, 5, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2024, 4, 29, 0, 0, 0, 0, time.UTC), Week.Truncate(sunday, time.UTC))
+}
+
+func TestParseRange(t *testing.T) {
+	now := time.Date(2024, 5, 20, 12, 0, 0, 0, time.UTC)
+
+	r, err := ParseRange("", "", "", "", now)
+	require.NoError(t, err)
+	assert.Equal(t, now, r.To)
+	assert.Equal(t, now.Add(-DefaultPeriod), r.From)
+	assert.Equal(t, Day, r.Granularity)
+	assert.Equal(t, time.UTC, r.Location)
+
+	r, err = ParseRange("2024-05-01", "2024-05-03", "HOUR", "America/New_York", now)
+	require.NoError(t, err)
+	newYork, _ := time.LoadLocation("America/New_York")
+	assert.True(t, time.Date(2024, 5, 1, 0, 0, 0, 0, newYork).Equal(r.From))
+	// A date ending the range includes that day
+	assert.True(t, time.Date(2024, 5, 4, 0, 0, 0, 0, newYork).Equal(r.To))
+	assert.Equal(t, Hour, r.Granularity)
+	assert.Len(t, r.Buckets(), 72)
+
+	r, err = ParseRange("2024-05-01T10:00:00Z", "2024-05-01T12:30:00+02:00", "hour", "", now)
+	require.NoError(t, err)
+	assert.Len(t, r.Buckets(), 1)
+
+	for _, tt := range []struct{ from, to, granularity, timezone, error string }{
+		{"", "", "minute", "", "unknown granularity"},
+		{"", "", "", "Mars/Olympus", "unknown time zone"},
+		{"", "", "", "Local", "unknown time zone"},
+		{"yesterday", "", "", "", "from:"},
+		{"", "2024-13-01", "", "", "to:"},
+		{"2024-05-03", "2024-05-01", "", "", "from must be before to"},
+		{"2020-01-01", "2024-01-01", "hour", "", "more than 2000 hour buckets"},
+	} {
+		_, err := ParseRange(tt.from, tt.to, tt.granularity, tt.timezone, now)
+		assert.ErrorContains(t, err, tt.error, tt)
+	}
+}
+
+func TestFill(t *testing.T) {
+	from := time.Date(2024, 1, 30, 15, 0, 0, 0, time.UTC)
+	r := Range{From: from, To: from.AddDate(0, 2, 0), Granularity: Month, Location: time.UTC}
+	points := r.Fill(map[int64]int64{
+		time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC).Unix(): 4,
+		// Outside the range
+		time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC).Unix(): 9,
+	})
+	assert.Equal(t, []Point{
+		{Start: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{Start: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), Clicks: 4},
+		{Start: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+	}, points)
+}
+
+func TestBucketsAcrossDST(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	// Clocks went forward on 2024-03-31, a 23 hour day
+	r, err := ParseRange("2024-03-30", "2024-04-01", "day", "Europe/Berlin", time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, []time.Time{
+		time.Date(2024, 3, 30, 0, 0, 0, 0, berlin),
+		time.Date(2024, 3, 31, 0, 0, 0, 0, berlin),
+		time.Date(2024, 4, 1, 0, 0, 0, 0, berlin),
+	}, r.Buckets())
+
+	r.Granularity = Hour
+	r.From = time.Date(2024, 3, 31, 0, 0, 0, 0, berlin)
+	r.To = time.Date(2024, 4, 1, 0, 0, 0, 0, berlin)
+	assert.Len(t, r.Buckets(), 23)
+}
+
+func TestWallClock(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	require.NoError(t, err)
+	r := Range{Location: tokyo}
+	got := r.WallClock(time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC))
+	assert.Equal(t, time.Date(2024, 5, 1, 9, 0, 0, 0, tokyo), got)
+}
@@ -0,0 +1,166 @@
+package analytics
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// Referrer types
+const (
+	// ReferrerDirect is a visit without a referrer, such as a typed or
+	// bookmarked short URL or a link in an app that sends none
+	ReferrerDirect = "direct"
+	// ReferrerSearch is a visit from a search engine
+	ReferrerSearch = "search"
+	// ReferrerSocial is a visit from a social network or messenger
+	ReferrerSocial = "social"
+	// ReferrerEmail is a visit from a webmail or mail app
+	ReferrerEmail = "email"
+	// ReferrerOther is a visit from any other site
+	ReferrerOther = "other"
+)
+
+// ReferrerTypes lists every referrer type in reporting order
+var ReferrerTypes = []string{ReferrerDirect, ReferrerSearch, ReferrerSocial, ReferrerEmail, ReferrerOther}
+
+// maxFieldLength bounds referrer domains and UTM values, the width of
+// their columns
+const maxFieldLength = 255
+
+//go:embed referrers.txt
+var referrerList string
+
+// referrerDomains maps the domains of the bundled list to their type
+var referrerDomains = mustParseReferrerList(referrerList)
+
+// mustParseReferrerList reads a referrer list of "domain type" lines,
+// skipping blank lines and # comments
+func mustParseReferrerList(list string) map[string]string {
+	domains := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(list))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			panic(fmt.Sprintf("referrer list line %d: want \"domain type\", got %q", line, text))
+		}
+		switch fields[1] {
+		case ReferrerSearch, ReferrerSocial, ReferrerEmail:
+		default:
+			panic(fmt.Sprintf("referrer list line %d: unknown type %q", line, fields[1]))
+		}
+		domains[strings.ToLower(fields[0])] = fields[1]
+	}
+	return domains
+}
+
+// Referrer is where a visit came from
+type Referrer struct {
+	// Domain is the referring host without "www." or "m.", or an app's
+	// package name for Android app referrers. It is empty for direct
+	// visits and referrers without a host.
+	Domain string
+	// Type is one of the referrer types
+	Type string
+}
+
+// ParseReferrer normalizes a Referer header and classifies its domain
+func ParseReferrer(referer string) Referrer {
+	referer = strings.TrimSpace(referer)
+	if referer == "" {
+		return Referrer{Type: ReferrerDirect}
+	}
+	domain := ReferrerDomain(referer)
+	return Referrer{Domain: domain, Type: ReferrerType(domain)}
+}
+
+// ReferrerDomain returns the normalized domain of a referrer URL, or an
+// empty string if it has no host
+func ReferrerDomain(referer string) string {
+	u, err := url.Parse(strings.TrimSpace(referer))
+	if err != nil {
+		return ""
+	}
+	domain := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	for _, prefix := range []string{"www.", "m."} {
+		if trimmed := strings.TrimPrefix(domain, prefix); strings.Contains(trimmed, ".") {
+			domain = trimmed
+		}
+	}
+	return truncate(domain, maxFieldLength)
+}
+
+// ReferrerType classifies a referrer domain with the bundled list. The
+// most specific listed domain wins; unlisted domains are ReferrerOther.
+func ReferrerType(domain string) string {
+	if domain == "" {
+		return ReferrerOther
+	}
+	for suffix := domain; ; {
+		if t, ok := referrerDomains[suffix]; ok {
+			return t
+		}
+		name, rest, found := strings.Cut(suffix, ".")
+		if !found {
+			return ReferrerOther
+		}
+		if t, ok := referrerDomains[name+".*"]; ok {
+			return t
+		}
+		suffix = rest
+	}
+}
+
+// UTM is the campaign a visit is attributed to by its utm_ parameters
+type UTM struct {
+	Source   string
+	Medium   string
+	Campaign string
+}
+
+// IsZero reports whether no utm_ parameter was set
+func (u UTM) IsZero() bool {
+	return u == UTM{}
+}
+
+// ParseUTM reads utm_source, utm_medium and utm_campaign from a query.
+// Sources and mediums are lowercased so "Newsletter" and "newsletter"
+// are counted together; campaign names are kept as given.
+func ParseUTM(query url.Values) UTM {
+	value := func(name string) string {
+		return truncate(strings.TrimSpace(query.Get(name)), maxFieldLength)
+	}
+	return UTM{
+		Source:   strings.ToLower(value("utm_source")),
+		Medium:   strings.ToLower(value("utm_medium")),
+		Campaign: value("utm_campaign"),
+	}
+}
+
+// CampaignUTM returns the UTM parameters of a visit: those of the short
+// URL it requested, or, if it had none, those tagged on the destination
+func CampaignUTM(query url.Values, destination string) UTM {
+	if utm := ParseUTM(query); !utm.IsZero() {
+		return utm
+	}
+	u, err := url.Parse(destination)
+	if err != nil {
+		return UTM{}
+	}
+	return ParseUTM(u.Query())
+}
+
+// truncate shortens s to at most n characters
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
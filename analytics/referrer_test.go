@@ -0,0 +1,57 @@
+package analytics
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseReferrer(t *testing.T) {
+	tests := []struct {
+		referer string
+		want    Referrer
+	}{
+		{"", Referrer{Type: ReferrerDirect}},
+		{"  ", Referrer{Type: ReferrerDirect}},
+		{"https://www.google.com/search?q=x", Referrer{Domain: "google.com", Type: ReferrerSearch}},
+		{"https://www.google.co.uk/", Referrer{Domain: "google.co.uk", Type: ReferrerSearch}},
+		{"https://mail.google.com/mail/u/0/", Referrer{Domain: "mail.google.com", Type: ReferrerEmail}},
+		{"https://m.facebook.com/story.php", Referrer{Domain: "facebook.com", Type: ReferrerSocial}},
+		{"https://L.Facebook.com:443/l.php?u=x", Referrer{Domain: "l.facebook.com", Type: ReferrerSocial}},
+		{"https://t.co/abc", Referrer{Domain: "t.co", Type: ReferrerSocial}},
+		{"https://news.ycombinator.com/item?id=1", Referrer{Domain: "news.ycombinator.com", Type: ReferrerSocial}},
+		{"android-app://com.google.android.gm/", Referrer{Domain: "com.google.android.gm", Type: ReferrerEmail}},
+		{"https://search.yahoo.com/", Referrer{Domain: "search.yahoo.com", Type: ReferrerSearch}},
+		{"https://mail.yahoo.com/", Referrer{Domain: "mail.yahoo.com", Type: ReferrerEmail}},
+		{"https://blog.example.com./post", Referrer{Domain: "blog.example.com", Type: ReferrerOther}},
+		{"https://www.m.io/", Referrer{Domain: "m.io", Type: ReferrerOther}},
+		{"not a url", Referrer{Type: ReferrerOther}},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, ParseReferrer(tt.referer), tt.referer)
+	}
+}
+
+func TestReferrerList(t *testing.T) {
+	for domain, typ := range referrerDomains {
+		assert.Equal(t, strings.ToLower(domain), domain)
+		assert.Contains(t, []string{ReferrerSearch, ReferrerSocial, ReferrerEmail}, typ)
+	}
+	assert.Panics(t, func() { mustParseReferrerList("example.com") })
+	assert.Panics(t, func() { mustParseReferrerList("example.com direct") })
+}
+
+func TestParseUTM(t *testing.T) {
+	utm := ParseUTM(url.Values{"utm_source": {" Twitter "}, "utm_medium": {"Social"}, "utm_campaign": {"Spring Sale"}})
+	assert.Equal(t, UTM{Source: "twitter", Medium: "social", Campaign: "Spring Sale"}, utm)
+	assert.True(t, ParseUTM(url.Values{"ref": {"x"}}).IsZero())
+	assert.Len(t, ParseUTM(url.Values{"utm_campaign": {strings.Repeat("é", 300)}}).Campaign, 2*maxFieldLength)
+
+	// The short URL's parameters win over the destination's
+	destination := "https://example.com/page?utm_source=site&utm_medium=cpc"
+	assert.Equal(t, UTM{Source: "mail"}, CampaignUTM(url.Values{"utm_source": {"mail"}}, destination))
+	assert.Equal(t, UTM{Source: "site", Medium: "cpc"}, CampaignUTM(url.Values{}, destination))
+	assert.Equal(t, UTM{}, CampaignUTM(url.Values{}, "://bad"))
+}
@@ -0,0 +1,88 @@
+package analytics
+
+import "time"
+
+// Table is where click counts for a period are read from
+type Table int
+
+const (
+	// Raw is the clicks table, one row per click
+	Raw Table = iota
+	// Hourly is the rollup of clicks per UTC hour
+	Hourly
+	// Daily is the rollup of clicks per UTC day
+	Daily
+)
+
+// Segment is a period whose clicks are read from one table
+type Segment struct {
+	From  time.Time
+	To    time.Time
+	Table Table
+}
+
+// Plan splits the period from up to to into segments read from the
+// coarsest table that covers them whole, but no coarser than coarsest:
+// daily rollups for whole UTC days, hourly rollups for whole hours, and raw
+// clicks for the partial hours at either end. Rollups only hold clicks
+// before watermark, so everything after it is read raw.
+func Plan(from, to, watermark time.Time, coarsest Table) []Segment {
+	from, to, watermark = from.UTC(), to.UTC(), watermark.UTC()
+	end := to
+	if watermark.Before(end) {
+		end = watermark
+	}
+	hourFrom, hourTo := ceil(from, time.Hour), end.Truncate(time.Hour)
+	if coarsest == Raw || !hourFrom.Before(hourTo) {
+		return []Segment{{From: from, To: to, Table: Raw}}
+	}
+
+	var segments []Segment
+	add := func(from, to time.Time, table Table) {
+		if from.Before(to) {
+			segments = append(segments, Segment{From: from, To: to, Table: table})
+		}
+	}
+	add(from, hourFrom, Raw)
+	dayFrom, dayTo := ceil(hourFrom, 24*time.Hour), hourTo.Truncate(24*time.Hour)
+	if coarsest == Daily && dayFrom.Before(dayTo) {
+		add(hourFrom, dayFrom, Hourly)
+		add(dayFrom, dayTo, Daily)
+		add(dayTo, hourTo, Hourly)
+	} else {
+		add(hourFrom, hourTo, Hourly)
+	}
+	add(hourTo, to, Raw)
+	return segments
+}
+
+// ceil rounds t up to a multiple of d since the zero time, which for hours
+// and days is a UTC hour or midnight
+func ceil(t time.Time, d time.Duration) time.Time {
+	if truncated := t.Truncate(d); truncated.Before(t) {
+		return truncated.Add(d)
+	}
+	return t
+}
+
+// Coarsest returns the coarsest rollup whose buckets each fall within one
+// bucket of the range's time series, so rollups can be bucketed like raw
+// clicks. Time zones whose offset from UTC is not a whole number of hours
+// can only be bucketed from raw clicks.
+func (r Range) Coarsest() Table {
+	table := Daily
+	if r.Granularity == Hour {
+		table = Hourly
+	}
+	buckets := r.Buckets()
+	for _, start := range buckets[1:] {
+		start = start.UTC()
+		if table == Daily && start.Hour() != 0 {
+			table = Hourly
+		}
+		if start.Minute() != 0 || start.Second() != 0 {
+			return Raw
+		}
+	}
+	return table
+}
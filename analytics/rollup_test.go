@@ -0,0 +1,80 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlan(t *testing.T) {
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, 5, day, hour, minute, 0, 0, time.UTC)
+	}
+	from, to := at(1, 10, 15), at(5, 14, 30)
+
+	// Everything after the watermark is read raw
+	assert.Equal(t, []Segment{
+		{From: at(1, 10, 15), To: at(1, 11, 0), Table: Raw},
+		{From: at(1, 11, 0), To: at(2, 0, 0), Table: Hourly},
+		{From: at(2, 0, 0), To: at(4, 0, 0), Table: Daily},
+		{From: at(4, 0, 0), To: at(4, 9, 0), Table: Hourly},
+		{From: at(4, 9, 0), To: at(5, 14, 30), Table: Raw},
+	}, Plan(from, to, at(4, 9, 0), Daily))
+
+	// Caught up rollups cover every whole hour
+	assert.Equal(t, []Segment{
+		{From: at(1, 10, 15), To: at(1, 11, 0), Table: Raw},
+		{From: at(1, 11, 0), To: at(2, 0, 0), Table: Hourly},
+		{From: at(2, 0, 0), To: at(5, 0, 0), Table: Daily},
+		{From: at(5, 0, 0), To: at(5, 14, 0), Table: Hourly},
+		{From: at(5, 14, 0), To: at(5, 14, 30), Table: Raw},
+	}, Plan(from, to, at(6, 0, 0), Daily))
+
+	assert.Equal(t, []Segment{
+		{From: at(1, 10, 15), To: at(1, 11, 0), Table: Raw},
+		{From: at(1, 11, 0), To: at(5, 14, 0), Table: Hourly},
+		{From: at(5, 14, 0), To: at(5, 14, 30), Table: Raw},
+	}, Plan(from, to, at(6, 0, 0), Hourly))
+
+	// Without rollups, or without a whole hour, everything is raw
+	assert.Equal(t, []Segment{{From: from, To: to, Table: Raw}}, Plan(from, to, time.Time{}, Daily))
+	assert.Equal(t, []Segment{{From: from, To: to, Table: Raw}}, Plan(from, to, at(6, 0, 0), Raw))
+	assert.Equal(t, []Segment{{From: at(1, 10, 15), To: at(1, 10, 45), Table: Raw}}, Plan(at(1, 10, 15), at(1, 10, 45), at(6, 0, 0), Daily))
+
+	// Segments are contiguous for any bounds
+	jakarta, err := time.LoadLocation("Asia/Jakarta")
+	require.NoError(t, err)
+	segments := Plan(time.Date(2024, 5, 1, 0, 0, 0, 0, jakarta), at(20, 0, 0), at(10, 3, 0), Daily)
+	assert.True(t, segments[0].From.Equal(time.Date(2024, 5, 1, 0, 0, 0, 0, jakarta)))
+	for i := 1; i < len(segments); i++ {
+		assert.Equal(t, segments[i-1].To, segments[i].From)
+	}
+	assert.Equal(t, at(20, 0, 0), segments[len(segments)-1].To)
+}
+
+func TestCoarsest(t *testing.T) {
+	tests := []struct {
+		granularity, timezone string
+		want                  Table
+	}{
+		{"day", "UTC", Daily},
+		{"month", "UTC", Daily},
+		{"hour", "UTC", Hourly},
+		{"day", "Europe/Berlin", Hourly},
+		{"hour", "Europe/Berlin", Hourly},
+		{"day", "Asia/Kolkata", Raw},
+		{"hour", "Asia/Kathmandu", Raw},
+	}
+	for _, tt := range tests {
+		r, err := ParseRange("2024-05-01", "2024-05-10", tt.granularity, tt.timezone, time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, r.Coarsest(), "%s in %s", tt.granularity, tt.timezone)
+	}
+
+	// A single bucket has no boundaries to align
+	r, err := ParseRange("2024-05-01", "2024-05-01", "month", "Asia/Kolkata", time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, Daily, r.Coarsest())
+}
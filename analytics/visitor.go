@@ -0,0 +1,38 @@
+package analytics
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+)
+
+// visitorIDLength is how many bytes of the hash a visitor ID keeps
+const visitorIDLength = 16
+
+// VisitorID identifies a visitor by a keyed hash of their IP address and
+// user agent. Salts rotate daily and old ones are discarded, so IDs count
+// unique visitors within a day without being linkable across days or
+// reversible to the address once the day's salt is gone.
+func VisitorID(salt []byte, ip, userAgent string) string {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write([]byte(ip))
+	mac.Write([]byte{0})
+	mac.Write([]byte(userAgent))
+	return hex.EncodeToString(mac.Sum(nil)[:visitorIDLength])
+}
+
+// TruncateIP zeroes the host part of an address, keeping the /24 of IPv4
+// and the /48 of IPv6 addresses: enough for network-level analytics but
+// not to single out a visitor. It returns an empty string for invalid
+// addresses.
+func TruncateIP(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return parsed.Mask(net.CIDRMask(48, 128)).String()
+}
@@ -0,0 +1,36 @@
+package analytics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVisitorID(t *testing.T) {
+	salt := []byte("salt of the day")
+	id := VisitorID(salt, "203.0.113.42", "Mozilla/5.0")
+	assert.Len(t, id, 2*visitorIDLength)
+	assert.Equal(t, id, VisitorID(salt, "203.0.113.42", "Mozilla/5.0"))
+
+	// Another address, user agent or day is another visitor
+	assert.NotEqual(t, id, VisitorID(salt, "203.0.113.43", "Mozilla/5.0"))
+	assert.NotEqual(t, id, VisitorID(salt, "203.0.113.42", "curl/8.0"))
+	assert.NotEqual(t, id, VisitorID([]byte("salt of the next day"), "203.0.113.42", "Mozilla/5.0"))
+
+	// The separator keeps the address and user agent apart
+	assert.NotEqual(t, VisitorID(salt, "1.2.3.4", "5"), VisitorID(salt, "1.2.3.45", ""))
+}
+
+func TestTruncateIP(t *testing.T) {
+	tests := map[string]string{
+		"203.0.113.42":        "203.0.113.0",
+		"::ffff:203.0.113.42": "203.0.113.0",
+		"2001:db8:1:2::42":    "2001:db8:1::",
+		"::1":                 "::",
+		"not an ip":           "",
+		"":                    "",
+	}
+	for ip, want := range tests {
+		assert.Equal(t, want, TruncateIP(ip), ip)
+	}
+}
@@ -0,0 +1,150 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Audited actions
+const (
+	ActionCreate     = "create"
+	ActionUpdate     = "update"
+	ActionDelete     = "delete"
+	ActionDeactivate = "deactivate"
+	ActionRestore    = "restore"
+	ActionPurge      = "purge"
+	ActionRollback   = "rollback"
+	ActionDismiss    = "dismiss"
+	ActionBan        = "ban"
+	ActionUnban      = "unban"
+)
+
+// Audited target types
+const (
+	TargetURL    = "url"
+	TargetReport = "report"
+	TargetBan    = "ban"
+	TargetQRLogo = "qr_logo"
+)
+
+// Execer is satisfied by *sql.DB and *sql.Tx, so entries can be written in
+// the same transaction as the change they describe
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// Entry describes one mutation. Before and After are snapshots of the target
+// (nil when it did not exist) and are stored together with the fields that
+// changed between them.
+type Entry struct {
+	Actor      string
+	Action     string
+	TargetType string
+	TargetID   string
+	Before     any
+	After      any
+	IP         string
+	RequestID  string
+}
+
+// Change is the old and new value of one field
+type Change struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+// Diff returns the top-level fields whose JSON values differ between the
+// before and after snapshots
+func Diff(before, after any) (map[string]Change, error) {
+	from, err := toMap(before)
+	if err != nil {
+		return nil, err
+	}
+	to, err := toMap(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]Change)
+	for key, value := range from {
+		if other, ok := to[key]; !ok || !reflect.DeepEqual(value, other) {
+			changes[key] = Change{From: value, To: to[key]}
+		}
+	}
+	for key, value := range to {
+		if _, ok := from[key]; !ok {
+			changes[key] = Change{To: value}
+		}
+	}
+	return changes, nil
+}
+
+// toMap converts a snapshot to its JSON object form
+func toMap(v any) (map[string]any, error) {
+	if v == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("audit snapshot must be a JSON object: %v", err)
+	}
+	return m, nil
+}
+
+// Record stores an entry
+func Record(ctx context.Context, db Execer, e Entry) error {
+	changes, err := Diff(e.Before, e.After)
+	if err != nil {
+		return fmt.Errorf("failed to diff audit snapshots: %v", err)
+	}
+	before, err := marshalSnapshot(e.Before)
+	if err != nil {
+		return err
+	}
+	after, err := marshalSnapshot(e.After)
+	if err != nil {
+		return err
+	}
+	changesJSON, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO audit_log (id, actor, action, target_type, target_id, before, after, changes, ip, request_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`, uuid.New().String(), e.Actor, e.Action, e.TargetType, e.TargetID, before, after, changesJSON,
+		nullIfEmpty(e.IP), nullIfEmpty(e.RequestID), time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to write audit log: %v", err)
+	}
+	return nil
+}
+
+func marshalSnapshot(v any) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode audit snapshot: %v", err)
+	}
+	return data, nil
+}
+
+func nullIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,81 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type link struct {
+	ID        string     `json:"id"`
+	Title     *string    `json:"title,omitempty"`
+	IsActive  bool       `json:"is_active"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+func TestDiff(t *testing.T) {
+	title := "Docs"
+	before := link{ID: "1", IsActive: true}
+	after := link{ID: "1", Title: &title, IsActive: false}
+
+	changes, err := Diff(before, after)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Change{
+		"title":     {From: nil, To: "Docs"},
+		"is_active": {From: true, To: false},
+	}, changes)
+}
+
+func TestDiffCreateAndDelete(t *testing.T) {
+	changes, err := Diff(nil, link{ID: "1", IsActive: true})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Change{"id": {To: "1"}, "is_active": {To: true}}, changes)
+
+	changes, err = Diff(link{ID: "1"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Change{"id": {From: "1"}, "is_active": {From: false}}, changes)
+}
+
+func TestDiffRejectsNonObjects(t *testing.T) {
+	_, err := Diff("not an object", nil)
+	assert.Error(t, err)
+}
+
+// recordingExecer captures the arguments of the last statement
+type recordingExecer struct {
+	args []any
+}
+
+func (r *recordingExecer) ExecContext(_ context.Context, _ string, args ...any) (sql.Result, error) {
+	r.args = args
+	return nil, nil
+}
+
+func TestRecord(t *testing.T) {
+	db := &recordingExecer{}
+	err := Record(context.Background(), db, Entry{
+		Actor:      "admin",
+		Action:     ActionDeactivate,
+		TargetType: TargetURL,
+		TargetID:   "1",
+		Before:     link{ID: "1", IsActive: true},
+		After:      link{ID: "1", IsActive: false},
+		RequestID:  "req-1",
+	})
+	require.NoError(t, err)
+
+	require.Len(t, db.args, 11)
+	assert.Equal(t, []any{"admin", ActionDeactivate, TargetURL, "1"}, db.args[1:5])
+	assert.JSONEq(t, `{"is_active":{"from":true,"to":false}}`, string(db.args[7].([]byte)))
+	assert.Nil(t, db.args[8], "empty IP is stored as NULL")
+	assert.Equal(t, "req-1", *db.args[9].(*string))
+
+	var before map[string]any
+	require.NoError(t, json.Unmarshal(db.args[5].([]byte), &before))
+	assert.Equal(t, true, before["is_active"])
+}
@@ -0,0 +1,617 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds all runtime configuration for the service.
+//
+// Values are resolved in increasing order of precedence: built-in defaults,
+// the optional config file (YAML or TOML), environment variables, and
+// finally command-line flags.
+type Config struct {
+	Server      ServerConfig      `yaml:"server" toml:"server"`
+	Log         LogConfig         `yaml:"log" toml:"log"`
+	Database    DatabaseConfig    `yaml:"database" toml:"database"`
+	RateLimit   RateLimitConfig   `yaml:"rate_limit" toml:"rate_limit"`
+	CORS        CORSConfig        `yaml:"cors" toml:"cors"`
+	Screening   ScreeningConfig   `yaml:"screening" toml:"screening"`
+	Destination DestinationConfig `yaml:"destination" toml:"destination"`
+	Admin       AdminConfig       `yaml:"admin" toml:"admin"`
+	Trash       TrashConfig       `yaml:"trash" toml:"trash"`
+	Bulk        BulkConfig        `yaml:"bulk" toml:"bulk"`
+	QR          QRConfig          `yaml:"qr" toml:"qr"`
+	Analytics   AnalyticsConfig   `yaml:"analytics" toml:"analytics"`
+}
+
+// ServerConfig holds HTTP server settings
+type ServerConfig struct {
+	Port    string `yaml:"port" toml:"port" env:"PORT"`
+	GinMode string `yaml:"gin_mode" toml:"gin_mode" env:"GIN_MODE"`
+	// AppURL is the public base URL used to build short links. When empty
+	// the scheme and host of the incoming request are used.
+	AppURL string `yaml:"app_url" toml:"app_url" env:"APP_URL"`
+}
+
+// LogConfig holds structured logging settings
+type LogConfig struct {
+	Level  string `yaml:"level" toml:"level" env:"LOG_LEVEL"`
+	Format string `yaml:"format" toml:"format" env:"LOG_FORMAT"`
+}
+
+// DatabaseConfig holds PostgreSQL connection and pool settings
+type DatabaseConfig struct {
+	Host            string        `yaml:"host" toml:"host" env:"DB_HOST"`
+	Port            string        `yaml:"port" toml:"port" env:"DB_PORT"`
+	User            string        `yaml:"user" toml:"user" env:"DB_USER"`
+	Password        string        `yaml:"password" toml:"password" env:"DB_PASSWORD" secret:"true"`
+	Name            string        `yaml:"name" toml:"name" env:"DB_NAME"`
+	SSLMode         string        `yaml:"sslmode" toml:"sslmode" env:"DB_SSLMODE"`
+	MaxOpenConns    int           `yaml:"max_open_conns" toml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" toml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+}
+
+// RateLimitConfig holds the token bucket rate limit settings. The embedded
+// policy is the default for routes without a more specific named policy.
+type RateLimitConfig struct {
+	// Backend is "memory" (per replica) or "redis" (shared by replicas)
+	Backend               string `yaml:"backend" toml:"backend" env:"RATE_LIMIT_BACKEND"`
+	RedisURL              string `yaml:"redis_url" toml:"redis_url" env:"RATE_LIMIT_REDIS_URL" secret:"true"`
+	RateLimitPolicyConfig `yaml:",inline" envPrefix:"RATE_LIMIT_"`
+	Policies              RateLimitPolicies `yaml:"policies" toml:"policies"`
+}
+
+// RateLimitPolicies holds the named per-route policies
+type RateLimitPolicies struct {
+	// Redirect applies to GET /:shortCode
+	Redirect RateLimitPolicyConfig `yaml:"redirect" toml:"redirect" envPrefix:"RATE_LIMIT_REDIRECT_"`
+	// Shorten applies to link creation by users and API key holders
+	Shorten RateLimitPolicyConfig `yaml:"shorten" toml:"shorten" envPrefix:"RATE_LIMIT_SHORTEN_"`
+	// ShortenAnonymous applies to link creation without a user or API key
+	ShortenAnonymous RateLimitPolicyConfig `yaml:"shorten_anonymous" toml:"shorten_anonymous" envPrefix:"RATE_LIMIT_SHORTEN_ANONYMOUS_"`
+	// Analytics applies to the analytics endpoints
+	Analytics RateLimitPolicyConfig `yaml:"analytics" toml:"analytics" envPrefix:"RATE_LIMIT_ANALYTICS_"`
+}
+
+// RateLimitPolicyConfig describes one token bucket policy. Each client may
+// burst up to Burst requests (default Requests), refilled at Requests per
+// Window.
+type RateLimitPolicyConfig struct {
+	Requests int           `yaml:"requests" toml:"requests" env:"REQUESTS"`
+	Window   time.Duration `yaml:"window" toml:"window" env:"WINDOW"`
+	Burst    int           `yaml:"burst" toml:"burst" env:"BURST"`
+	// IdentifyBy lists identity kinds ("user", "api_key", "ip") in order of
+	// preference; the first present on a request keys its bucket. Users
+	// and API keys only count once authentication has verified them.
+	IdentifyBy []string `yaml:"identify_by" toml:"identify_by" env:"IDENTIFY_BY"`
+}
+
+// CORSConfig holds cross-origin settings. Allowed origins are exact
+// origins, patterns with a leading wildcard label such as
+// https://*.example.com, or "*" for any origin.
+type CORSConfig struct {
+	AllowedOrigins   []string      `yaml:"allowed_origins" toml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS"`
+	AllowedMethods   []string      `yaml:"allowed_methods" toml:"allowed_methods" env:"CORS_ALLOWED_METHODS"`
+	AllowedHeaders   []string      `yaml:"allowed_headers" toml:"allowed_headers" env:"CORS_ALLOWED_HEADERS"`
+	ExposedHeaders   []string      `yaml:"exposed_headers" toml:"exposed_headers" env:"CORS_EXPOSED_HEADERS"`
+	AllowCredentials bool          `yaml:"allow_credentials" toml:"allow_credentials" env:"CORS_ALLOW_CREDENTIALS"`
+	MaxAge           time.Duration `yaml:"max_age" toml:"max_age" env:"CORS_MAX_AGE"`
+}
+
+// ScreeningConfig holds destination URL safety screening settings. URLs are
+// checked against local blocklists and, when an API key is set, a Safe
+// Browsing v4 compatible lookup service.
+type ScreeningConfig struct {
+	// HostsFiles are domain blocklists in hosts-file format
+	HostsFiles []string `yaml:"hosts_files" toml:"hosts_files" env:"SCREENING_HOSTS_FILES"`
+	// HashPrefixFiles list hex SHA-256 prefixes of URL expressions
+	HashPrefixFiles []string `yaml:"hash_prefix_files" toml:"hash_prefix_files" env:"SCREENING_HASH_PREFIX_FILES"`
+	// ReloadInterval re-reads the blocklists periodically; 0 reloads only
+	// on SIGHUP
+	ReloadInterval     time.Duration `yaml:"reload_interval" toml:"reload_interval" env:"SCREENING_RELOAD_INTERVAL"`
+	SafeBrowsingAPIKey string        `yaml:"safe_browsing_api_key" toml:"safe_browsing_api_key" env:"SCREENING_SAFE_BROWSING_API_KEY" secret:"true"`
+	SafeBrowsingURL    string        `yaml:"safe_browsing_url" toml:"safe_browsing_url" env:"SCREENING_SAFE_BROWSING_URL"`
+	Timeout            time.Duration `yaml:"timeout" toml:"timeout" env:"SCREENING_TIMEOUT"`
+	// RecheckInterval is how often active links are screened again; 0
+	// disables re-checks
+	RecheckInterval time.Duration `yaml:"recheck_interval" toml:"recheck_interval" env:"SCREENING_RECHECK_INTERVAL"`
+	// RecheckAge is how long a screening result is trusted before the link
+	// is due for a re-check
+	RecheckAge       time.Duration `yaml:"recheck_age" toml:"recheck_age" env:"SCREENING_RECHECK_AGE"`
+	RecheckBatchSize int           `yaml:"recheck_batch_size" toml:"recheck_batch_size" env:"SCREENING_RECHECK_BATCH_SIZE"`
+}
+
+// DestinationConfig holds the rules for which hosts links may point to.
+// Destinations on this service's own host are always rejected.
+type DestinationConfig struct {
+	// BlockedDomains are other URL shorteners; their subdomains are blocked too
+	BlockedDomains []string `yaml:"blocked_domains" toml:"blocked_domains" env:"DESTINATION_BLOCKED_DOMAINS"`
+	// AllowPrivateNetworks permits private, loopback and link-local
+	// destinations, e.g. for an intranet deployment
+	AllowPrivateNetworks bool `yaml:"allow_private_networks" toml:"allow_private_networks" env:"DESTINATION_ALLOW_PRIVATE_NETWORKS"`
+	// ResolveHosts resolves domain names so that names pointing into
+	// private networks are rejected as well
+	ResolveHosts   bool          `yaml:"resolve_hosts" toml:"resolve_hosts" env:"DESTINATION_RESOLVE_HOSTS"`
+	ResolveTimeout time.Duration `yaml:"resolve_timeout" toml:"resolve_timeout" env:"DESTINATION_RESOLVE_TIMEOUT"`
+}
+
+// AdminConfig holds settings for the admin (moderation) API
+type AdminConfig struct {
+	// Token authorizes admin requests via X-Admin-Token; empty disables the
+	// admin API
+	Token string `yaml:"token" toml:"token" env:"ADMIN_TOKEN" secret:"true"`
+}
+
+// TrashConfig holds soft deletion settings
+type TrashConfig struct {
+	// Retention is how long deleted links can be restored before they are
+	// purged with their click history
+	Retention     time.Duration `yaml:"retention" toml:"retention" env:"TRASH_RETENTION"`
+	PurgeInterval time.Duration `yaml:"purge_interval" toml:"purge_interval" env:"TRASH_PURGE_INTERVAL"`
+	// CodeReuseCooldown keeps the codes of purged links reserved so they
+	// cannot be claimed to capture the old link's traffic
+	CodeReuseCooldown time.Duration `yaml:"code_reuse_cooldown" toml:"code_reuse_cooldown" env:"TRASH_CODE_REUSE_COOLDOWN"`
+}
+
+// BulkConfig holds limits for creating many links in one request
+type BulkConfig struct {
+	// MaxItems is the most links one bulk request may create
+	MaxItems int `yaml:"max_items" toml:"max_items" env:"BULK_MAX_ITEMS"`
+	// MaxImportRows is the most rows one import may read; the rest of the
+	// file is left unread
+	MaxImportRows int `yaml:"max_import_rows" toml:"max_import_rows" env:"BULK_MAX_IMPORT_ROWS"`
+}
+
+// QRConfig holds QR code image settings
+type QRConfig struct {
+	// MaxSize is the largest QR image, in pixels per side, a request may ask for
+	MaxSize int `yaml:"max_size" toml:"max_size" env:"QR_MAX_SIZE"`
+	// CacheMaxAge is how long clients and CDNs may cache QR images
+	CacheMaxAge time.Duration `yaml:"cache_max_age" toml:"cache_max_age" env:"QR_CACHE_MAX_AGE"`
+	// Inline makes link create and get responses embed the QR code as a
+	// data URI unless the request opts out with include_qr=false
+	Inline bool `yaml:"inline" toml:"inline" env:"QR_INLINE"`
+	// InlineCacheSize is how many inline QR codes are kept in memory, 0
+	// to render them on every request
+	InlineCacheSize int `yaml:"inline_cache_size" toml:"inline_cache_size" env:"QR_INLINE_CACHE_SIZE"`
+}
+
+// AnalyticsConfig holds click analytics settings
+type AnalyticsConfig struct {
+	// RollupInterval is how often clicks are folded into the hourly and
+	// daily rollups analytics read from
+	RollupInterval time.Duration `yaml:"rollup_interval" toml:"rollup_interval" env:"ANALYTICS_ROLLUP_INTERVAL"`
+	// RollupDelay is how long after an hour ends its clicks are rolled up,
+	// leaving time for clicks that are still being recorded
+	RollupDelay time.Duration `yaml:"rollup_delay" toml:"rollup_delay" env:"ANALYTICS_ROLLUP_DELAY"`
+	// RawRetention is how long raw clicks are kept before their monthly
+	// partition is dropped; the rollups are kept forever. Zero keeps raw
+	// clicks forever.
+	RawRetention time.Duration `yaml:"raw_retention" toml:"raw_retention" env:"ANALYTICS_RAW_RETENTION"`
+	// PartitionsAhead is how many months of clicks partitions are created
+	// ahead of the current one
+	PartitionsAhead int `yaml:"partitions_ahead" toml:"partitions_ahead" env:"ANALYTICS_PARTITIONS_AHEAD"`
+	// PartitionInterval is how often clicks partitions are created and
+	// expired ones dropped
+	PartitionInterval time.Duration `yaml:"partition_interval" toml:"partition_interval" env:"ANALYTICS_PARTITION_INTERVAL"`
+	// IPStorage is how much of a visitor's IP address clicks store:
+	// "truncated" to its /24 (IPv4) or /48 (IPv6) network, "none", or
+	// "full", which must be opted into. Unique visitors are counted from
+	// daily visitor IDs either way.
+	IPStorage string `yaml:"ip_storage" toml:"ip_storage" env:"ANALYTICS_IP_STORAGE"`
+}
+
+// Enabled reports whether any screening source is configured
+func (s ScreeningConfig) Enabled() bool {
+	return len(s.HostsFiles) > 0 || len(s.HashPrefixFiles) > 0 || s.SafeBrowsingAPIKey != ""
+}
+
+// Default returns the configuration used when nothing else is specified.
+// It deliberately has no database password; one must be supplied.
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Port:    "8080",
+			GinMode: "debug",
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "json",
+		},
+		Database: DatabaseConfig{
+			Host:            "localhost",
+			Port:            "5432",
+			User:            "postgres",
+			Name:            "url_shortener",
+			SSLMode:         "disable",
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+		},
+		RateLimit: RateLimitConfig{
+			Backend:  "memory",
+			RedisURL: "redis://localhost:6379/0",
+			RateLimitPolicyConfig: RateLimitPolicyConfig{
+				Requests:   100,
+				Window:     time.Minute,
+				IdentifyBy: []string{"user", "ip"},
+			},
+			Policies: RateLimitPolicies{
+				// Popular links can be opened by many people behind one NAT
+				Redirect: RateLimitPolicyConfig{
+					Requests:   1000,
+					Window:     time.Minute,
+					Burst:      200,
+					IdentifyBy: []string{"ip"},
+				},
+				Shorten: RateLimitPolicyConfig{
+					Requests:   60,
+					Window:     time.Minute,
+					IdentifyBy: []string{"user", "ip"},
+				},
+				ShortenAnonymous: RateLimitPolicyConfig{
+					Requests:   10,
+					Window:     time.Minute,
+					IdentifyBy: []string{"ip"},
+				},
+				Analytics: RateLimitPolicyConfig{
+					Requests:   60,
+					Window:     time.Minute,
+					IdentifyBy: []string{"user", "ip"},
+				},
+			},
+		},
+		CORS: CORSConfig{
+			AllowedOrigins:   []string{"http://localhost:4000", "http://localhost:3000"},
+			AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+			AllowedHeaders:   []string{"Content-Type", "Authorization", "X-Requested-With", "X-Request-ID"},
+			ExposedHeaders:   []string{"X-Request-ID", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After"},
+			AllowCredentials: false,
+			MaxAge:           24 * time.Hour,
+		},
+		Screening: ScreeningConfig{
+			Timeout:          5 * time.Second,
+			RecheckInterval:  time.Hour,
+			RecheckAge:       24 * time.Hour,
+			RecheckBatchSize: 500,
+		},
+		Destination: DestinationConfig{
+			BlockedDomains: []string{
+				"bit.ly", "bitly.com", "tinyurl.com", "t.co", "goo.gl", "ow.ly", "is.gd", "buff.ly",
+				"rebrand.ly", "cutt.ly", "shorturl.at", "tiny.cc", "rb.gy", "t.ly", "v.gd", "s.id",
+			},
+			ResolveHosts:   true,
+			ResolveTimeout: 2 * time.Second,
+		},
+		Trash: TrashConfig{
+			Retention:         30 * 24 * time.Hour,
+			PurgeInterval:     time.Hour,
+			CodeReuseCooldown: 90 * 24 * time.Hour,
+		},
+		Bulk: BulkConfig{
+			MaxItems:      500,
+			MaxImportRows: 10000,
+		},
+		QR: QRConfig{
+			MaxSize:         2048,
+			CacheMaxAge:     24 * time.Hour,
+			Inline:          true,
+			InlineCacheSize: 1024,
+		},
+		Analytics: AnalyticsConfig{
+			RollupInterval:    5 * time.Minute,
+			RollupDelay:       5 * time.Minute,
+			PartitionsAhead:   3,
+			PartitionInterval: time.Hour,
+			IPStorage:         "truncated",
+		},
+	}
+}
+
+// Load resolves the configuration from defaults, the config file, the
+// environment and the given command-line arguments, then validates it
+func Load(args []string) (*Config, error) {
+	flags := flag.NewFlagSet("url-shortener", flag.ContinueOnError)
+	configFile := flags.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML or TOML config file")
+	port := flags.String("port", "", "HTTP listen port")
+	appURL := flags.String("app-url", "", "public base URL for short links")
+	ginMode := flags.String("gin-mode", "", "gin mode (debug, release or test)")
+	logLevel := flags.String("log-level", "", "log level (debug, info, warn or error)")
+	logFormat := flags.String("log-format", "", "log format (json or text)")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg := Default()
+
+	if *configFile != "" {
+		if err := loadFile(*configFile, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := applyEnv(cfg); err != nil {
+		return nil, err
+	}
+
+	// Only flags given explicitly override earlier sources
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "port":
+			cfg.Server.Port = *port
+		case "app-url":
+			cfg.Server.AppURL = *appURL
+		case "gin-mode":
+			cfg.Server.GinMode = *ginMode
+		case "log-level":
+			cfg.Log.Level = *logLevel
+		case "log-format":
+			cfg.Log.Format = *logFormat
+		}
+	})
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// loadFile decodes a YAML or TOML file on top of cfg
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	case ".toml":
+		err = toml.Unmarshal(data, cfg)
+	default:
+		return fmt.Errorf("unsupported config file format: %s", path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+	return nil
+}
+
+// Validate reports every invalid or missing setting at once
+func (c *Config) Validate() error {
+	var errs []error
+
+	if port, err := strconv.Atoi(c.Server.Port); err != nil || port < 1 || port > 65535 {
+		errs = append(errs, fmt.Errorf("server port %q is not a valid port", c.Server.Port))
+	}
+	switch c.Server.GinMode {
+	case "debug", "release", "test":
+	default:
+		errs = append(errs, fmt.Errorf("gin mode %q must be debug, release or test", c.Server.GinMode))
+	}
+	if c.Server.AppURL != "" {
+		if u, err := url.Parse(c.Server.AppURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("app URL %q must be an absolute http(s) URL", c.Server.AppURL))
+		}
+	}
+
+	switch strings.ToLower(c.Log.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("log level %q must be debug, info, warn or error", c.Log.Level))
+	}
+	switch strings.ToLower(c.Log.Format) {
+	case "json", "text":
+	default:
+		errs = append(errs, fmt.Errorf("log format %q must be json or text", c.Log.Format))
+	}
+
+	if c.Database.Host == "" {
+		errs = append(errs, errors.New("database host is required (DB_HOST)"))
+	}
+	if c.Database.User == "" {
+		errs = append(errs, errors.New("database user is required (DB_USER)"))
+	}
+	if c.Database.Password == "" {
+		errs = append(errs, errors.New("database password is required (DB_PASSWORD or DB_PASSWORD_FILE)"))
+	}
+	if c.Database.Name == "" {
+		errs = append(errs, errors.New("database name is required (DB_NAME)"))
+	}
+	if c.Database.MaxOpenConns < 1 {
+		errs = append(errs, errors.New("database max open connections must be at least 1"))
+	}
+	if c.Database.MaxIdleConns < 0 || c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		errs = append(errs, errors.New("database max idle connections must be between 0 and max open connections"))
+	}
+	if c.Database.ConnMaxLifetime < 0 {
+		errs = append(errs, errors.New("database connection max lifetime cannot be negative"))
+	}
+
+	switch c.RateLimit.Backend {
+	case "memory":
+	case "redis":
+		if c.RateLimit.RedisURL == "" {
+			errs = append(errs, errors.New("rate limit Redis URL is required for the redis backend"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("rate limit backend %q must be memory or redis", c.RateLimit.Backend))
+	}
+	policies := c.RateLimit.NamedPolicies()
+	names := make([]string, 0, len(policies))
+	for name := range policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		errs = append(errs, policies[name].validate(name)...)
+	}
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		if err := validateOriginPattern(origin); err != nil {
+			errs = append(errs, err)
+		}
+		if origin == "*" && c.CORS.AllowCredentials {
+			errs = append(errs, errors.New("CORS credentials cannot be allowed for the \"*\" origin"))
+		}
+	}
+	if len(c.CORS.AllowedMethods) == 0 {
+		errs = append(errs, errors.New("CORS allowed methods cannot be empty"))
+	}
+	if c.CORS.MaxAge < 0 {
+		errs = append(errs, errors.New("CORS max age cannot be negative"))
+	}
+
+	if c.Screening.ReloadInterval < 0 {
+		errs = append(errs, errors.New("screening reload interval cannot be negative"))
+	}
+	if c.Screening.Timeout <= 0 {
+		errs = append(errs, errors.New("screening timeout must be positive"))
+	}
+	if c.Screening.RecheckInterval < 0 {
+		errs = append(errs, errors.New("screening recheck interval cannot be negative"))
+	}
+	if c.Screening.RecheckAge < 0 {
+		errs = append(errs, errors.New("screening recheck age cannot be negative"))
+	}
+	if c.Screening.RecheckBatchSize < 1 {
+		errs = append(errs, errors.New("screening recheck batch size must be at least 1"))
+	}
+	if c.Screening.SafeBrowsingURL != "" {
+		if u, err := url.Parse(c.Screening.SafeBrowsingURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("safe browsing URL %q must be an absolute http(s) URL", c.Screening.SafeBrowsingURL))
+		}
+	}
+
+	if c.Destination.ResolveHosts && c.Destination.ResolveTimeout <= 0 {
+		errs = append(errs, errors.New("destination resolve timeout must be positive"))
+	}
+	for _, domain := range c.Destination.BlockedDomains {
+		if strings.ContainsAny(domain, "/:* ") {
+			errs = append(errs, fmt.Errorf("blocked destination domain %q must be a bare domain name", domain))
+		}
+	}
+
+	if c.Admin.Token != "" && len(c.Admin.Token) < 16 {
+		errs = append(errs, errors.New("admin token must be at least 16 characters"))
+	}
+
+	if c.Trash.Retention <= 0 {
+		errs = append(errs, errors.New("trash retention must be positive"))
+	}
+	if c.Trash.PurgeInterval <= 0 {
+		errs = append(errs, errors.New("trash purge interval must be positive"))
+	}
+	if c.Trash.CodeReuseCooldown < 0 {
+		errs = append(errs, errors.New("trash code reuse cooldown cannot be negative"))
+	}
+
+	if c.Bulk.MaxItems < 1 {
+		errs = append(errs, errors.New("bulk max items must be at least 1"))
+	}
+	if c.Bulk.MaxImportRows < 1 {
+		errs = append(errs, errors.New("bulk max import rows must be at least 1"))
+	}
+
+	if c.QR.MaxSize < 64 {
+		errs = append(errs, errors.New("QR max size must be at least 64 pixels"))
+	}
+	if c.QR.CacheMaxAge < 0 {
+		errs = append(errs, errors.New("QR cache max age cannot be negative"))
+	}
+	if c.QR.InlineCacheSize < 0 {
+		errs = append(errs, errors.New("QR inline cache size cannot be negative"))
+	}
+
+	if c.Analytics.RollupInterval <= 0 {
+		errs = append(errs, errors.New("analytics rollup interval must be positive"))
+	}
+	if c.Analytics.RollupDelay < 0 {
+		errs = append(errs, errors.New("analytics rollup delay cannot be negative"))
+	}
+	if c.Analytics.RawRetention != 0 && c.Analytics.RawRetention < 24*time.Hour {
+		errs = append(errs, errors.New("analytics raw retention must be zero or at least 24h"))
+	}
+	if c.Analytics.PartitionsAhead < 1 {
+		errs = append(errs, errors.New("analytics partitions ahead must be at least 1"))
+	}
+	if c.Analytics.PartitionInterval <= 0 {
+		errs = append(errs, errors.New("analytics partition interval must be positive"))
+	}
+	switch c.Analytics.IPStorage {
+	case "full", "truncated", "none":
+	default:
+		errs = append(errs, fmt.Errorf("analytics IP storage %q must be full, truncated or none", c.Analytics.IPStorage))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// validateOriginPattern checks an allowed-origin entry. A wildcard is only
+// permitted as the whole entry or as the leftmost label of the host.
+func validateOriginPattern(origin string) error {
+	if origin == "*" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") {
+		return fmt.Errorf("CORS origin %q must look like https://example.com", origin)
+	}
+	host := strings.TrimPrefix(u.Hostname(), "*.")
+	if strings.Contains(host, "*") || host == "" {
+		return fmt.Errorf("CORS origin %q may only use a wildcard as the leftmost label", origin)
+	}
+	return nil
+}
+
+// NamedPolicies returns every rate limit policy keyed by name
+func (c RateLimitConfig) NamedPolicies() map[string]RateLimitPolicyConfig {
+	return map[string]RateLimitPolicyConfig{
+		"default":           c.RateLimitPolicyConfig,
+		"redirect":          c.Policies.Redirect,
+		"shorten":           c.Policies.Shorten,
+		"shorten_anonymous": c.Policies.ShortenAnonymous,
+		"analytics":         c.Policies.Analytics,
+	}
+}
+
+// validate checks a single rate limit policy
+func (p RateLimitPolicyConfig) validate(name string) []error {
+	var errs []error
+	if p.Requests < 1 {
+		errs = append(errs, fmt.Errorf("rate limit policy %s: requests must be at least 1", name))
+	}
+	if p.Window <= 0 {
+		errs = append(errs, fmt.Errorf("rate limit policy %s: window must be positive", name))
+	}
+	if p.Burst < 0 {
+		errs = append(errs, fmt.Errorf("rate limit policy %s: burst cannot be negative", name))
+	}
+	if len(p.IdentifyBy) == 0 {
+		errs = append(errs, fmt.Errorf("rate limit policy %s: identify_by cannot be empty", name))
+	}
+	for _, identity := range p.IdentifyBy {
+		switch identity {
+		case "user", "api_key", "ip":
+		default:
+			errs = append(errs, fmt.Errorf("rate limit policy %s: identity %q must be user, api_key or ip", name, identity))
+		}
+	}
+	return errs
+}
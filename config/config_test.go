@@ -0,0 +1,387 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// clearEnv unsets every variable Load reads so tests start from defaults
+func clearEnv(t *testing.T) {
+	for _, key := range []string{
+		"CONFIG_FILE", "PORT", "GIN_MODE", "APP_URL", "LOG_LEVEL", "LOG_FORMAT",
+		"DB_HOST", "DB_PORT", "DB_USER", "DB_PASSWORD", "DB_PASSWORD_FILE", "DB_NAME", "DB_SSLMODE",
+		"DB_MAX_OPEN_CONNS", "DB_MAX_IDLE_CONNS", "DB_CONN_MAX_LIFETIME",
+		"RATE_LIMIT_BACKEND", "RATE_LIMIT_REDIS_URL", "RATE_LIMIT_REDIS_URL_FILE",
+		"RATE_LIMIT_REQUESTS", "RATE_LIMIT_WINDOW", "RATE_LIMIT_BURST", "RATE_LIMIT_IDENTIFY_BY",
+		"RATE_LIMIT_REDIRECT_REQUESTS", "RATE_LIMIT_SHORTEN_ANONYMOUS_REQUESTS",
+		"CORS_ALLOWED_ORIGINS", "CORS_ALLOWED_METHODS", "CORS_ALLOWED_HEADERS", "CORS_EXPOSED_HEADERS",
+		"CORS_ALLOW_CREDENTIALS", "CORS_MAX_AGE",
+		"SCREENING_HOSTS_FILES", "SCREENING_HASH_PREFIX_FILES", "SCREENING_RELOAD_INTERVAL",
+		"SCREENING_SAFE_BROWSING_API_KEY", "SCREENING_SAFE_BROWSING_API_KEY_FILE", "SCREENING_SAFE_BROWSING_URL",
+		"SCREENING_TIMEOUT", "SCREENING_RECHECK_INTERVAL", "SCREENING_RECHECK_AGE", "SCREENING_RECHECK_BATCH_SIZE",
+		"DESTINATION_BLOCKED_DOMAINS", "DESTINATION_ALLOW_PRIVATE_NETWORKS", "DESTINATION_RESOLVE_HOSTS", "DESTINATION_RESOLVE_TIMEOUT",
+		"ADMIN_TOKEN", "ADMIN_TOKEN_FILE",
+		"TRASH_RETENTION", "TRASH_PURGE_INTERVAL", "TRASH_CODE_REUSE_COOLDOWN",
+		"BULK_MAX_ITEMS",
+		"BULK_MAX_IMPORT_ROWS",
+		"QR_MAX_SIZE",
+		"QR_CACHE_MAX_AGE",
+		"QR_INLINE",
+		"QR_INLINE_CACHE_SIZE",
+		"ANALYTICS_ROLLUP_INTERVAL",
+		"ANALYTICS_ROLLUP_DELAY",
+		"ANALYTICS_RAW_RETENTION",
+		"ANALYTICS_PARTITIONS_AHEAD",
+		"ANALYTICS_PARTITION_INTERVAL",
+		"ANALYTICS_IP_STORAGE",
+	} {
+		t.Setenv(key, "")
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadRequiresDatabasePassword(t *testing.T) {
+	clearEnv(t)
+
+	_, err := Load(nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "database password is required")
+}
+
+func TestLoadFromEnv(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("DB_PASSWORD", "secret")
+	t.Setenv("DB_MAX_OPEN_CONNS", "50")
+	t.Setenv("RATE_LIMIT_WINDOW", "30s")
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://a.example.com, https://b.example.com")
+
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, "secret", cfg.Database.Password)
+	assert.Equal(t, 50, cfg.Database.MaxOpenConns)
+	assert.Equal(t, 30*time.Second, cfg.RateLimit.Window)
+	assert.Equal(t, []string{"https://a.example.com", "https://b.example.com"}, cfg.CORS.AllowedOrigins)
+	assert.Equal(t, "8080", cfg.Server.Port)
+}
+
+func TestLoadSecretFromFile(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("DB_PASSWORD", "ignored")
+	t.Setenv("DB_PASSWORD_FILE", writeFile(t, "db_password", "from-file\n"))
+
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "from-file", cfg.Database.Password)
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	clearEnv(t)
+	path := writeFile(t, "config.yaml", `
+server:
+  port: "9000"
+  app_url: https://sho.rt
+database:
+  password: file-secret
+  max_idle_conns: 2
+rate_limit:
+  requests: 10
+  window: 2m
+`)
+	t.Setenv("PORT", "9100")
+
+	cfg, err := Load([]string{"-config", path, "-log-level", "debug"})
+	require.NoError(t, err)
+
+	// File overrides defaults, env overrides file, flags override env
+	assert.Equal(t, "9100", cfg.Server.Port)
+	assert.Equal(t, "https://sho.rt", cfg.Server.AppURL)
+	assert.Equal(t, "file-secret", cfg.Database.Password)
+	assert.Equal(t, 2, cfg.Database.MaxIdleConns)
+	assert.Equal(t, 10, cfg.RateLimit.Requests)
+	assert.Equal(t, 2*time.Minute, cfg.RateLimit.Window)
+	assert.Equal(t, "debug", cfg.Log.Level)
+
+	cfg, err = Load([]string{"-config", path, "-port", "9200"})
+	require.NoError(t, err)
+	assert.Equal(t, "9200", cfg.Server.Port)
+}
+
+func TestLoadTOMLFile(t *testing.T) {
+	clearEnv(t)
+	path := writeFile(t, "config.toml", `
+[database]
+password = "toml-secret"
+conn_max_lifetime = "5m"
+
+[cors]
+allowed_origins = ["https://app.example.com"]
+`)
+
+	cfg, err := Load([]string{"-config", path})
+	require.NoError(t, err)
+	assert.Equal(t, "toml-secret", cfg.Database.Password)
+	assert.Equal(t, 5*time.Minute, cfg.Database.ConnMaxLifetime)
+	assert.Equal(t, []string{"https://app.example.com"}, cfg.CORS.AllowedOrigins)
+}
+
+func TestValidateReportsAllErrors(t *testing.T) {
+	cfg := Default()
+	cfg.Server.Port = "http"
+	cfg.Server.AppURL = "sho.rt"
+	cfg.Database.Password = "secret"
+	cfg.Database.MaxIdleConns = 100
+	cfg.RateLimit.Requests = 0
+
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not a valid port")
+	assert.Contains(t, err.Error(), "absolute http(s) URL")
+	assert.Contains(t, err.Error(), "max idle connections")
+	assert.Contains(t, err.Error(), "rate limit policy default: requests")
+}
+
+func TestLoadRejectsInvalidEnvValue(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("DB_PASSWORD", "secret")
+	t.Setenv("DB_MAX_OPEN_CONNS", "lots")
+
+	_, err := Load(nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "DB_MAX_OPEN_CONNS")
+}
+
+func TestValidateCORSOrigins(t *testing.T) {
+	cfg := Default()
+	cfg.Database.Password = "secret"
+	cfg.CORS.AllowedOrigins = []string{"https://*.example.com", "http://localhost:3000", "*"}
+	assert.NoError(t, cfg.Validate())
+
+	for _, origin := range []string{"example.com", "https://a.*.example.com", "https://example.com/path", ""} {
+		cfg.CORS.AllowedOrigins = []string{origin}
+		assert.Error(t, cfg.Validate(), origin)
+	}
+
+	cfg.CORS.AllowedOrigins = []string{"*"}
+	cfg.CORS.AllowCredentials = true
+	assert.Error(t, cfg.Validate())
+}
+
+func TestLoadNamedRateLimitPolicies(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("DB_PASSWORD", "secret")
+	t.Setenv("RATE_LIMIT_REDIRECT_REQUESTS", "5000")
+	t.Setenv("RATE_LIMIT_SHORTEN_ANONYMOUS_REQUESTS", "3")
+	path := writeFile(t, "config.yaml", `
+rate_limit:
+  requests: 50
+  policies:
+    analytics:
+      requests: 20
+      window: 10s
+      identify_by: [api_key, ip]
+`)
+
+	cfg, err := Load([]string{"-config", path})
+	require.NoError(t, err)
+
+	policies := cfg.RateLimit.NamedPolicies()
+	assert.Equal(t, 50, policies["default"].Requests)
+	assert.Equal(t, 5000, policies["redirect"].Requests)
+	assert.Equal(t, 3, policies["shorten_anonymous"].Requests)
+	assert.Equal(t, 20, policies["analytics"].Requests)
+	assert.Equal(t, 10*time.Second, policies["analytics"].Window)
+	assert.Equal(t, []string{"api_key", "ip"}, policies["analytics"].IdentifyBy)
+	// Unset policies keep their defaults
+	assert.Equal(t, 60, policies["shorten"].Requests)
+}
+
+func TestLoadScreening(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("DB_PASSWORD", "secret")
+
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+	assert.False(t, cfg.Screening.Enabled(), "screening is off until a source is configured")
+
+	t.Setenv("SCREENING_HOSTS_FILES", "/etc/blocklists/malware.hosts,/etc/blocklists/phishing.hosts")
+	t.Setenv("SCREENING_RECHECK_INTERVAL", "0")
+	cfg, err = Load(nil)
+	require.NoError(t, err)
+	assert.True(t, cfg.Screening.Enabled())
+	assert.Equal(t, []string{"/etc/blocklists/malware.hosts", "/etc/blocklists/phishing.hosts"}, cfg.Screening.HostsFiles)
+	assert.Zero(t, cfg.Screening.RecheckInterval)
+
+	t.Setenv("SCREENING_SAFE_BROWSING_URL", "ftp://lookup.example")
+	_, err = Load(nil)
+	assert.ErrorContains(t, err, "safe browsing URL")
+}
+
+func TestLoadDestination(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("DB_PASSWORD", "secret")
+	t.Setenv("DESTINATION_BLOCKED_DOMAINS", "short.example, go.example")
+	t.Setenv("DESTINATION_RESOLVE_HOSTS", "false")
+
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"short.example", "go.example"}, cfg.Destination.BlockedDomains)
+	assert.False(t, cfg.Destination.ResolveHosts)
+	assert.False(t, cfg.Destination.AllowPrivateNetworks)
+
+	t.Setenv("DESTINATION_BLOCKED_DOMAINS", "https://short.example")
+	_, err = Load(nil)
+	assert.ErrorContains(t, err, "must be a bare domain name")
+}
+
+func TestLoadAdminTokenLength(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("DB_PASSWORD", "secret")
+	t.Setenv("ADMIN_TOKEN", "short")
+
+	_, err := Load(nil)
+	assert.ErrorContains(t, err, "admin token must be at least 16 characters")
+}
+
+func TestLoadTrash(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("DB_PASSWORD", "secret")
+
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, 30*24*time.Hour, cfg.Trash.Retention)
+
+	t.Setenv("TRASH_RETENTION", "168h")
+	t.Setenv("TRASH_CODE_REUSE_COOLDOWN", "0")
+	cfg, err = Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, 7*24*time.Hour, cfg.Trash.Retention)
+	assert.Zero(t, cfg.Trash.CodeReuseCooldown)
+
+	t.Setenv("TRASH_RETENTION", "0")
+	_, err = Load(nil)
+	assert.ErrorContains(t, err, "trash retention must be positive")
+}
+
+func TestLoadBulk(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("DB_PASSWORD", "secret")
+
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, 500, cfg.Bulk.MaxItems)
+	assert.Equal(t, 10000, cfg.Bulk.MaxImportRows)
+
+	t.Setenv("BULK_MAX_IMPORT_ROWS", "2500")
+	cfg, err = Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2500, cfg.Bulk.MaxImportRows)
+
+	t.Setenv("BULK_MAX_IMPORT_ROWS", "0")
+	_, err = Load(nil)
+	assert.ErrorContains(t, err, "bulk max import rows must be at least 1")
+}
+
+func TestLoadQR(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("DB_PASSWORD", "secret")
+
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2048, cfg.QR.MaxSize)
+	assert.Equal(t, 24*time.Hour, cfg.QR.CacheMaxAge)
+	assert.True(t, cfg.QR.Inline)
+	assert.Equal(t, 1024, cfg.QR.InlineCacheSize)
+
+	t.Setenv("QR_INLINE", "false")
+	t.Setenv("QR_INLINE_CACHE_SIZE", "0")
+	cfg, err = Load(nil)
+	require.NoError(t, err)
+	assert.False(t, cfg.QR.Inline)
+	assert.Equal(t, 0, cfg.QR.InlineCacheSize)
+
+	t.Setenv("QR_INLINE_CACHE_SIZE", "-1")
+	_, err = Load(nil)
+	assert.ErrorContains(t, err, "QR inline cache size cannot be negative")
+
+	t.Setenv("QR_INLINE_CACHE_SIZE", "0")
+	t.Setenv("QR_MAX_SIZE", "32")
+	_, err = Load(nil)
+	assert.ErrorContains(t, err, "QR max size must be at least 64 pixels")
+}
+
+func TestLoadAnalytics(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("DB_PASSWORD", "secret")
+
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Minute, cfg.Analytics.RollupInterval)
+	assert.Equal(t, 5*time.Minute, cfg.Analytics.RollupDelay)
+
+	t.Setenv("ANALYTICS_ROLLUP_INTERVAL", "1m")
+	t.Setenv("ANALYTICS_ROLLUP_DELAY", "0")
+	cfg, err = Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, cfg.Analytics.RollupInterval)
+	assert.Equal(t, time.Duration(0), cfg.Analytics.RollupDelay)
+
+	t.Setenv("ANALYTICS_ROLLUP_INTERVAL", "0")
+	_, err = Load(nil)
+	assert.ErrorContains(t, err, "analytics rollup interval must be positive")
+}
+
+func TestLoadClickRetention(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("DB_PASSWORD", "secret")
+
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), cfg.Analytics.RawRetention)
+	assert.Equal(t, 3, cfg.Analytics.PartitionsAhead)
+	assert.Equal(t, time.Hour, cfg.Analytics.PartitionInterval)
+
+	t.Setenv("ANALYTICS_RAW_RETENTION", "2160h")
+	t.Setenv("ANALYTICS_PARTITIONS_AHEAD", "1")
+	cfg, err = Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, 90*24*time.Hour, cfg.Analytics.RawRetention)
+	assert.Equal(t, 1, cfg.Analytics.PartitionsAhead)
+
+	t.Setenv("ANALYTICS_RAW_RETENTION", "1h")
+	_, err = Load(nil)
+	assert.ErrorContains(t, err, "analytics raw retention must be zero or at least 24h")
+
+	t.Setenv("ANALYTICS_RAW_RETENTION", "0")
+	t.Setenv("ANALYTICS_PARTITIONS_AHEAD", "0")
+	_, err = Load(nil)
+	assert.ErrorContains(t, err, "analytics partitions ahead must be at least 1")
+}
+
+func TestLoadIPStorage(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("DB_PASSWORD", "secret")
+
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "truncated", cfg.Analytics.IPStorage)
+
+	t.Setenv("ANALYTICS_IP_STORAGE", "full")
+	cfg, err = Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "full", cfg.Analytics.IPStorage)
+
+	t.Setenv("ANALYTICS_IP_STORAGE", "hashed")
+	_, err = Load(nil)
+	assert.ErrorContains(t, err, `analytics IP storage "hashed" must be full, truncated or none`)
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// applyEnv overrides fields tagged with `env` from the environment. Fields
+// also tagged `secret:"true"` can be read from a file named by <ENV>_FILE,
+// which takes precedence over the plain variable. Nested structs tagged
+// `envPrefix` prepend the prefix to the env names of their fields.
+func applyEnv(cfg *Config) error {
+	return applyEnvStruct(reflect.ValueOf(cfg).Elem(), "")
+}
+
+func applyEnvStruct(v reflect.Value, prefix string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		value := v.Field(i)
+
+		key := field.Tag.Get("env")
+		if key == "" {
+			if value.Kind() == reflect.Struct && value.Type() != durationType {
+				if err := applyEnvStruct(value, prefix+field.Tag.Get("envPrefix")); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		key = prefix + key
+
+		raw, ok, err := lookupEnv(key, field.Tag.Get("secret") == "true")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if err := setField(value, raw); err != nil {
+			return fmt.Errorf("invalid value for %s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// lookupEnv returns the value of key, reading it from <key>_FILE for secrets
+func lookupEnv(key string, secret bool) (string, bool, error) {
+	if secret {
+		if path := os.Getenv(key + "_FILE"); path != "" {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return "", false, fmt.Errorf("failed to read %s_FILE: %v", key, err)
+			}
+			return strings.TrimRight(string(data), "\r\n"), true, nil
+		}
+	}
+
+	value := os.Getenv(key)
+	if value == "" {
+		return "", false, nil
+	}
+	return value, true, nil
+}
+
+// setField parses raw into the field according to its type
+func setField(value reflect.Value, raw string) error {
+	if value.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		value.SetInt(int64(d))
+		return nil
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+		value.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		value.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		value.SetBool(b)
+	case reflect.Slice:
+		if value.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported slice type %s", value.Type())
+		}
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		value.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported field type %s", value.Type())
+	}
+	return nil
+}
@@ -1,29 +1,24 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"log"
-	"os"
+	"log/slog"
+	"strings"
+	"time"
 
 	_ "github.com/lib/pq"
+	"url-shortener/config"
 )
 
 var DB *sql.DB
 
 // InitDatabase initializes the database connection
-func InitDatabase() error {
-	// Get database connection details from environment
-	dbHost := getEnv("DB_HOST", "localhost")
-	dbPort := getEnv("DB_PORT", "5432")
-	dbUser := getEnv("DB_USER", "postgres")
-	dbPassword := getEnv("DB_PASSWORD", "password")
-	dbName := getEnv("DB_NAME", "url_shortener")
-	dbSSLMode := getEnv("DB_SSLMODE", "disable")
-
+func InitDatabase(cfg config.DatabaseConfig) error {
 	// Create connection string
 	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		dbHost, dbPort, dbUser, dbPassword, dbName, dbSSLMode)
+		cfg.Host, cfg.Port, cfg.User, quoteConnValue(cfg.Password), cfg.Name, cfg.SSLMode)
 
 	// Open database connection
 	var err error
@@ -38,10 +33,11 @@ func InitDatabase() error {
 	}
 
 	// Set connection pool settings
-	DB.SetMaxOpenConns(25)
-	DB.SetMaxIdleConns(5)
+	DB.SetMaxOpenConns(cfg.MaxOpenConns)
+	DB.SetMaxIdleConns(cfg.MaxIdleConns)
+	DB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
 
-	log.Println("Database connection established successfully")
+	slog.Info("Database connection established successfully")
 	return nil
 }
 
@@ -72,10 +68,11 @@ func CreateTables() error {
 		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 	);`
 
-	// Create clicks table
+	// Create clicks table, partitioned by month so raw clicks past their
+	// retention can be dropped a partition at a time
 	clicksTable := `
 	CREATE TABLE IF NOT EXISTS clicks (
-		id UUID PRIMARY KEY,
+		id UUID NOT NULL,
 		url_id UUID NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
 		ip_address INET NOT NULL,
 		user_agent TEXT,
@@ -85,9 +82,213 @@ func CreateTables() error {
 		device VARCHAR(50),
 		browser VARCHAR(50),
 		os VARCHAR(50),
-		clicked_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		clicked_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (id, clicked_at)
+	) PARTITION BY RANGE (clicked_at);`
+
+	// Create URL revisions table. Each change to a link's destination,
+	// title, description or expiry is stored as a new revision.
+	revisionsTable := `
+	CREATE TABLE IF NOT EXISTS url_revisions (
+		url_id UUID NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+		revision INTEGER NOT NULL,
+		original_url TEXT NOT NULL,
+		title VARCHAR(255),
+		description TEXT,
+		expires_at TIMESTAMP,
+		created_by VARCHAR(200) NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (url_id, revision)
+	);`
+
+	// Create abuse reporting and moderation tables. Reports and actions keep
+	// a copy of the short code so they survive deletion of the link.
+	moderationTables := []string{`
+	CREATE TABLE IF NOT EXISTS abuse_reports (
+		id UUID PRIMARY KEY,
+		url_id UUID REFERENCES urls(id) ON DELETE SET NULL,
+		short_code VARCHAR(50) NOT NULL,
+		reason VARCHAR(20) NOT NULL,
+		details TEXT,
+		reporter_ip INET NOT NULL,
+		status VARCHAR(20) NOT NULL DEFAULT 'open',
+		resolved_action VARCHAR(20),
+		resolved_at TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`, `
+	CREATE TABLE IF NOT EXISTS moderation_actions (
+		id UUID PRIMARY KEY,
+		url_id UUID,
+		action VARCHAR(20) NOT NULL,
+		reason TEXT,
+		actor VARCHAR(100) NOT NULL,
+		details JSONB,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`, `
+	CREATE TABLE IF NOT EXISTS bans (
+		id UUID PRIMARY KEY,
+		kind VARCHAR(10) NOT NULL,
+		value TEXT NOT NULL,
+		reason TEXT,
+		created_by VARCHAR(100) NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (kind, value)
+	);`,
+	}
+
+	// Create audit log table. Targets are not foreign keys so entries
+	// outlive what they describe.
+	auditTable := `
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id UUID PRIMARY KEY,
+		actor VARCHAR(200) NOT NULL,
+		action VARCHAR(30) NOT NULL,
+		target_type VARCHAR(30) NOT NULL,
+		target_id TEXT NOT NULL,
+		before JSONB,
+		after JSONB,
+		changes JSONB,
+		ip INET,
+		request_id VARCHAR(128),
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// Create retired codes table. Codes of purged links stay reserved for a
+	// while so nobody can claim them to capture the old link's traffic.
+	retiredCodesTable := `
+	CREATE TABLE IF NOT EXISTS retired_codes (
+		code VARCHAR(50) PRIMARY KEY,
+		url_id UUID NOT NULL,
+		retired_at TIMESTAMP NOT NULL,
+		reserved_until TIMESTAMP NOT NULL
 	);`
 
+	// Create QR logo table. A logo with no url_id is the workspace logo,
+	// used for every link without its own.
+	qrLogosTable := `
+	CREATE TABLE IF NOT EXISTS qr_logos (
+		id UUID PRIMARY KEY,
+		url_id UUID UNIQUE REFERENCES urls(id) ON DELETE CASCADE,
+		image BYTEA NOT NULL,
+		width INTEGER NOT NULL,
+		height INTEGER NOT NULL,
+		updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// Create analytics rollup tables, maintained by the rollup job. Clicks
+	// are counted per UTC hour and day and per value of each dimension;
+	// missing dimensions are stored as empty strings so they can be part of
+	// the key. Visitors are the distinct visitor IDs seen per UTC day, for
+	// unique click counts. The state table records how far clicks have
+	// been rolled up. Visitor IDs are hashed with a salt that rotates
+	// daily; old salts are deleted so IDs cannot be traced back.
+	rollupTables := []string{`
+	CREATE TABLE IF NOT EXISTS click_rollups_hourly (
+		url_id UUID NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+		bucket TIMESTAMP NOT NULL,
+		revision INTEGER NOT NULL,
+		source VARCHAR(20) NOT NULL,
+		country VARCHAR(100) NOT NULL,
+		device VARCHAR(50) NOT NULL,
+		browser VARCHAR(50) NOT NULL,
+		referrer VARCHAR(255) NOT NULL DEFAULT '',
+		referrer_type VARCHAR(20) NOT NULL DEFAULT '',
+		utm_source VARCHAR(255) NOT NULL DEFAULT '',
+		utm_medium VARCHAR(255) NOT NULL DEFAULT '',
+		utm_campaign VARCHAR(255) NOT NULL DEFAULT '',
+		clicks BIGINT NOT NULL,
+		PRIMARY KEY (url_id, bucket, revision, source, country, device, browser,
+			referrer, referrer_type, utm_source, utm_medium, utm_campaign)
+	);`, `
+	CREATE TABLE IF NOT EXISTS click_rollups_daily (
+		url_id UUID NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+		bucket TIMESTAMP NOT NULL,
+		revision INTEGER NOT NULL,
+		source VARCHAR(20) NOT NULL,
+		country VARCHAR(100) NOT NULL,
+		device VARCHAR(50) NOT NULL,
+		browser VARCHAR(50) NOT NULL,
+		referrer VARCHAR(255) NOT NULL DEFAULT '',
+		referrer_type VARCHAR(20) NOT NULL DEFAULT '',
+		utm_source VARCHAR(255) NOT NULL DEFAULT '',
+		utm_medium VARCHAR(255) NOT NULL DEFAULT '',
+		utm_campaign VARCHAR(255) NOT NULL DEFAULT '',
+		clicks BIGINT NOT NULL,
+		PRIMARY KEY (url_id, bucket, revision, source, country, device, browser,
+			referrer, referrer_type, utm_source, utm_medium, utm_campaign)
+	);`, `
+	CREATE TABLE IF NOT EXISTS click_visitors_daily (
+		url_id UUID NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+		bucket TIMESTAMP NOT NULL,
+		visitor TEXT NOT NULL,
+		PRIMARY KEY (url_id, bucket, visitor)
+	);`, `
+	CREATE TABLE IF NOT EXISTS analytics_rollup_state (
+		name VARCHAR(50) PRIMARY KEY,
+		watermark TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);`, `
+	CREATE TABLE IF NOT EXISTS visitor_salts (
+		day DATE PRIMARY KEY,
+		salt BYTEA NOT NULL
+	);`,
+	}
+
+	// Columns added after the initial schema, so existing databases gain them too
+	columns := []string{
+		// Links disabled automatically (e.g. by URL screening) record why and when
+		"ALTER TABLE urls ADD COLUMN IF NOT EXISTS disabled_reason TEXT;",
+		"ALTER TABLE urls ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMP;",
+		// Last time the destination passed URL screening
+		"ALTER TABLE urls ADD COLUMN IF NOT EXISTS screened_at TIMESTAMP;",
+		// Address the link was created from, so moderators can ban its creator
+		"ALTER TABLE urls ADD COLUMN IF NOT EXISTS creator_ip INET;",
+		// Soft-deleted links stay in the trash until purged
+		"ALTER TABLE urls ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;",
+		// Current revision of the link, and the revision each click went to
+		"ALTER TABLE urls ADD COLUMN IF NOT EXISTS revision INTEGER NOT NULL DEFAULT 1;",
+		"ALTER TABLE clicks ADD COLUMN IF NOT EXISTS revision INTEGER;",
+		// How the visitor reached the link: "link" or a "qr" code scan
+		"ALTER TABLE clicks ADD COLUMN IF NOT EXISTS source VARCHAR(20) NOT NULL DEFAULT 'link';",
+		// Normalized referring domain and its kind, and the campaign's UTM
+		// parameters
+		"ALTER TABLE clicks ADD COLUMN IF NOT EXISTS referrer_domain VARCHAR(255);",
+		"ALTER TABLE clicks ADD COLUMN IF NOT EXISTS referrer_type VARCHAR(20);",
+		"ALTER TABLE clicks ADD COLUMN IF NOT EXISTS utm_source VARCHAR(255);",
+		"ALTER TABLE clicks ADD COLUMN IF NOT EXISTS utm_medium VARCHAR(255);",
+		"ALTER TABLE clicks ADD COLUMN IF NOT EXISTS utm_campaign VARCHAR(255);",
+		// Daily visitor ID counted for unique visitors; the IP address may
+		// be truncated or not stored at all
+		"ALTER TABLE clicks ADD COLUMN IF NOT EXISTS visitor_id VARCHAR(64);",
+		"ALTER TABLE clicks ALTER COLUMN ip_address DROP NOT NULL;",
+	}
+	// Rollups created before referrer analytics gain the referrer and UTM
+	// dimensions, with their rows counted as unknown
+	for _, table := range []string{"click_rollups_hourly", "click_rollups_daily"} {
+		columns = append(columns,
+			"ALTER TABLE "+table+" ADD COLUMN IF NOT EXISTS referrer VARCHAR(255) NOT NULL DEFAULT '';",
+			"ALTER TABLE "+table+" ADD COLUMN IF NOT EXISTS referrer_type VARCHAR(20) NOT NULL DEFAULT '';",
+			"ALTER TABLE "+table+" ADD COLUMN IF NOT EXISTS utm_source VARCHAR(255) NOT NULL DEFAULT '';",
+			"ALTER TABLE "+table+" ADD COLUMN IF NOT EXISTS utm_medium VARCHAR(255) NOT NULL DEFAULT '';",
+			"ALTER TABLE "+table+" ADD COLUMN IF NOT EXISTS utm_campaign VARCHAR(255) NOT NULL DEFAULT '';", `
+	DO $$
+	BEGIN
+		IF (SELECT cardinality(conkey) FROM pg_constraint WHERE conname = '`+table+`_pkey') < 12 THEN
+			ALTER TABLE `+table+` DROP CONSTRAINT `+table+`_pkey,
+				ADD PRIMARY KEY (url_id, bucket, revision, source, country, device, browser,
+					referrer, referrer_type, utm_source, utm_medium, utm_campaign);
+		END IF;
+	END $$;`)
+	}
+
+	// Links created before revisions were tracked get their current state
+	// as their first revision
+	backfills := []string{`
+	INSERT INTO url_revisions (url_id, revision, original_url, title, description, expires_at, created_by, created_at)
+	SELECT id, revision, original_url, title, description, expires_at, 'system:migration', created_at FROM urls
+	ON CONFLICT DO NOTHING;`,
+	}
+
 	// Create indexes
 	indexes := []string{
 		"CREATE INDEX IF NOT EXISTS idx_urls_short_code ON urls(short_code);",
@@ -96,6 +297,27 @@ func CreateTables() error {
 		"CREATE INDEX IF NOT EXISTS idx_clicks_url_id ON clicks(url_id);",
 		"CREATE INDEX IF NOT EXISTS idx_clicks_clicked_at ON clicks(clicked_at);",
 		"CREATE INDEX IF NOT EXISTS idx_urls_created_at ON urls(created_at);",
+		"CREATE INDEX IF NOT EXISTS idx_urls_screened_at ON urls(screened_at NULLS FIRST) WHERE is_active = true;",
+		"CREATE INDEX IF NOT EXISTS idx_urls_creator_ip ON urls(creator_ip);",
+		"CREATE INDEX IF NOT EXISTS idx_abuse_reports_url_id ON abuse_reports(url_id, status);",
+		"CREATE INDEX IF NOT EXISTS idx_abuse_reports_status ON abuse_reports(status, created_at);",
+		// One open report per link and reporter
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_abuse_reports_open_reporter ON abuse_reports(url_id, reporter_ip) WHERE status = 'open';",
+		"CREATE INDEX IF NOT EXISTS idx_moderation_actions_url_id ON moderation_actions(url_id);",
+		"CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at DESC);",
+		"CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log(target_type, target_id, created_at DESC);",
+		"CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log(actor, created_at DESC);",
+		"CREATE INDEX IF NOT EXISTS idx_urls_deleted_at ON urls(deleted_at) WHERE deleted_at IS NOT NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_retired_codes_reserved_until ON retired_codes(reserved_until);",
+		"CREATE INDEX IF NOT EXISTS idx_clicks_url_revision ON clicks(url_id, revision);",
+		// Link analytics read raw clicks by link and time
+		"CREATE INDEX IF NOT EXISTS idx_clicks_url_clicked_at ON clicks(url_id, clicked_at);",
+		// The rollup job replaces rollups by time across all links
+		"CREATE INDEX IF NOT EXISTS idx_click_rollups_hourly_bucket ON click_rollups_hourly(bucket);",
+		"CREATE INDEX IF NOT EXISTS idx_click_rollups_daily_bucket ON click_rollups_daily(bucket);",
+		"CREATE INDEX IF NOT EXISTS idx_click_visitors_daily_bucket ON click_visitors_daily(bucket);",
+		// At most one workspace logo
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_qr_logos_workspace ON qr_logos((url_id IS NULL)) WHERE url_id IS NULL;",
 	}
 
 	// Execute table creation
@@ -107,6 +329,56 @@ func CreateTables() error {
 		return fmt.Errorf("failed to create clicks table: %v", err)
 	}
 
+	if _, err := DB.Exec(revisionsTable); err != nil {
+		return fmt.Errorf("failed to create url revisions table: %v", err)
+	}
+
+	for _, table := range moderationTables {
+		if _, err := DB.Exec(table); err != nil {
+			return fmt.Errorf("failed to create moderation tables: %v", err)
+		}
+	}
+
+	if _, err := DB.Exec(auditTable); err != nil {
+		return fmt.Errorf("failed to create audit log table: %v", err)
+	}
+
+	if _, err := DB.Exec(retiredCodesTable); err != nil {
+		return fmt.Errorf("failed to create retired codes table: %v", err)
+	}
+
+	if _, err := DB.Exec(qrLogosTable); err != nil {
+		return fmt.Errorf("failed to create QR logos table: %v", err)
+	}
+
+	for _, table := range rollupTables {
+		if _, err := DB.Exec(table); err != nil {
+			return fmt.Errorf("failed to create analytics rollup tables: %v", err)
+		}
+	}
+
+	for _, column := range columns {
+		if _, err := DB.Exec(column); err != nil {
+			return fmt.Errorf("failed to add column: %v", err)
+		}
+	}
+
+	if err := partitionClicks(time.Now()); err != nil {
+		return err
+	}
+
+	// The first partitions are needed before any click is recorded; the
+	// partition maintenance job keeps creating them from then on
+	if _, err := EnsureClickPartitions(context.Background(), time.Now(), 1); err != nil {
+		return err
+	}
+
+	for _, backfill := range backfills {
+		if _, err := DB.Exec(backfill); err != nil {
+			return fmt.Errorf("failed to backfill data: %v", err)
+		}
+	}
+
 	// Execute indexes
 	for _, index := range indexes {
 		if _, err := DB.Exec(index); err != nil {
@@ -114,16 +386,33 @@ func CreateTables() error {
 		}
 	}
 
-	log.Println("Database tables created successfully")
+	slog.Info("Database tables created successfully")
 	return nil
 }
 
-// getEnv gets environment variable with fallback
-func getEnv(key, fallback string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// quoteConnValue quotes a libpq connection string value so secrets read
+// from files may contain spaces, quotes or backslashes
+func quoteConnValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+	return "'" + value + "'"
+}
+
+// WithTx runs fn in a transaction, committing if it returns nil and rolling
+// back otherwise
+func WithTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
 	}
-	return fallback
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
 }
 
 // GetDB returns the database instance
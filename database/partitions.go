@@ -0,0 +1,233 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// legacyClicksPartition holds the clicks recorded before the clicks table
+// was partitioned
+const legacyClicksPartition = "clicks_legacy"
+
+// partitionTimeLayout is how partition bounds on clicked_at are written
+const partitionTimeLayout = "2006-01-02 15:04:05"
+
+// ClickPartition is a partition of the clicks table, holding the clicks
+// from From up to but not including To. A zero From or To is unbounded.
+type ClickPartition struct {
+	Name string
+	From time.Time
+	To   time.Time
+	// Default partitions hold clicks no other partition does
+	Default bool
+}
+
+// partitionBoundPattern matches a range partition bound as written by
+// pg_get_expr
+var partitionBoundPattern = regexp.MustCompile(`^FOR VALUES FROM \((.+)\) TO \((.+)\)$`)
+
+// parsePartitionBound reads the bound of a clicks partition
+func parsePartitionBound(name, bound string) (ClickPartition, error) {
+	p := ClickPartition{Name: name}
+	if bound == "DEFAULT" {
+		p.Default = true
+		return p, nil
+	}
+	match := partitionBoundPattern.FindStringSubmatch(bound)
+	if match == nil {
+		return p, fmt.Errorf("unexpected bound %q of partition %s", bound, name)
+	}
+	var err error
+	if p.From, err = parsePartitionTime(match[1], "MINVALUE"); err != nil {
+		return p, fmt.Errorf("unexpected bound %q of partition %s: %v", bound, name, err)
+	}
+	if p.To, err = parsePartitionTime(match[2], "MAXVALUE"); err != nil {
+		return p, fmt.Errorf("unexpected bound %q of partition %s: %v", bound, name, err)
+	}
+	return p, nil
+}
+
+// parsePartitionTime reads a quoted timestamp, or the unbounded value as
+// the zero time
+func parsePartitionTime(value, unbounded string) (time.Time, error) {
+	if value == unbounded {
+		return time.Time{}, nil
+	}
+	return time.Parse("2006-01-02 15:04:05.999999", strings.Trim(value, "'"))
+}
+
+// contains reports whether the partition holds clicks at t
+func (p ClickPartition) contains(t time.Time) bool {
+	return !p.Default && (p.From.IsZero() || !t.Before(p.From)) && (p.To.IsZero() || t.Before(p.To))
+}
+
+// ExpiredClickPartitions returns the partitions holding only clicks before
+// cutoff. The default partition and partitions without an upper bound may
+// receive clicks of any age, so they never expire.
+func ExpiredClickPartitions(partitions []ClickPartition, cutoff time.Time) []ClickPartition {
+	var expired []ClickPartition
+	for _, p := range partitions {
+		if !p.Default && !p.To.IsZero() && !p.To.After(cutoff) {
+			expired = append(expired, p)
+		}
+	}
+	return expired
+}
+
+// ClickPartitionName is the name of the partition holding a month's clicks
+func ClickPartitionName(month time.Time) string {
+	return fmt.Sprintf("clicks_y%04dm%02d", month.Year(), int(month.Month()))
+}
+
+// monthStart returns midnight on the first day of t's month, in UTC
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// missingClickPartitions returns the ranges of the months from now's
+// through ahead months later that no partition holds yet. A month partly
+// held by another partition gets a partition for the rest of it.
+func missingClickPartitions(partitions []ClickPartition, now time.Time, ahead int) []ClickPartition {
+	var missing []ClickPartition
+	for i := 0; i <= ahead; i++ {
+		month := monthStart(now).AddDate(0, i, 0)
+		from, to := month, month.AddDate(0, 1, 0)
+		for _, p := range partitions {
+			if p.contains(from) {
+				from = p.To
+			}
+		}
+		// A zero from means a partition already holds everything after it
+		if from.IsZero() {
+			continue
+		}
+		for _, p := range partitions {
+			if !p.Default && p.From.After(from) && p.From.Before(to) {
+				to = p.From
+			}
+		}
+		if !from.Before(to) {
+			continue
+		}
+		missing = append(missing, ClickPartition{Name: ClickPartitionName(month), From: from, To: to})
+	}
+	return missing
+}
+
+// ClickPartitions lists the partitions of the clicks table
+func ClickPartitions(ctx context.Context) ([]ClickPartition, error) {
+	rows, err := DB.QueryContext(ctx, `
+		SELECT c.relname, pg_get_expr(c.relpartbound, c.oid)
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = 'clicks'::regclass
+		ORDER BY c.relname
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list click partitions: %v", err)
+	}
+	defer rows.Close()
+
+	var partitions []ClickPartition
+	for rows.Next() {
+		var name, bound string
+		if err := rows.Scan(&name, &bound); err != nil {
+			return nil, fmt.Errorf("failed to read click partition: %v", err)
+		}
+		p, err := parsePartitionBound(name, bound)
+		if err != nil {
+			return nil, err
+		}
+		partitions = append(partitions, p)
+	}
+	return partitions, rows.Err()
+}
+
+// EnsureClickPartitions creates the monthly partitions of the clicks table
+// from now's month through ahead months later, so clicks always have a
+// partition to go to. It returns the number of partitions created.
+func EnsureClickPartitions(ctx context.Context, now time.Time, ahead int) (int, error) {
+	partitions, err := ClickPartitions(ctx)
+	if err != nil {
+		return 0, err
+	}
+	missing := missingClickPartitions(partitions, now, ahead)
+	for _, p := range missing {
+		query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s PARTITION OF clicks FOR VALUES FROM ('%s') TO ('%s')",
+			pq.QuoteIdentifier(p.Name), p.From.Format(partitionTimeLayout), p.To.Format(partitionTimeLayout))
+		if _, err := DB.ExecContext(ctx, query); err != nil {
+			return 0, fmt.Errorf("failed to create click partition %s: %v", p.Name, err)
+		}
+		slog.InfoContext(ctx, "Created click partition", "partition", p.Name, "from", p.From, "to", p.To)
+	}
+	return len(missing), nil
+}
+
+// DropClickPartition detaches a partition from the clicks table and drops
+// it, deleting its clicks
+func DropClickPartition(ctx context.Context, name string) error {
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "ALTER TABLE clicks DETACH PARTITION "+pq.QuoteIdentifier(name)); err != nil {
+			return fmt.Errorf("failed to detach click partition %s: %v", name, err)
+		}
+		if _, err := tx.ExecContext(ctx, "DROP TABLE "+pq.QuoteIdentifier(name)); err != nil {
+			return fmt.Errorf("failed to drop click partition %s: %v", name, err)
+		}
+		return nil
+	})
+}
+
+// partitionClicks turns a clicks table created before clicks were
+// partitioned into a partitioned one. The existing table becomes the
+// partition holding every click before next month, which retention drops
+// whole once all of them have expired; newer clicks go to monthly
+// partitions. It does nothing if clicks is already partitioned.
+func partitionClicks(now time.Time) error {
+	var kind string
+	if err := DB.QueryRow("SELECT relkind FROM pg_class WHERE oid = 'clicks'::regclass").Scan(&kind); err != nil {
+		return fmt.Errorf("failed to inspect clicks table: %v", err)
+	}
+	if kind == "p" {
+		return nil
+	}
+
+	bound := monthStart(now).AddDate(0, 1, 0).Format(partitionTimeLayout)
+	statements := []string{
+		"ALTER TABLE clicks RENAME TO " + legacyClicksPartition,
+		// Index names are unique per schema, so the legacy table's give way
+		// to the partitioned table's, which adopt them when created
+		"ALTER TABLE " + legacyClicksPartition + " RENAME CONSTRAINT clicks_pkey TO " + legacyClicksPartition + "_pkey",
+		"ALTER INDEX IF EXISTS idx_clicks_url_id RENAME TO " + legacyClicksPartition + "_url_id_idx",
+		"ALTER INDEX IF EXISTS idx_clicks_clicked_at RENAME TO " + legacyClicksPartition + "_clicked_at_idx",
+		"ALTER INDEX IF EXISTS idx_clicks_url_revision RENAME TO " + legacyClicksPartition + "_url_revision_idx",
+		"ALTER INDEX IF EXISTS idx_clicks_url_clicked_at RENAME TO " + legacyClicksPartition + "_url_clicked_at_idx",
+		// The partition key cannot be null
+		"UPDATE " + legacyClicksPartition + " SET clicked_at = 'epoch' WHERE clicked_at IS NULL",
+		"ALTER TABLE " + legacyClicksPartition + " ALTER COLUMN clicked_at SET NOT NULL",
+		"CREATE TABLE clicks (LIKE " + legacyClicksPartition + " INCLUDING DEFAULTS) PARTITION BY RANGE (clicked_at)",
+		"ALTER TABLE clicks ADD PRIMARY KEY (id, clicked_at)",
+		"ALTER TABLE clicks ADD FOREIGN KEY (url_id) REFERENCES urls(id) ON DELETE CASCADE",
+		"ALTER TABLE clicks ATTACH PARTITION " + legacyClicksPartition + " FOR VALUES FROM (MINVALUE) TO ('" + bound + "')",
+	}
+	err := WithTx(context.Background(), func(tx *sql.Tx) error {
+		for _, statement := range statements {
+			if _, err := tx.Exec(statement); err != nil {
+				return fmt.Errorf("%s: %v", statement, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to partition clicks table: %v", err)
+	}
+	slog.Info("Partitioned clicks table", "legacy_partition", legacyClicksPartition, "until", bound)
+	return nil
+}
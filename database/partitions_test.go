@@ -0,0 +1,70 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func month(year int, m time.Month) time.Time {
+	return time.Date(year, m, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func TestParsePartitionBound(t *testing.T) {
+	p, err := parsePartitionBound("clicks_y2024m05", "FOR VALUES FROM ('2024-05-01 00:00:00') TO ('2024-06-01 00:00:00')")
+	require.NoError(t, err)
+	assert.Equal(t, ClickPartition{Name: "clicks_y2024m05", From: month(2024, 5), To: month(2024, 6)}, p)
+
+	p, err = parsePartitionBound("clicks_legacy", "FOR VALUES FROM (MINVALUE) TO ('2024-06-01 00:00:00')")
+	require.NoError(t, err)
+	assert.True(t, p.From.IsZero())
+	assert.Equal(t, month(2024, 6), p.To)
+
+	p, err = parsePartitionBound("clicks_default", "DEFAULT")
+	require.NoError(t, err)
+	assert.True(t, p.Default)
+
+	_, err = parsePartitionBound("clicks_odd", "FOR VALUES IN ('a')")
+	assert.Error(t, err)
+}
+
+func TestMissingClickPartitions(t *testing.T) {
+	now := time.Date(2024, 5, 20, 12, 0, 0, 0, time.UTC)
+
+	// An empty table needs this month and the months ahead
+	assert.Equal(t, []ClickPartition{
+		{Name: "clicks_y2024m05", From: month(2024, 5), To: month(2024, 6)},
+		{Name: "clicks_y2024m06", From: month(2024, 6), To: month(2024, 7)},
+	}, missingClickPartitions(nil, now, 1))
+
+	// Existing partitions are skipped, including the legacy one ending
+	// after the start of a month
+	partitions := []ClickPartition{
+		{Name: "clicks_legacy", To: time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)},
+		{Name: "clicks_y2024m07", From: month(2024, 7), To: month(2024, 8)},
+		{Name: "clicks_default", Default: true},
+	}
+	assert.Equal(t, []ClickPartition{
+		{Name: "clicks_y2024m05", From: time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC), To: month(2024, 6)},
+		{Name: "clicks_y2024m06", From: month(2024, 6), To: month(2024, 7)},
+		{Name: "clicks_y2024m08", From: month(2024, 8), To: month(2024, 9)},
+	}, missingClickPartitions(partitions, now, 3))
+
+	// An unbounded partition leaves nothing to create
+	assert.Empty(t, missingClickPartitions([]ClickPartition{{Name: "clicks_all"}}, now, 3))
+}
+
+func TestExpiredClickPartitions(t *testing.T) {
+	partitions := []ClickPartition{
+		{Name: "clicks_legacy", To: month(2024, 3)},
+		{Name: "clicks_y2024m03", From: month(2024, 3), To: month(2024, 4)},
+		{Name: "clicks_y2024m04", From: month(2024, 4), To: month(2024, 5)},
+		{Name: "clicks_open", From: month(2024, 5)},
+		{Name: "clicks_default", Default: true},
+	}
+	expired := ExpiredClickPartitions(partitions, month(2024, 4))
+	assert.Equal(t, partitions[:2], expired)
+	assert.Empty(t, ExpiredClickPartitions(partitions, time.Date(2024, 2, 15, 0, 0, 0, 0, time.UTC)))
+}
@@ -0,0 +1,433 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"url-shortener/analytics"
+	"url-shortener/database"
+	"url-shortener/jobs"
+	"url-shortener/models"
+)
+
+const (
+	// defaultTopN is the length of top lists in analytics
+	defaultTopN = 5
+	// maxTopN bounds the length of top lists
+	maxTopN = 100
+)
+
+// analyticsQuery is the report a link analytics request asks for
+type analyticsQuery struct {
+	analytics.Range
+	// top is the length of the top lists
+	top int
+}
+
+// parseAnalyticsQuery reads the report range from ?from, ?to, ?granularity
+// and ?tz, and the length of top lists from ?top
+func parseAnalyticsQuery(c *gin.Context) (analyticsQuery, *apiError) {
+	invalid := func(err error) *apiError {
+		return &apiError{status: http.StatusBadRequest, body: gin.H{"error": err.Error(), "code": "invalid_analytics_query"}}
+	}
+	r, err := analytics.ParseRange(c.Query("from"), c.Query("to"), c.Query("granularity"), c.Query("tz"), time.Now())
+	if err != nil {
+		return analyticsQuery{}, invalid(err)
+	}
+	q := analyticsQuery{Range: r, top: defaultTopN}
+	if value := c.Query("top"); value != "" {
+		top, err := strconv.Atoi(value)
+		if err != nil || top < 1 || top > maxTopN {
+			return analyticsQuery{}, invalid(fmt.Errorf("top must be between 1 and %d", maxTopN))
+		}
+		q.top = top
+	}
+	return q, nil
+}
+
+// rollupWatermark returns the time before which every click is in the
+// rollups, or the zero time if nothing has been rolled up yet
+func rollupWatermark(ctx context.Context) (time.Time, error) {
+	query := "SELECT watermark FROM analytics_rollup_state WHERE name = $1"
+	ctx, span := startDBSpan(ctx, "analytics_rollup_state.get", query)
+	var watermark time.Time
+	err := database.DB.QueryRowContext(ctx, query, jobs.ClickRollup).Scan(&watermark)
+	endSpan(span, err)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	return watermark, err
+}
+
+// rollupTables are the tables holding each rollup
+var rollupTables = map[analytics.Table]string{
+	analytics.Hourly: "click_rollups_hourly",
+	analytics.Daily:  "click_rollups_daily",
+}
+
+// clickRows returns a query for a link's clicks in the segments, one row
+// per raw click or rollup row with the columns at, revision, source,
+// country, device, browser, referrer, referrer_type, utm_source,
+// utm_medium, utm_campaign and clicks. Missing dimensions are empty
+// strings. $1 is the link's ID; the segment bounds are appended to args.
+func clickRows(segments []analytics.Segment, args *[]interface{}) string {
+	parts := make([]string, len(segments))
+	for i, segment := range segments {
+		*args = append(*args, segment.From, segment.To)
+		from, to := len(*args)-1, len(*args)
+		if segment.Table == analytics.Raw {
+			parts[i] = fmt.Sprintf(`
+				SELECT clicked_at AS at, COALESCE(revision, 1) AS revision, source,
+					COALESCE(country, '') AS country, COALESCE(device, '') AS device, COALESCE(browser, '') AS browser,
+					COALESCE(referrer_domain, '') AS referrer, %s AS referrer_type,
+					COALESCE(utm_source, '') AS utm_source, COALESCE(utm_medium, '') AS utm_medium, COALESCE(utm_campaign, '') AS utm_campaign, 1 AS clicks
+				FROM clicks WHERE url_id = $1 AND clicked_at >= $%d AND clicked_at < $%d`, jobs.RawReferrerType, from, to)
+			continue
+		}
+		parts[i] = fmt.Sprintf(`
+				SELECT bucket AS at, revision, source, country, device, browser,
+					referrer, referrer_type, utm_source, utm_medium, utm_campaign, clicks
+				FROM %s WHERE url_id = $1 AND bucket >= $%d AND bucket < $%d`, rollupTables[segment.Table], from, to)
+	}
+	return strings.Join(parts, "\n\t\t\t\tUNION ALL")
+}
+
+// visitorRows returns a query for the visitors of a link in the segments,
+// one row per visitor and day for whole days and per click otherwise, with
+// the columns at and visitor. Visitor IDs rotate daily, so a visitor is
+// counted once per day. $1 is the link's ID; the segment bounds are
+// appended to args.
+func visitorRows(segments []analytics.Segment, args *[]interface{}) string {
+	parts := make([]string, len(segments))
+	for i, segment := range segments {
+		*args = append(*args, segment.From, segment.To)
+		from, to := len(*args)-1, len(*args)
+		if segment.Table == analytics.Daily {
+			parts[i] = fmt.Sprintf(`
+				SELECT bucket AS at, visitor FROM click_visitors_daily WHERE url_id = $1 AND bucket >= $%d AND bucket < $%d`, from, to)
+			continue
+		}
+		parts[i] = fmt.Sprintf(`
+				SELECT clicked_at AS at, %s AS visitor FROM clicks WHERE url_id = $1 AND clicked_at >= $%d AND clicked_at < $%d`, jobs.RawVisitor, from, to)
+	}
+	return strings.Join(parts, "\n\t\t\t\tUNION ALL")
+}
+
+// clickDimensions are what a click is split by in analytics
+type clickDimensions struct {
+	revision     int
+	source       string
+	country      string
+	device       string
+	browser      string
+	referrer     string
+	referrerType string
+	utmSource    string
+	utmMedium    string
+	utmCampaign  string
+}
+
+// clickBreakdown is a link's clicks in a range, split by each dimension
+type clickBreakdown struct {
+	total         int64
+	revisions     map[int]int64
+	sources       map[string]int64
+	countries     map[string]int64
+	devices       map[string]int64
+	browsers      map[string]int64
+	referrers     map[string]int64
+	referrerTypes map[string]int64
+	// referrerType is the type of each referrer in referrers
+	referrerType map[string]string
+	utmSources   map[string]int64
+	utmMediums   map[string]int64
+	utmCampaigns map[string]int64
+}
+
+// newClickBreakdown returns an empty breakdown
+func newClickBreakdown() clickBreakdown {
+	return clickBreakdown{
+		revisions:     make(map[int]int64),
+		sources:       make(map[string]int64),
+		countries:     make(map[string]int64),
+		devices:       make(map[string]int64),
+		browsers:      make(map[string]int64),
+		referrers:     make(map[string]int64),
+		referrerTypes: make(map[string]int64),
+		referrerType:  make(map[string]string),
+		utmSources:    make(map[string]int64),
+		utmMediums:    make(map[string]int64),
+		utmCampaigns:  make(map[string]int64),
+	}
+}
+
+// add counts clicks with the given dimensions; empty dimensions are
+// unknown and left out of their split. Direct visits are counted as the
+// referrer "direct".
+func (b *clickBreakdown) add(d clickDimensions, clicks int64) {
+	b.total += clicks
+	b.revisions[d.revision] += clicks
+	b.sources[d.source] += clicks
+	count := func(counts map[string]int64, value string) {
+		if value != "" {
+			counts[value] += clicks
+		}
+	}
+	count(b.countries, d.country)
+	count(b.devices, d.device)
+	count(b.browsers, d.browser)
+	count(b.referrerTypes, d.referrerType)
+	referrer := d.referrer
+	if d.referrerType == analytics.ReferrerDirect {
+		referrer = analytics.ReferrerDirect
+	}
+	if referrer != "" {
+		b.referrers[referrer] += clicks
+		b.referrerType[referrer] = d.referrerType
+	}
+	count(b.utmSources, d.utmSource)
+	count(b.utmMediums, d.utmMedium)
+	count(b.utmCampaigns, d.utmCampaign)
+}
+
+// loadClickBreakdown counts a link's clicks in the query's range, reading
+// rollups for whole days and hours before watermark
+func loadClickBreakdown(ctx context.Context, urlID string, q analyticsQuery, watermark time.Time) (clickBreakdown, error) {
+	args := []interface{}{urlID}
+	rows := clickRows(analytics.Plan(q.From, q.To, watermark, analytics.Daily), &args)
+	query := `
+		SELECT revision, source, country, device, browser,
+			referrer, referrer_type, utm_source, utm_medium, utm_campaign, SUM(clicks) as clicks
+		FROM (` + rows + `
+		) c
+		GROUP BY revision, source, country, device, browser,
+			referrer, referrer_type, utm_source, utm_medium, utm_campaign
+	`
+	b := newClickBreakdown()
+	ctx, span := startDBSpan(ctx, "clicks.breakdown", query)
+	result, err := database.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		endSpan(span, err)
+		return b, err
+	}
+	defer result.Close()
+	for result.Next() {
+		var d clickDimensions
+		var clicks int64
+		if err := result.Scan(&d.revision, &d.source, &d.country, &d.device, &d.browser,
+			&d.referrer, &d.referrerType, &d.utmSource, &d.utmMedium, &d.utmCampaign, &clicks); err != nil {
+			endSpan(span, err)
+			return b, err
+		}
+		b.add(d, clicks)
+	}
+	endSpan(span, result.Err())
+	return b, result.Err()
+}
+
+// loadVisitorTimeline counts the distinct visitors of a link in every
+// bucket of the query's range, keyed by the bucket's start. Daily visitor
+// rollups are only read if days fall within the range's buckets.
+func loadVisitorTimeline(ctx context.Context, urlID string, q analyticsQuery, watermark time.Time) (map[int64]int64, error) {
+	coarsest := analytics.Raw
+	if q.Coarsest() == analytics.Daily {
+		coarsest = analytics.Daily
+	}
+	args := []interface{}{urlID, string(q.Granularity), q.Location.String()}
+	rows := visitorRows(analytics.Plan(q.From, q.To, watermark, coarsest), &args)
+	query := `
+		SELECT date_trunc($2, at AT TIME ZONE 'UTC' AT TIME ZONE $3) as bucket, COUNT(DISTINCT visitor) as visitors
+		FROM (` + rows + `
+		) v
+		GROUP BY bucket
+	`
+	ctx, span := startDBSpan(ctx, "clicks.visitor_timeline", query)
+	result, err := database.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		endSpan(span, err)
+		return nil, err
+	}
+	defer result.Close()
+
+	visitors := make(map[int64]int64)
+	for result.Next() {
+		var bucket time.Time
+		var count int64
+		if err := result.Scan(&bucket, &count); err != nil {
+			endSpan(span, err)
+			return nil, err
+		}
+		visitors[q.WallClock(bucket).Unix()] += count
+	}
+	endSpan(span, result.Err())
+	return visitors, result.Err()
+}
+
+// loadUniqueClicks counts the distinct visitors of a link in the query's
+// range, reading the daily visitor rollups for whole days before watermark
+func loadUniqueClicks(ctx context.Context, urlID string, q analyticsQuery, watermark time.Time) (int64, error) {
+	args := []interface{}{urlID}
+	rows := visitorRows(analytics.Plan(q.From, q.To, watermark, analytics.Daily), &args)
+	query := `SELECT COUNT(DISTINCT visitor) FROM (` + rows + `
+		) v`
+	ctx, span := startDBSpan(ctx, "clicks.unique_count", query)
+	var unique int64
+	err := database.DB.QueryRowContext(ctx, query, args...).Scan(&unique)
+	endSpan(span, err)
+	return unique, err
+}
+
+// loadClickTimeline returns the link's clicks in every bucket of the
+// query's range, zero where there were none, with the bucket's visitors.
+// Clicks are bucketed in the range's time zone, from the coarsest rollups
+// that fit its buckets.
+func loadClickTimeline(ctx context.Context, urlID string, q analyticsQuery, watermark time.Time, visitors map[int64]int64) ([]models.Timeline, error) {
+	args := []interface{}{urlID, string(q.Granularity), q.Location.String()}
+	rows := clickRows(analytics.Plan(q.From, q.To, watermark, q.Coarsest()), &args)
+	query := `
+		SELECT date_trunc($2, at AT TIME ZONE 'UTC' AT TIME ZONE $3) as bucket, SUM(clicks) as clicks
+		FROM (` + rows + `
+		) c
+		GROUP BY bucket
+	`
+	ctx, span := startDBSpan(ctx, "clicks.timeline", query)
+	result, err := database.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		endSpan(span, err)
+		return nil, err
+	}
+	defer result.Close()
+
+	counts := make(map[int64]int64)
+	for result.Next() {
+		var bucket time.Time
+		var clicks int64
+		if err := result.Scan(&bucket, &clicks); err != nil {
+			endSpan(span, err)
+			return nil, err
+		}
+		counts[q.WallClock(bucket).Unix()] += clicks
+	}
+	endSpan(span, result.Err())
+	if err := result.Err(); err != nil {
+		return nil, err
+	}
+	return timeline(q.Fill(counts), visitors), nil
+}
+
+// loadRevisionClicks lists every revision of a link with its clicks in
+// the breakdown. Clicks recorded before revisions were tracked belong to
+// the first revision, the only one links had then.
+func loadRevisionClicks(ctx context.Context, urlID string, b clickBreakdown) ([]models.RevisionClicks, error) {
+	query := "SELECT revision, original_url FROM url_revisions WHERE url_id = $1 ORDER BY revision"
+	ctx, span := startDBSpan(ctx, "url_revisions.list", query)
+	rows, err := database.DB.QueryContext(ctx, query, urlID)
+	if err != nil {
+		endSpan(span, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []models.RevisionClicks
+	for rows.Next() {
+		var r models.RevisionClicks
+		if err := rows.Scan(&r.Revision, &r.OriginalURL); err != nil {
+			endSpan(span, err)
+			return nil, err
+		}
+		r.Clicks = b.revisions[r.Revision]
+		revisions = append(revisions, r)
+	}
+	endSpan(span, rows.Err())
+	return revisions, rows.Err()
+}
+
+// namedClicks is the click count of one value of a dimension
+type namedClicks struct {
+	name   string
+	clicks int64
+}
+
+// topClicks returns the n values with the most clicks, most clicked first
+// and ties in name order
+func topClicks(counts map[string]int64, n int) []namedClicks {
+	top := make([]namedClicks, 0, len(counts))
+	for name, clicks := range counts {
+		top = append(top, namedClicks{name: name, clicks: clicks})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].clicks != top[j].clicks {
+			return top[i].clicks > top[j].clicks
+		}
+		return top[i].name < top[j].name
+	})
+	if len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
+
+// attributeClick records where a click came from: its normalized referrer
+// and the campaign named by the utm_ parameters of the short URL's query,
+// or failing that of the destination
+func attributeClick(click *models.Click, query url.Values, destination string) {
+	referer := ""
+	if click.Referer != nil {
+		referer = *click.Referer
+	}
+	referrer := analytics.ParseReferrer(referer)
+	click.ReferrerDomain = getStringPtr(referrer.Domain)
+	click.ReferrerType = referrer.Type
+
+	utm := analytics.CampaignUTM(query, destination)
+	click.UTMSource = getStringPtr(utm.Source)
+	click.UTMMedium = getStringPtr(utm.Medium)
+	click.UTMCampaign = getStringPtr(utm.Campaign)
+}
+
+// topReferrers returns the n referrers with the most clicks, with their
+// types
+func topReferrers(b clickBreakdown, n int) []models.ReferrerClicks {
+	var referrers []models.ReferrerClicks
+	for _, r := range topClicks(b.referrers, n) {
+		referrers = append(referrers, models.ReferrerClicks{Referrer: r.name, Type: b.referrerType[r.name], Clicks: r.clicks})
+	}
+	return referrers
+}
+
+// referrerTypes lists the click counts of every referrer type, including
+// those without clicks
+func referrerTypes(counts map[string]int64) []models.ReferrerType {
+	types := make([]models.ReferrerType, len(analytics.ReferrerTypes))
+	for i, t := range analytics.ReferrerTypes {
+		types[i] = models.ReferrerType{Type: t, Clicks: counts[t]}
+	}
+	return types
+}
+
+// topUTM returns the n values of a UTM parameter with the most clicks
+func topUTM(counts map[string]int64, n int) []models.UTMClicks {
+	var values []models.UTMClicks
+	for _, v := range topClicks(counts, n) {
+		values = append(values, models.UTMClicks{Value: v.name, Clicks: v.clicks})
+	}
+	return values
+}
+
+// timeline formats a time series for the API, each bucket labelled with
+// its start in the report's time zone and given its unique visitors
+func timeline(points []analytics.Point, visitors map[int64]int64) []models.Timeline {
+	timeline := make([]models.Timeline, len(points))
+	for i, p := range points {
+		timeline[i] = models.Timeline{Date: p.Start.Format(time.RFC3339), Clicks: p.Clicks, UniqueVisitors: visitors[p.Start.Unix()]}
+	}
+	return timeline
+}
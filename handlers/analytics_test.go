@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"url-shortener/analytics"
+	"url-shortener/models"
+)
+
+func TestParseAnalyticsQuery(t *testing.T) {
+	q, apiErr := parseAnalyticsQuery(testContext("/analytics/1"))
+	require.Nil(t, apiErr)
+	assert.Equal(t, defaultTopN, q.top)
+	assert.Equal(t, analytics.Day, q.Granularity)
+	assert.Equal(t, analytics.DefaultPeriod, q.To.Sub(q.From))
+
+	q, apiErr = parseAnalyticsQuery(testContext("/analytics/1?from=2024-01-01&to=2024-03-31&granularity=week&tz=Asia/Jakarta&top=20"))
+	require.Nil(t, apiErr)
+	assert.Equal(t, 20, q.top)
+	assert.Equal(t, analytics.Week, q.Granularity)
+	assert.Equal(t, "Asia/Jakarta", q.Location.String())
+
+	for _, query := range []string{"top=0", "top=101", "top=five", "granularity=year", "tz=Nowhere", "from=2024-02-01&to=2024-01-01"} {
+		_, apiErr = parseAnalyticsQuery(testContext("/analytics/1?" + query))
+		require.NotNil(t, apiErr, query)
+		assert.Equal(t, "invalid_analytics_query", apiErr.body["code"], query)
+	}
+}
+
+func TestTimeline(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	require.NoError(t, err)
+	points := []analytics.Point{
+		{Start: time.Date(2024, 5, 1, 0, 0, 0, 0, tokyo), Clicks: 3},
+		{Start: time.Date(2024, 5, 2, 0, 0, 0, 0, tokyo)},
+	}
+	assert.Equal(t, []models.Timeline{
+		{Date: "2024-05-01T00:00:00+09:00", Clicks: 3},
+		{Date: "2024-05-02T00:00:00+09:00", Clicks: 0},
+	}, timeline(points, nil))
+
+	visitors := map[int64]int64{points[0].Start.Unix(): 2}
+	assert.Equal(t, int64(2), timeline(points, visitors)[0].UniqueVisitors)
+	assert.Equal(t, int64(0), timeline(points, visitors)[1].UniqueVisitors)
+}
+
+func TestClickRows(t *testing.T) {
+	at := func(hour int) time.Time { return time.Date(2024, 5, 1, hour, 0, 0, 0, time.UTC) }
+	segments := []analytics.Segment{
+		{From: at(0), To: at(1), Table: analytics.Raw},
+		{From: at(1), To: at(2), Table: analytics.Hourly},
+		{From: at(2), To: at(3), Table: analytics.Daily},
+	}
+	args := []interface{}{"url", "day"}
+	query := clickRows(segments, &args)
+	assert.Equal(t, []interface{}{"url", "day", at(0), at(1), at(1), at(2), at(2), at(3)}, args)
+	assert.Contains(t, query, "FROM clicks WHERE url_id = $1 AND clicked_at >= $3 AND clicked_at < $4")
+	assert.Contains(t, query, "FROM click_rollups_hourly WHERE url_id = $1 AND bucket >= $5 AND bucket < $6")
+	assert.Contains(t, query, "FROM click_rollups_daily WHERE url_id = $1 AND bucket >= $7 AND bucket < $8")
+	assert.Equal(t, 2, strings.Count(query, "UNION ALL"))
+
+	args = []interface{}{"url"}
+	query = visitorRows(segments, &args)
+	assert.Len(t, args, 7)
+	assert.Equal(t, 2, strings.Count(query, "FROM clicks WHERE"))
+	assert.Contains(t, query, "FROM click_visitors_daily WHERE url_id = $1 AND bucket >= $6 AND bucket < $7")
+	assert.Contains(t, query, "COALESCE(visitor_id, host(ip_address)) AS visitor")
+}
+
+func TestClickBreakdown(t *testing.T) {
+	b := newClickBreakdown()
+	b.add(clickDimensions{revision: 1, source: models.ClickSourceLink, country: "ID", device: "mobile", referrerType: analytics.ReferrerDirect}, 5)
+	b.add(clickDimensions{revision: 2, source: models.ClickSourceQR, country: "ID", browser: "Safari", referrer: "google.com", referrerType: analytics.ReferrerSearch, utmSource: "newsletter"}, 2)
+	b.add(clickDimensions{revision: 2, source: models.ClickSourceLink, device: "desktop", browser: "Firefox", referrer: "t.co", referrerType: analytics.ReferrerSocial, utmSource: "newsletter", utmCampaign: "launch"}, 2)
+
+	assert.Equal(t, int64(9), b.total)
+	assert.Equal(t, map[int]int64{1: 5, 2: 4}, b.revisions)
+	assert.Equal(t, map[string]int64{models.ClickSourceLink: 7, models.ClickSourceQR: 2}, b.sources)
+	assert.Equal(t, map[string]int64{"ID": 7}, b.countries)
+	assert.Equal(t, []namedClicks{{"Firefox", 2}, {"Safari", 2}}, topClicks(b.browsers, 5))
+	assert.Equal(t, []namedClicks{{"mobile", 5}}, topClicks(b.devices, 1))
+	assert.Empty(t, topClicks(nil, 5))
+
+	assert.Equal(t, []models.ReferrerClicks{
+		{Referrer: "direct", Type: analytics.ReferrerDirect, Clicks: 5},
+		{Referrer: "google.com", Type: analytics.ReferrerSearch, Clicks: 2},
+	}, topReferrers(b, 2))
+	assert.Equal(t, []models.ReferrerType{
+		{Type: analytics.ReferrerDirect, Clicks: 5},
+		{Type: analytics.ReferrerSearch, Clicks: 2},
+		{Type: analytics.ReferrerSocial, Clicks: 2},
+		{Type: analytics.ReferrerEmail, Clicks: 0},
+		{Type: analytics.ReferrerOther, Clicks: 0},
+	}, referrerTypes(b.referrerTypes))
+	assert.Equal(t, []models.UTMClicks{{Value: "newsletter", Clicks: 4}}, topUTM(b.utmSources, 5))
+	assert.Equal(t, []models.UTMClicks{{Value: "launch", Clicks: 2}}, topUTM(b.utmCampaigns, 5))
+	assert.Empty(t, topUTM(b.utmMediums, 5))
+
+	// Clicks rolled up before referrers were tracked have no referrer type
+	b.add(clickDimensions{revision: 1, source: models.ClickSourceLink}, 3)
+	assert.Equal(t, int64(12), b.total)
+	assert.Len(t, b.referrers, 3)
+	assert.Equal(t, int64(9), b.referrerTypes[analytics.ReferrerDirect]+b.referrerTypes[analytics.ReferrerSearch]+b.referrerTypes[analytics.ReferrerSocial])
+}
+
+func TestAttributeClick(t *testing.T) {
+	referer := "https://www.Google.co.uk/search?q=link"
+	click := models.Click{Referer: &referer}
+	attributeClick(&click, url.Values{"utm_source": {"Newsletter"}, "utm_campaign": {"Spring Sale"}}, "https://example.com/?utm_source=site&utm_medium=banner")
+	require.NotNil(t, click.ReferrerDomain)
+	assert.Equal(t, "google.co.uk", *click.ReferrerDomain)
+	assert.Equal(t, analytics.ReferrerSearch, click.ReferrerType)
+	require.NotNil(t, click.UTMSource)
+	assert.Equal(t, "newsletter", *click.UTMSource)
+	assert.Nil(t, click.UTMMedium)
+	require.NotNil(t, click.UTMCampaign)
+	assert.Equal(t, "Spring Sale", *click.UTMCampaign)
+
+	// Without a referrer or utm_ parameters on the short URL, the visit is
+	// direct and attributed to the destination's campaign
+	click = models.Click{}
+	attributeClick(&click, url.Values{}, "https://example.com/?utm_source=site&utm_medium=banner")
+	assert.Nil(t, click.ReferrerDomain)
+	assert.Equal(t, analytics.ReferrerDirect, click.ReferrerType)
+	require.NotNil(t, click.UTMMedium)
+	assert.Equal(t, "banner", *click.UTMMedium)
+	assert.Equal(t, "site", *click.UTMSource)
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"url-shortener/audit"
+	"url-shortener/database"
+	"url-shortener/logging"
+	"url-shortener/middleware"
+	"url-shortener/models"
+)
+
+// recordAudit writes an audit log entry for a mutation made by the current
+// request. Pass db as the mutation's transaction so both commit together.
+func recordAudit(c *gin.Context, db audit.Execer, action, targetType, targetID string, before, after any) error {
+	return audit.Record(c.Request.Context(), db, audit.Entry{
+		Actor:      middleware.RequestActor(c),
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Before:     before,
+		After:      after,
+		IP:         c.ClientIP(),
+		RequestID:  logging.RequestIDFromContext(c.Request.Context()),
+	})
+}
+
+// GetAuditLog lists audit log entries, newest first. Results can be
+// filtered by actor, action, target_type, target_id and a from/to time
+// range (RFC 3339).
+func GetAuditLog(c *gin.Context) {
+	page := getIntQuery(c, "page", 1)
+	limit := getIntQuery(c, "limit", 50)
+	if limit > 500 {
+		limit = 500
+	}
+	offset := (page - 1) * limit
+
+	var conditions []string
+	var args []any
+	for _, filter := range []string{"actor", "action", "target_type", "target_id"} {
+		if value := c.Query(filter); value != "" {
+			args = append(args, value)
+			conditions = append(conditions, fmt.Sprintf("%s = $%d", filter, len(args)))
+		}
+	}
+	for _, bound := range []struct{ param, op string }{{"from", ">="}, {"to", "<"}} {
+		value := c.Query(bound.param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, gin.H{
+				"error":   "Invalid " + bound.param + " format",
+				"details": "Expected ISO 8601 format (e.g., 2024-01-01T12:00:00Z)",
+			})
+			return
+		}
+		args = append(args, t)
+		conditions = append(conditions, fmt.Sprintf("created_at %s $%d", bound.op, len(args)))
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	query := "SELECT COUNT(*) FROM audit_log " + where
+	ctx, span := startDBSpan(c.Request.Context(), "audit_log.count", query)
+	err := database.DB.QueryRowContext(ctx, query, args...).Scan(&total)
+	endSpan(span, err)
+	if err != nil {
+		errorResponse(c, http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	query = fmt.Sprintf(`
+		SELECT id, actor, action, target_type, target_id, before, after, changes, host(ip), request_id, created_at
+		FROM audit_log %s
+		ORDER BY created_at DESC, id
+		LIMIT $%d OFFSET $%d
+	`, where, len(args)+1, len(args)+2)
+	ctx, span = startDBSpan(c.Request.Context(), "audit_log.list", query)
+	rows, err := database.DB.QueryContext(ctx, query, append(args, limit, offset)...)
+	if err != nil {
+		endSpan(span, err)
+		errorResponse(c, http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	entries := []models.AuditLogEntry{}
+	for rows.Next() {
+		var e models.AuditLogEntry
+		var before, after, changes []byte
+		if err := rows.Scan(&e.ID, &e.Actor, &e.Action, &e.TargetType, &e.TargetID, &before, &after, &changes, &e.IP, &e.RequestID, &e.CreatedAt); err != nil {
+			continue
+		}
+		e.Before = rawJSON(before)
+		e.After = rawJSON(after)
+		e.Changes = rawJSON(changes)
+		entries = append(entries, e)
+	}
+	endSpan(span, rows.Err())
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": entries,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+			"pages": (total + limit - 1) / limit,
+		},
+	})
+}
+
+// rawJSON passes a stored JSON column through to the response, keeping SQL
+// NULLs out of it
+func rawJSON(data []byte) json.RawMessage {
+	if len(data) == 0 {
+		return nil
+	}
+	return json.RawMessage(data)
+}
@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"url-shortener/database"
+	"url-shortener/middleware"
+	"url-shortener/models"
+)
+
+// Bulk creation modes. Atomic requests create every link or none; partial
+// requests create the valid links and report the rest.
+const (
+	bulkModeAtomic  = "atomic"
+	bulkModePartial = "partial"
+)
+
+// destinationCheckWorkers bounds how many destinations of a bulk request
+// are checked at once, since checks may resolve hosts
+const destinationCheckWorkers = 8
+
+// CreateShortURLsBulk creates links from a JSON array of create requests.
+// Each item is validated like a single create request, and the response
+// reports the result of every item by its index.
+func CreateShortURLsBulk(c *gin.Context) {
+	mode := c.DefaultQuery("mode", bulkModeAtomic)
+	if mode != bulkModeAtomic && mode != bulkModePartial {
+		errorResponse(c, http.StatusBadRequest, gin.H{"error": "Mode must be atomic or partial"})
+		return
+	}
+
+	var items []map[string]interface{}
+	if err := c.ShouldBindJSON(&items); err != nil {
+		errorResponse(c, http.StatusBadRequest, gin.H{
+			"error":   "Invalid request data",
+			"details": "Expected a JSON array of URLs to create",
+		})
+		return
+	}
+	if len(items) == 0 {
+		errorResponse(c, http.StatusBadRequest, gin.H{"error": "At least one URL is required"})
+		return
+	}
+	if maxItems := appConfig.Bulk.MaxItems; len(items) > maxItems {
+		errorResponse(c, http.StatusRequestEntityTooLarge, gin.H{
+			"error": fmt.Sprintf("At most %d URLs can be created per request", maxItems),
+			"code":  "too_many_items",
+		})
+		return
+	}
+
+	// The rate limiter counted the request once; every further item costs
+	// a token too, so a bulk request buys no more links than single ones
+	if limitErr := middleware.ChargeRateLimit(c, len(items)-1); limitErr != nil {
+		errorResponse(c, http.StatusTooManyRequests, limitErr.Body())
+		return
+	}
+
+	// Banned users and addresses cannot create links
+	if apiErr := checkBanned(c); apiErr != nil {
+		apiErr.write(c)
+		return
+	}
+
+	urls, failures := validateBulkItems(c, items, make(map[string]bool), validateCustomCode)
+	results := make([]models.BulkResult, len(items))
+	failed := 0
+	for i := range results {
+		results[i].Index = i
+		if failures[i] != nil {
+			setBulkError(&results[i], failures[i])
+			failed++
+		}
+	}
+
+	if mode == bulkModeAtomic {
+		if failed > 0 {
+			errorResponse(c, http.StatusUnprocessableEntity, gin.H{
+				"error":   fmt.Sprintf("%d of %d URLs are invalid; none were created", failed, len(items)),
+				"code":    "bulk_validation_failed",
+				"created": 0,
+				"failed":  failed,
+				"results": results,
+			})
+			return
+		}
+
+		failedIndex := -1
+		err := database.WithTx(c.Request.Context(), func(tx *sql.Tx) error {
+			for i, url := range urls {
+				if err := insertURL(c, tx, url); err != nil {
+					failedIndex = i
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			if failedIndex >= 0 && isUniqueViolation(err, customCodeConstraint) {
+				setBulkError(&results[failedIndex], customCodeTakenError())
+				errorResponse(c, http.StatusConflict, gin.H{
+					"error":   "A custom code was claimed by another request; none were created",
+					"code":    "bulk_conflict",
+					"created": 0,
+					"failed":  1,
+					"results": results,
+				})
+				return
+			}
+			slog.ErrorContext(c.Request.Context(), "failed to create URLs in bulk", "count", len(urls), "error", err)
+			errorResponse(c, http.StatusInternalServerError, gin.H{"error": "Failed to create URLs"})
+			return
+		}
+	} else {
+		for i, url := range urls {
+			if url == nil {
+				continue
+			}
+			err := database.WithTx(c.Request.Context(), func(tx *sql.Tx) error {
+				return insertURL(c, tx, url)
+			})
+			if err != nil {
+				if isUniqueViolation(err, customCodeConstraint) {
+					setBulkError(&results[i], customCodeTakenError())
+				} else {
+					slog.ErrorContext(c.Request.Context(), "failed to create URL in bulk", "index", i, "error", err)
+					setBulkError(&results[i], &apiError{status: http.StatusInternalServerError, body: gin.H{"error": "Failed to create URL"}})
+				}
+				urls[i] = nil
+				failed++
+			}
+		}
+	}
+
+	baseURL := getBaseURL(c)
+	for i, url := range urls {
+		if url != nil {
+			response := url.ToResponse(baseURL)
+			results[i].Created = true
+			results[i].Data = &response
+		}
+	}
+	created := len(items) - failed
+	slog.InfoContext(c.Request.Context(), "URLs shortened in bulk", "mode", mode, "created", created, "failed", failed)
+
+	status := http.StatusCreated
+	message := "URLs shortened successfully"
+	switch {
+	case created == 0:
+		status = http.StatusUnprocessableEntity
+		message = "No URLs were created"
+	case failed > 0:
+		status = http.StatusMultiStatus
+		message = fmt.Sprintf("%d of %d URLs shortened", created, len(items))
+	}
+	c.JSON(status, gin.H{
+		"message": message,
+		"created": created,
+		"failed":  failed,
+		"results": results,
+	})
+}
+
+// validateBulkItems applies the create rules to every item. It returns
+// the links to create, or for each invalid item the error it would have
+// got as a single create request. Custom codes are checked with checkCode.
+// seenCodes holds the custom codes already claimed by earlier items and is
+// updated with this batch's codes.
+func validateBulkItems(c *gin.Context, items []map[string]interface{}, seenCodes map[string]bool, checkCode func(string) *apiError) ([]*models.URL, []*apiError) {
+	ctx := c.Request.Context()
+	reqs := make([]models.CreateURLRequest, len(items))
+	failures := make([]*apiError, len(items))
+	for i, item := range items {
+		reqs[i], failures[i] = parseCreateRequest(item, checkCode)
+	}
+
+	// Reject destinations that could be used for SSRF or redirect loops
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, destinationCheckWorkers)
+	for i := range reqs {
+		if failures[i] != nil {
+			continue
+		}
+		wg.Add(1)
+		workers <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			failures[i] = checkDestination(ctx, reqs[i].OriginalURL, c.Request.Host)
+			<-workers
+		}(i)
+	}
+	wg.Wait()
+
+	// Reject destinations known to host phishing or malware
+	screenedAt := screenBulkDestinations(ctx, reqs, failures)
+
+	// Custom codes must be unused and appear only once in the request
+	for i, req := range reqs {
+		if failures[i] != nil || req.CustomCode == nil {
+			continue
+		}
+		if seenCodes[*req.CustomCode] {
+			failures[i] = &apiError{status: http.StatusConflict, body: gin.H{
+				"error": "Custom code is used more than once in this request",
+				"code":  "duplicate_custom_code",
+			}}
+			continue
+		}
+		seenCodes[*req.CustomCode] = true
+		failures[i] = checkCustomCode(ctx, *req.CustomCode)
+	}
+
+	urls := make([]*models.URL, len(items))
+	for i, req := range reqs {
+		if failures[i] == nil {
+			urls[i] = newURLFromRequest(c, req, screenedAt)
+		}
+	}
+	return urls, failures
+}
+
+// screenBulkDestinations screens the destinations of the items that are
+// still valid in one lookup and marks flagged items as failed. Like
+// screenDestination it returns when the destinations passed screening, or
+// nil if they were not screened.
+func screenBulkDestinations(ctx context.Context, reqs []models.CreateURLRequest, failures []*apiError) *time.Time {
+	if urlScreener == nil {
+		return nil
+	}
+
+	var urls []string
+	seen := make(map[string]bool)
+	for i, req := range reqs {
+		if failures[i] == nil && !seen[req.OriginalURL] {
+			seen[req.OriginalURL] = true
+			urls = append(urls, req.OriginalURL)
+		}
+	}
+	if len(urls) == 0 {
+		return nil
+	}
+
+	verdicts, err := urlScreener.CheckAll(ctx, urls)
+	for i, req := range reqs {
+		if failures[i] != nil {
+			continue
+		}
+		if verdict, flagged := verdicts[req.OriginalURL]; flagged {
+			failures[i] = unsafeDestinationError(ctx, req.OriginalURL, verdict)
+		}
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "URL screening incomplete", "urls", len(urls), "error", err)
+		return nil
+	}
+
+	now := time.Now()
+	return &now
+}
+
+// setBulkError records an item's error in its result
+func setBulkError(result *models.BulkResult, apiErr *apiError) {
+	result.Error, _ = apiErr.body["error"].(string)
+	result.Code, _ = apiErr.body["code"].(string)
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"url-shortener/config"
+	"url-shortener/middleware"
+	"url-shortener/ratelimit"
+)
+
+func TestCreateShortURLsBulkValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := config.Default()
+	cfg.Bulk.MaxItems = 2
+	Configure(cfg)
+	t.Cleanup(func() { Configure(config.Default()) })
+
+	router := gin.New()
+	router.POST("/shorten/bulk", CreateShortURLsBulk)
+
+	tests := []struct {
+		name   string
+		query  string
+		body   string
+		status int
+		code   string
+	}{
+		{"not an array", "", `{"original_url": "https://example.com"}`, http.StatusBadRequest, ""},
+		{"empty", "", `[]`, http.StatusBadRequest, ""},
+		{"unknown mode", "?mode=best-effort", `[{"original_url": "https://example.com"}]`, http.StatusBadRequest, ""},
+		{"too many", "", `[{"original_url": "https://a.example"}, {"original_url": "https://b.example"}, {"original_url": "https://c.example"}]`, http.StatusRequestEntityTooLarge, "too_many_items"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "/shorten/bulk"+tt.query, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.status, w.Code)
+			if tt.code != "" {
+				assert.Contains(t, w.Body.String(), `"code":"`+tt.code+`"`)
+			}
+		})
+	}
+}
+
+func TestCreateShortURLsBulkChargesPerItem(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := ratelimit.NewMemoryStore(time.Hour)
+	defer store.Close()
+
+	router := gin.New()
+	router.POST("/shorten/bulk", middleware.RateLimit(store, ratelimit.Policy{
+		Name:       "shorten",
+		Limit:      ratelimit.Limit{Requests: 3, Window: time.Minute},
+		IdentifyBy: []string{"ip"},
+	}), CreateShortURLsBulk)
+
+	send := func(query string, count int) *httptest.ResponseRecorder {
+		items := make([]string, count)
+		for i := range items {
+			items[i] = `{"original_url": "https://example.com"}`
+		}
+		req, _ := http.NewRequest("POST", "/shorten/bulk"+query, strings.NewReader("["+strings.Join(items, ",")+"]"))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// More items than the bucket can ever hold are refused outright
+	w := send("", 4)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Contains(t, w.Body.String(), "rate limit of 3 items")
+	assert.Empty(t, w.Header().Get("Retry-After"))
+
+	// Two rejected requests leave one token, which covers the request but
+	// not its second item
+	send("?mode=best-effort", 1)
+	w = send("", 2)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Contains(t, w.Body.String(), `"policy":"shorten"`)
+	assert.Equal(t, "20", w.Header().Get("Retry-After"))
+}
+
+func TestParseCreateRequest(t *testing.T) {
+	req, apiErr := parseCreateRequest(map[string]interface{}{
+		"original_url": "https://example.com",
+		"custom_code":  "spring-sale",
+		"title":        "",
+		"expires_at":   "2030-01-01T00:00:00Z",
+	}, validateCustomCode)
+	assert.Nil(t, apiErr)
+	assert.Equal(t, "https://example.com", req.OriginalURL)
+	assert.Equal(t, "spring-sale", *req.CustomCode)
+	assert.Nil(t, req.Title, "empty strings are treated as absent")
+	assert.NotNil(t, req.ExpiresAt)
+
+	tests := []struct {
+		body  map[string]interface{}
+		error string
+	}{
+		{map[string]interface{}{}, "Original URL is required"},
+		{map[string]interface{}{"original_url": "example.com"}, "URL must start with http:// or https://"},
+		{map[string]interface{}{"original_url": "https://example.com", "custom_code": "ab"}, "Custom code must be between 3 and 50 characters"},
+		{map[string]interface{}{"original_url": "https://example.com", "custom_code": "a b c"}, "Custom code can only contain letters, numbers, and hyphens"},
+		{map[string]interface{}{"original_url": "https://example.com", "expires_at": "soon"}, "Invalid expires_at format"},
+	}
+	for _, tt := range tests {
+		_, apiErr := parseCreateRequest(tt.body, validateCustomCode)
+		if assert.NotNil(t, apiErr, "body: %v", tt.body) {
+			assert.Equal(t, http.StatusBadRequest, apiErr.status)
+			assert.Equal(t, tt.error, apiErr.body["error"])
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"url-shortener/config"
+	"url-shortener/qr"
+	"url-shortener/screening"
+)
+
+// appConfig holds the settings the handlers depend on
+var appConfig = config.Default()
+
+// destinationPolicy decides which hosts links may point to
+var destinationPolicy = screening.NewDestinationPolicy(appConfig.Destination, appConfig.Server.AppURL)
+
+// inlineQRCodes renders and caches the QR codes embedded in link responses
+var inlineQRCodes = qr.NewInlineCache(appConfig.QR.InlineCacheSize)
+
+// Configure sets the configuration used by the handlers
+func Configure(cfg *config.Config) {
+	appConfig = cfg
+	destinationPolicy = screening.NewDestinationPolicy(cfg.Destination, cfg.Server.AppURL)
+	inlineQRCodes = qr.NewInlineCache(cfg.QR.InlineCacheSize)
+}
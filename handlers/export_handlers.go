@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"url-shortener/database"
+	"url-shortener/models"
+)
+
+// exportFlushInterval is how many links are written between flushes of an
+// export response
+const exportFlushInterval = 500
+
+// exportColumns is the CSV header of an export. The link fields use the
+// same names as the CSV import.
+var exportColumns = []string{
+	"id", "short_code", "custom_code", "short_url", "original_url", "title", "description",
+	"is_active", "expires_at", "click_count", "created_at", "updated_at",
+}
+
+// linkEncoder writes exported links in one format
+type linkEncoder interface {
+	encode(link models.ExportedLink) error
+	close() error
+}
+
+// ExportURLs streams every link with its click count as CSV (the default)
+// or JSON (?format=json). Links are written as they are read from the
+// database, so exports of any size use constant memory.
+func ExportURLs(c *gin.Context) {
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "json" {
+		errorResponse(c, http.StatusBadRequest, gin.H{"error": "Format must be csv or json"})
+		return
+	}
+
+	query := `
+		SELECT id, short_code, custom_code, original_url, title, description, is_active, expires_at, click_count, created_at, updated_at
+		FROM urls
+		WHERE deleted_at IS NULL
+		ORDER BY created_at
+	`
+	ctx, span := startDBSpan(c.Request.Context(), "urls.export", query)
+	rows, err := database.DB.QueryContext(ctx, query)
+	if err != nil {
+		endSpan(span, err)
+		errorResponse(c, http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	filename := fmt.Sprintf("links-%s.%s", time.Now().UTC().Format("20060102"), format)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Header("Cache-Control", "no-store")
+	var encoder linkEncoder
+	if format == "json" {
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		encoder = newJSONLinkEncoder(c.Writer)
+	} else {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		encoder = newCSVLinkEncoder(c.Writer)
+	}
+	c.Status(http.StatusOK)
+
+	baseURL := getBaseURL(c)
+	count := 0
+	for rows.Next() {
+		var link models.ExportedLink
+		if err = rows.Scan(&link.ID, &link.ShortCode, &link.CustomCode, &link.OriginalURL, &link.Title, &link.Description, &link.IsActive, &link.ExpiresAt, &link.ClickCount, &link.CreatedAt, &link.UpdatedAt); err != nil {
+			break
+		}
+		link.ShortURL = baseURL + "/" + link.ShortCode
+		if link.CustomCode != nil {
+			link.ShortURL = baseURL + "/" + *link.CustomCode
+		}
+		if err = encoder.encode(link); err != nil {
+			break
+		}
+		count++
+		if count%exportFlushInterval == 0 {
+			c.Writer.Flush()
+		}
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	if err == nil {
+		err = encoder.close()
+	}
+	endSpan(span, err)
+
+	// The status has been sent, so a failure can only cut the export short
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "export interrupted", "format", format, "exported", count, "error", err)
+		return
+	}
+	slog.InfoContext(c.Request.Context(), "links exported", "format", format, "count", count)
+}
+
+// csvLinkEncoder writes links as CSV rows after a header row
+type csvLinkEncoder struct {
+	w      *csv.Writer
+	header bool
+}
+
+func newCSVLinkEncoder(w io.Writer) *csvLinkEncoder {
+	return &csvLinkEncoder{w: csv.NewWriter(w)}
+}
+
+func (e *csvLinkEncoder) encode(link models.ExportedLink) error {
+	if !e.header {
+		e.header = true
+		if err := e.w.Write(exportColumns); err != nil {
+			return err
+		}
+	}
+	return e.w.Write([]string{
+		link.ID, link.ShortCode, stringValue(link.CustomCode), link.ShortURL, link.OriginalURL,
+		stringValue(link.Title), stringValue(link.Description), strconv.FormatBool(link.IsActive),
+		timeValue(link.ExpiresAt), strconv.FormatInt(link.ClickCount, 10),
+		link.CreatedAt.Format(time.RFC3339), link.UpdatedAt.Format(time.RFC3339),
+	})
+}
+
+func (e *csvLinkEncoder) close() error {
+	if !e.header {
+		e.header = true
+		if err := e.w.Write(exportColumns); err != nil {
+			return err
+		}
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// jsonLinkEncoder writes links as the elements of a JSON array
+type jsonLinkEncoder struct {
+	w     io.Writer
+	count int
+}
+
+func newJSONLinkEncoder(w io.Writer) *jsonLinkEncoder {
+	return &jsonLinkEncoder{w: w}
+}
+
+func (e *jsonLinkEncoder) encode(link models.ExportedLink) error {
+	data, err := json.Marshal(link)
+	if err != nil {
+		return err
+	}
+	prefix := ",\n"
+	if e.count == 0 {
+		prefix = "[\n"
+	}
+	e.count++
+	if _, err := io.WriteString(e.w, prefix); err != nil {
+		return err
+	}
+	_, err = e.w.Write(data)
+	return err
+}
+
+func (e *jsonLinkEncoder) close() error {
+	end := "\n]\n"
+	if e.count == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(e.w, end)
+	return err
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func timeValue(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
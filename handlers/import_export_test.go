@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"url-shortener/config"
+	"url-shortener/middleware"
+	"url-shortener/models"
+	"url-shortener/ratelimit"
+)
+
+func testContext(target string) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest("POST", target, nil)
+	return c
+}
+
+func TestMapImportColumns(t *testing.T) {
+	header := []string{"\ufeffTitle", " Original_URL ", "Notes"}
+
+	columns, err := mapImportColumns(testContext("/import/csv"), header)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"title": 0, "original_url": 1}, columns)
+
+	columns, err = mapImportColumns(testContext("/import/csv?description=notes"), header)
+	require.NoError(t, err)
+	assert.Equal(t, 2, columns["description"])
+
+	_, err = mapImportColumns(testContext("/import/csv?custom_code=slug"), header)
+	assert.ErrorContains(t, err, `no "slug" column for custom_code`)
+
+	_, err = mapImportColumns(testContext("/import/csv"), []string{"url", "title"})
+	assert.ErrorContains(t, err, "for original_url")
+
+	columns, err = mapImportColumns(testContext("/import/csv?original_url=URL"), []string{"url", "title"})
+	require.NoError(t, err)
+	assert.Equal(t, 0, columns["original_url"])
+}
+
+func TestImportURLsCSVRejectsBadFiles(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/import/csv", ImportURLsCSV)
+
+	tests := []struct {
+		contentType string
+		body        string
+		error       string
+	}{
+		{"application/json", `{}`, "Content-Type must be text/csv or multipart/form-data"},
+		{"text/csv", "", "CSV file must start with a header row"},
+		{"text/csv", "url,title\nhttps://example.com,Example\n", "no \"original_url\" column"},
+		{"multipart/form-data; boundary=x", "--x\r\nContent-Disposition: form-data; name=\"other\"\r\n\r\nvalue\r\n--x--\r\n", "must include a \"file\" field"},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("POST", "/import/csv", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", tt.contentType)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, tt.body)
+		assert.Contains(t, w.Body.String(), strings.ReplaceAll(tt.error, `"`, `\"`))
+	}
+}
+
+func TestLinkImporterStopsAtMaxRows(t *testing.T) {
+	cfg := config.Default()
+	cfg.Bulk.MaxImportRows = 2
+	Configure(cfg)
+	t.Cleanup(func() { Configure(config.Default()) })
+
+	importer := newLinkImporter(testContext("/import/csv"), true)
+	assert.True(t, importer.add(2, map[string]interface{}{"original_url": "https://a.example"}))
+	assert.True(t, importer.add(3, map[string]interface{}{"original_url": "https://b.example"}))
+	assert.False(t, importer.add(4, map[string]interface{}{"original_url": "https://c.example"}))
+	assert.False(t, importer.add(5, map[string]interface{}{"original_url": "https://d.example"}))
+
+	assert.Equal(t, 2, importer.report.Rows)
+	assert.Equal(t, "Imports are limited to 2 rows; rows from line 4 on were not imported", importer.report.Aborted)
+}
+
+func TestLinkImporterCountsFailedRowsTowardMaxRows(t *testing.T) {
+	cfg := config.Default()
+	cfg.Bulk.MaxImportRows = 1
+	Configure(cfg)
+	t.Cleanup(func() { Configure(config.Default()) })
+
+	importer := newLinkImporter(testContext("/import/bitly"), true)
+	invalid := &apiError{status: http.StatusBadRequest, body: gin.H{"error": "missing URL", "code": "invalid_row"}}
+	assert.True(t, importer.addFailed(2, invalid))
+	assert.False(t, importer.addFailed(3, invalid))
+	assert.Equal(t, 1, importer.report.Rows)
+	assert.Equal(t, 1, importer.report.Failed)
+	assert.Contains(t, importer.report.Aborted, "rows from line 3 on")
+}
+
+func TestMigrationReportsCodesUsedAsShortCodes(t *testing.T) {
+	cfg := config.Default()
+	cfg.Destination.ResolveHosts = false
+	Configure(cfg)
+	t.Cleanup(func() { Configure(config.Default()) })
+
+	// "abc123" stands in for another link's generated short code
+	lookupCodeStatus = func(ctx context.Context, code string) (string, error) {
+		if code == "abc123" {
+			return codeTaken, nil
+		}
+		return codeAvailable, nil
+	}
+	t.Cleanup(func() { lookupCodeStatus = customCodeStatus })
+
+	importer := newLinkImporter(testContext("/import/bitly?dry_run=true"), true)
+	importer.checkCode = validateImportedCode
+	importer.addImported(2, map[string]interface{}{"original_url": "https://a.example", "custom_code": "abc123"}, importedLink{})
+	importer.addImported(3, map[string]interface{}{"original_url": "https://b.example", "custom_code": "my_link"}, importedLink{})
+	importer.flush()
+
+	assert.Equal(t, 1, importer.report.Valid)
+	assert.Equal(t, 1, importer.report.Conflicts)
+	require.Len(t, importer.report.Errors, 1)
+	assert.Equal(t, models.ImportError{Row: 2, Error: "Custom code already exists", Code: "code_taken"}, importer.report.Errors[0])
+}
+
+func TestValidateImportedCode(t *testing.T) {
+	for _, code := range []string{"ab", "x", "my_link", "Spring-Sale_2024", strings.Repeat("a", 50)} {
+		assert.Nil(t, validateImportedCode(code), code)
+	}
+
+	tests := []struct {
+		code  string
+		error string
+	}{
+		{strings.Repeat("a", 51), "Imported code must be at most 50 characters"},
+		{"a.b", "Imported code can only contain letters, numbers, hyphens and underscores"},
+		{"my link", "Imported code can only contain letters, numbers, hyphens and underscores"},
+		{"api", `Imported code "api" is reserved`},
+		{"Health", `Imported code "Health" is reserved`},
+	}
+	for _, tt := range tests {
+		apiErr := validateImportedCode(tt.code)
+		if assert.NotNil(t, apiErr, tt.code) {
+			assert.Equal(t, http.StatusBadRequest, apiErr.status)
+			assert.Equal(t, tt.error, apiErr.body["error"])
+		}
+	}
+
+	// Migrated rows keep codes the create rule would reject
+	for _, code := range []string{"ab", "my_link"} {
+		item := map[string]interface{}{"original_url": "https://example.com", "custom_code": code}
+		req, apiErr := parseCreateRequest(item, validateImportedCode)
+		assert.Nil(t, apiErr, code)
+		assert.Equal(t, code, *req.CustomCode)
+		_, apiErr = parseCreateRequest(item, validateCustomCode)
+		assert.NotNil(t, apiErr, code)
+	}
+}
+
+func TestLinkImporterStopsWhenRateLimited(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := config.Default()
+	cfg.Destination.ResolveHosts = false
+	Configure(cfg)
+	t.Cleanup(func() { Configure(config.Default()) })
+
+	store := ratelimit.NewMemoryStore(time.Hour)
+	defer store.Close()
+	policy := ratelimit.Policy{Name: "shorten", Limit: ratelimit.Limit{Requests: 2, Window: time.Minute}, IdentifyBy: []string{"ip"}}
+
+	var report models.ImportReport
+	router := gin.New()
+	router.POST("/import/csv", middleware.RateLimit(store, policy), func(c *gin.Context) {
+		importer := newLinkImporter(c, false)
+		// The request's own token already paid for an earlier link
+		importer.creates = 1
+		importer.add(2, map[string]interface{}{"original_url": "https://example.com"})
+		importer.flush()
+		report = importer.report
+	})
+
+	// Spend all but the token the request itself takes
+	_, err := store.Take(context.Background(), "ratelimit:shorten:ip:192.0.2.1", policy.Limit, 1)
+	require.NoError(t, err)
+
+	req, _ := http.NewRequest("POST", "/import/csv", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+	assert.Equal(t, 1, report.Rows)
+	assert.Zero(t, report.Valid)
+	assert.Zero(t, report.Created)
+	assert.Equal(t, "Rate limit exceeded. Please try again later. (rows from line 2 on were not imported)", report.Aborted)
+}
+
+func TestMigrationImportsRejectBadFiles(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/import/bitly", ImportBitly)
+	router.POST("/import/yourls", ImportYOURLS)
+
+	tests := []struct {
+		path        string
+		contentType string
+		body        string
+		error       string
+	}{
+		{"/import/bitly", "application/json", `{}`, "Content-Type must be text/csv or multipart/form-data"},
+		{"/import/bitly", "text/csv", "title,long_url\n", "Bitly export has no link column"},
+		{"/import/yourls", "text/csv", "a,b\n", "Content-Type must be application/sql, application/json or multipart/form-data"},
+		{"/import/yourls", "application/sql", " \n", "YOURLS export is empty"},
+		{"/import/yourls", "application/json", `{"links":`, "invalid JSON"},
+		{"/import/yourls", "application/json", `{"links": 5}`, `\"links\" must be an array or an object`},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", tt.contentType)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, tt.body)
+		assert.Contains(t, w.Body.String(), tt.error)
+	}
+}
+
+func TestLinkEncoders(t *testing.T) {
+	title := `Sale, "50%" off`
+	expiresAt := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	created := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	links := []models.ExportedLink{
+		{ID: "1", ShortCode: "abc123", ShortURL: "https://sho.rt/abc123", OriginalURL: "https://example.com", Title: &title, IsActive: true, ExpiresAt: &expiresAt, ClickCount: 42, CreatedAt: created, UpdatedAt: created},
+		{ID: "2", ShortCode: "def456", ShortURL: "https://sho.rt/def456", OriginalURL: "https://example.org", CreatedAt: created, UpdatedAt: created},
+	}
+
+	var buf bytes.Buffer
+	encoder := newCSVLinkEncoder(&buf)
+	for _, link := range links {
+		require.NoError(t, encoder.encode(link))
+	}
+	require.NoError(t, encoder.close())
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, exportColumns, records[0])
+	assert.Equal(t, []string{"1", "abc123", "", "https://sho.rt/abc123", "https://example.com", title, "", "true",
+		"2030-01-02T03:04:05Z", "42", "2024-05-06T07:08:09Z", "2024-05-06T07:08:09Z"}, records[1])
+
+	buf.Reset()
+	jsonEncoder := newJSONLinkEncoder(&buf)
+	for _, link := range links {
+		require.NoError(t, jsonEncoder.encode(link))
+	}
+	require.NoError(t, jsonEncoder.close())
+	var decoded []models.ExportedLink
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Len(t, decoded, 2)
+	assert.Equal(t, int64(42), decoded[0].ClickCount)
+
+	buf.Reset()
+	require.NoError(t, newJSONLinkEncoder(&buf).close())
+	assert.JSONEq(t, `[]`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, newCSVLinkEncoder(&buf).close())
+	assert.Equal(t, strings.Join(exportColumns, ",")+"\n", buf.String())
+}
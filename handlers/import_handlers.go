@@ -0,0 +1,326 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"url-shortener/database"
+	"url-shortener/middleware"
+	"url-shortener/models"
+)
+
+// importBatchSize is how many imported rows are validated together
+const importBatchSize = 100
+
+// maxImportErrors bounds the row errors listed in an import report
+const maxImportErrors = 1000
+
+// importFields are the link fields CSV columns can be mapped to
+var importFields = []string{"original_url", "custom_code", "title", "description", "expires_at"}
+
+// ImportURLsCSV creates links from a CSV file, sent as the request body
+// (text/csv) or as the "file" field of a multipart form. The file is read
+// row by row, up to the configured row limit.
+//
+// Columns are matched to link fields by header name. By default a column
+// named like the field is used; ?original_url=Long%20URL maps a different
+// header. Each row is validated like a single create request, and with
+// ?dry_run=true nothing is created, so the report shows what would fail.
+func ImportURLsCSV(c *gin.Context) {
+	dryRun := c.Query("dry_run") == "true"
+
+	body, err := importBody(c, "text/csv")
+	if err != nil {
+		errorResponse(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer body.Close()
+
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	header, err := reader.Read()
+	if err != nil {
+		errorResponse(c, http.StatusBadRequest, gin.H{"error": "CSV file must start with a header row"})
+		return
+	}
+	columns, err := mapImportColumns(c, header)
+	if err != nil {
+		errorResponse(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Banned users and addresses cannot create links
+	if apiErr := checkBanned(c); apiErr != nil {
+		apiErr.write(c)
+		return
+	}
+
+	importer := newLinkImporter(c, dryRun)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// A malformed row (e.g. an unterminated quote) leaves the reader
+			// unable to find the next row, so the import stops there
+			importer.report.Aborted = err.Error()
+			break
+		}
+		row, _ := reader.FieldPos(0)
+
+		item := make(map[string]interface{}, len(columns))
+		for field, index := range columns {
+			if index < len(record) {
+				item[field] = strings.TrimSpace(record[index])
+			}
+		}
+		if !importer.add(row, item) {
+			break
+		}
+	}
+	importer.flush()
+
+	slog.InfoContext(c.Request.Context(), "CSV import finished", "dry_run", dryRun,
+		"rows", importer.report.Rows, "created", importer.report.Created, "failed", importer.report.Failed)
+	c.JSON(http.StatusOK, gin.H{"data": importer.report})
+}
+
+// importBody returns the uploaded file, sent as the request body with one
+// of the given media types or as the "file" field of a multipart form
+func importBody(c *gin.Context, mediaTypes ...string) (io.ReadCloser, error) {
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	for _, allowed := range mediaTypes {
+		if mediaType == allowed {
+			return c.Request.Body, nil
+		}
+	}
+	switch mediaType {
+	case "multipart/form-data":
+		// Read the parts as they arrive rather than buffering the form
+		parts, err := c.Request.MultipartReader()
+		if err != nil {
+			return nil, errors.New("Invalid multipart form")
+		}
+		for {
+			part, err := parts.NextPart()
+			if err != nil {
+				return nil, errors.New("Multipart form must include a \"file\" field")
+			}
+			if part.FormName() == "file" {
+				return part, nil
+			}
+			part.Close()
+		}
+	}
+	return nil, fmt.Errorf("Content-Type must be %s or multipart/form-data", strings.Join(mediaTypes, ", "))
+}
+
+// mapImportColumns finds the column index of each link field in the CSV
+// header. original_url is required; other fields are optional unless a
+// column was named for them explicitly.
+func mapImportColumns(c *gin.Context, header []string) (map[string]int, error) {
+	indexes := make(map[string]int, len(header))
+	for i, name := range header {
+		// Spreadsheet exports often start with a byte order mark
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, dup := indexes[name]; !dup {
+			indexes[name] = i
+		}
+	}
+
+	columns := make(map[string]int)
+	for _, field := range importFields {
+		name, explicit := c.GetQuery(field)
+		if !explicit {
+			name = field
+		}
+		index, ok := indexes[strings.ToLower(strings.TrimSpace(name))]
+		switch {
+		case ok:
+			columns[field] = index
+		case explicit || field == "original_url":
+			return nil, fmt.Errorf("CSV header has no %q column for %s", name, field)
+		}
+	}
+	return columns, nil
+}
+
+// linkImporter validates and creates imported links in batches, building
+// the import report. Imports are never atomic: valid rows are created and
+// invalid ones reported. An import stops after the configured number of
+// rows, or once the caller's rate limit is spent, since every created link
+// costs a token.
+type linkImporter struct {
+	c         *gin.Context
+	dryRun    bool
+	report    models.ImportReport
+	seenCodes map[string]bool
+	items     []map[string]interface{}
+	rows      []int
+	links     []importedLink
+	// checkCode applies the format rule for custom codes
+	checkCode func(string) *apiError
+	// creates counts the links the import tried to create; the first is
+	// paid for by the request's own token
+	creates int
+}
+
+func newLinkImporter(c *gin.Context, dryRun bool) *linkImporter {
+	return &linkImporter{
+		c:         c,
+		dryRun:    dryRun,
+		report:    models.ImportReport{DryRun: dryRun, Errors: []models.ImportError{}},
+		seenCodes: make(map[string]bool),
+		checkCode: validateCustomCode,
+	}
+}
+
+// importedLink is a link migrated from another shortener, whose creation
+// date and click total are kept
+type importedLink struct {
+	createdAt *time.Time
+	clicks    int64
+}
+
+// add queues one row, validating and creating the batch when it is full.
+// It returns false, queuing nothing, once the import has stopped.
+func (im *linkImporter) add(row int, item map[string]interface{}) bool {
+	return im.addImported(row, item, importedLink{})
+}
+
+// addImported queues one migrated row
+func (im *linkImporter) addImported(row int, item map[string]interface{}, link importedLink) bool {
+	if !im.count(row) {
+		return false
+	}
+	im.items = append(im.items, item)
+	im.rows = append(im.rows, row)
+	im.links = append(im.links, link)
+	if len(im.items) == importBatchSize {
+		im.flush()
+	}
+	return im.report.Aborted == ""
+}
+
+// addFailed records a row that was rejected before validation, such as one
+// the export reader could not parse
+func (im *linkImporter) addFailed(row int, apiErr *apiError) bool {
+	if !im.count(row) {
+		return false
+	}
+	im.fail(row, apiErr)
+	return true
+}
+
+// count counts a row read from the file, stopping the import instead once
+// it has read the most rows allowed
+func (im *linkImporter) count(row int) bool {
+	if im.report.Aborted != "" {
+		return false
+	}
+	if maxRows := appConfig.Bulk.MaxImportRows; im.report.Rows >= maxRows {
+		im.report.Aborted = fmt.Sprintf("Imports are limited to %d rows; rows from line %d on were not imported", maxRows, row)
+		return false
+	}
+	im.report.Rows++
+	return true
+}
+
+// flush validates and creates the queued rows
+func (im *linkImporter) flush() {
+	if len(im.items) == 0 {
+		return
+	}
+	urls, failures := validateBulkItems(im.c, im.items, im.seenCodes, im.checkCode)
+	for i, url := range urls {
+		if failures[i] != nil {
+			im.fail(im.rows[i], failures[i])
+			continue
+		}
+		if !im.dryRun && !im.charge(im.rows[i]) {
+			break
+		}
+		im.report.Valid++
+		if im.dryRun {
+			continue
+		}
+		if link := im.links[i]; link.createdAt != nil || link.clicks > 0 {
+			if link.createdAt != nil {
+				url.CreatedAt = *link.createdAt
+			}
+			url.ClickCount = link.clicks
+		}
+
+		err := database.WithTx(im.c.Request.Context(), func(tx *sql.Tx) error {
+			return insertURL(im.c, tx, url)
+		})
+		if err != nil {
+			if isUniqueViolation(err, customCodeConstraint) {
+				im.fail(im.rows[i], customCodeTakenError())
+			} else {
+				slog.ErrorContext(im.c.Request.Context(), "failed to create imported URL", "row", im.rows[i], "error", err)
+				im.fail(im.rows[i], &apiError{status: http.StatusInternalServerError, body: gin.H{"error": "Failed to create URL"}})
+			}
+			im.report.Valid--
+			continue
+		}
+		im.report.Created++
+	}
+	im.items = im.items[:0]
+	im.rows = im.rows[:0]
+	im.links = im.links[:0]
+}
+
+// charge pays a rate limit token for a link about to be created. If the
+// caller's budget is spent the import stops at that row.
+func (im *linkImporter) charge(row int) bool {
+	im.creates++
+	if im.creates == 1 {
+		return true
+	}
+	if limitErr := middleware.ChargeRateLimit(im.c, 1); limitErr != nil {
+		im.report.Aborted = fmt.Sprintf("%s (rows from line %d on were not imported)", limitErr.Error(), row)
+		return false
+	}
+	return true
+}
+
+// fail records a rejected row
+func (im *linkImporter) fail(row int, apiErr *apiError) {
+	im.report.Failed++
+	if isCodeConflict(apiErr) {
+		im.report.Conflicts++
+	}
+	if len(im.report.Errors) >= maxImportErrors {
+		im.report.ErrorsTruncated = true
+		return
+	}
+	importErr := models.ImportError{Row: row}
+	importErr.Error, _ = apiErr.body["error"].(string)
+	importErr.Code, _ = apiErr.body["code"].(string)
+	im.report.Errors = append(im.report.Errors, importErr)
+}
+
+// isCodeConflict reports whether a row was rejected because its custom
+// code is already in use
+func isCodeConflict(apiErr *apiError) bool {
+	switch apiErr.body["code"] {
+	case "code_taken", "code_recently_deleted", "duplicate_custom_code":
+		return true
+	}
+	return false
+}
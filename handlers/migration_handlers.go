@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"url-shortener/importers"
+)
+
+// ImportBitly migrates links from a Bitly CSV export, sent as the request
+// body (text/csv) or as the "file" field of a multipart form
+func ImportBitly(c *gin.Context) {
+	body, err := importBody(c, "text/csv")
+	if err != nil {
+		errorResponse(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer body.Close()
+
+	reader, err := importers.NewBitlyReader(body)
+	if err != nil {
+		errorResponse(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	migrateLinks(c, "bitly", reader)
+}
+
+// ImportYOURLS migrates links from a YOURLS SQL dump (application/sql) or
+// JSON export (application/json), sent as the request body or as the
+// "file" field of a multipart form. ?table= names the url table of a dump
+// whose table prefix is not the default.
+func ImportYOURLS(c *gin.Context) {
+	body, err := importBody(c, "application/sql", "application/json")
+	if err != nil {
+		errorResponse(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer body.Close()
+
+	reader, err := importers.NewYOURLSReader(body, c.Query("table"))
+	if err != nil {
+		errorResponse(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	migrateLinks(c, "yourls", reader)
+}
+
+// migrateLinks creates the links read from another shortener's export.
+// Each link keeps its short code as a custom code, along with its title,
+// creation date and click total. Links whose code is already in use are
+// reported as conflicts; with ?preserve_codes=false they get new codes
+// instead. ?dry_run=true validates the export without creating anything.
+// Like CSV imports, migrations stop at the row and rate limits.
+func migrateLinks(c *gin.Context, source string, reader importers.Reader) {
+	dryRun := c.Query("dry_run") == "true"
+	preserveCodes := c.Query("preserve_codes") != "false"
+
+	// Banned users and addresses cannot create links
+	if apiErr := checkBanned(c); apiErr != nil {
+		apiErr.write(c)
+		return
+	}
+
+	importer := newLinkImporter(c, dryRun)
+	importer.checkCode = validateImportedCode
+	for {
+		link, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		var rowErr *importers.RowError
+		if errors.As(err, &rowErr) {
+			if !importer.addFailed(rowErr.Line, &apiError{status: http.StatusBadRequest, body: gin.H{"error": rowErr.Err, "code": "invalid_row"}}) {
+				break
+			}
+			continue
+		}
+		if err != nil {
+			importer.report.Aborted = err.Error()
+			break
+		}
+
+		item := map[string]interface{}{"original_url": link.URL}
+		if link.Title != "" {
+			item["title"] = link.Title
+		}
+		if preserveCodes {
+			item["custom_code"] = link.Code
+		}
+		if !importer.addImported(link.Line, item, importedLink{createdAt: link.CreatedAt, clicks: link.Clicks}) {
+			break
+		}
+	}
+	importer.flush()
+
+	slog.InfoContext(c.Request.Context(), "migration import finished", "source", source, "dry_run", dryRun,
+		"rows", importer.report.Rows, "created", importer.report.Created, "failed", importer.report.Failed,
+		"conflicts", importer.report.Conflicts)
+	c.JSON(http.StatusOK, gin.H{"data": importer.report})
+}
+
+// reservedCodes are paths served by this service at the root, which a
+// short code must not shadow
+var reservedCodes = []string{"api", "health", "static"}
+
+// validateImportedCode applies the format rule for codes kept from another
+// shortener. Those services allow shorter codes and underscores, so any
+// code the redirect route can serve is accepted unless it is reserved.
+func validateImportedCode(code string) *apiError {
+	if len(code) > 50 {
+		return &apiError{status: http.StatusBadRequest, body: gin.H{
+			"error": "Imported code must be at most 50 characters",
+		}}
+	}
+	for _, char := range code {
+		if !((char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9') || char == '-' || char == '_') {
+			return &apiError{status: http.StatusBadRequest, body: gin.H{
+				"error": "Imported code can only contain letters, numbers, hyphens and underscores",
+			}}
+		}
+	}
+	for _, reserved := range reservedCodes {
+		if strings.EqualFold(code, reserved) {
+			return &apiError{status: http.StatusBadRequest, body: gin.H{
+				"error": fmt.Sprintf("Imported code %q is reserved", code),
+				"code":  "reserved_code",
+			}}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,740 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"url-shortener/audit"
+	"url-shortener/database"
+	"url-shortener/middleware"
+	"url-shortener/models"
+)
+
+// maxReportDetailsLength bounds the free-text details of an abuse report
+const maxReportDetailsLength = 2000
+
+// errLinkNotFound is returned by moderation actions on missing links
+var errLinkNotFound = errors.New("link not found")
+
+// errCreatorUnknown is returned when a link has neither a user nor a
+// creator IP to ban
+var errCreatorUnknown = errors.New("link creator unknown")
+
+// errBanNotFound is returned when lifting a ban that does not exist
+var errBanNotFound = errors.New("ban not found")
+
+// ReportURL records a public report that a short link is abusive
+func ReportURL(c *gin.Context) {
+	var req models.CreateReportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorResponse(c, http.StatusBadRequest, gin.H{
+			"error":   "Invalid request data",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if !models.ValidReportReason(req.Reason) {
+		errorResponse(c, http.StatusBadRequest, gin.H{
+			"error": "Reason must be one of phishing, malware, spam, illegal or other",
+		})
+		return
+	}
+	if req.Details != nil && len(*req.Details) > maxReportDetailsLength {
+		errorResponse(c, http.StatusBadRequest, gin.H{"error": "Details are too long"})
+		return
+	}
+
+	shortCode := req.ShortCode
+	if shortCode == "" && req.ShortURL != "" {
+		if u, err := url.Parse(req.ShortURL); err == nil {
+			shortCode = strings.Trim(u.Path, "/")
+		}
+	}
+	if shortCode == "" {
+		errorResponse(c, http.StatusBadRequest, gin.H{"error": "Short code or short URL is required"})
+		return
+	}
+
+	var urlID string
+	query := "SELECT id FROM urls WHERE (short_code = $1 OR custom_code = $1) AND deleted_at IS NULL"
+	ctx, span := startDBSpan(c.Request.Context(), "urls.lookup_for_report", query)
+	err := database.DB.QueryRowContext(ctx, query, shortCode).Scan(&urlID)
+	endSpan(span, err)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			errorResponse(c, http.StatusNotFound, gin.H{"error": "URL not found"})
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "failed to look up reported URL", "error", err)
+		errorResponse(c, http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// A reporter has at most one open report per link; repeats are accepted
+	// but not stored again
+	report := models.AbuseReport{
+		ID:         uuid.New().String(),
+		URLID:      &urlID,
+		ShortCode:  shortCode,
+		Reason:     req.Reason,
+		Details:    req.Details,
+		ReporterIP: c.ClientIP(),
+		Status:     models.ReportStatusOpen,
+		CreatedAt:  time.Now(),
+	}
+	err = database.WithTx(c.Request.Context(), func(tx *sql.Tx) error {
+		query := `
+			INSERT INTO abuse_reports (id, url_id, short_code, reason, details, reporter_ip, status, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT (url_id, reporter_ip) WHERE status = 'open' DO NOTHING
+		`
+		ctx, span := startDBSpan(c.Request.Context(), "abuse_reports.insert", query)
+		result, err := tx.ExecContext(ctx, query, report.ID, report.URLID, report.ShortCode, report.Reason, report.Details, report.ReporterIP, report.Status, report.CreatedAt)
+		endSpan(span, err)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return nil
+		}
+		return recordAudit(c, tx, audit.ActionCreate, audit.TargetReport, report.ID, nil, report)
+	})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "failed to store abuse report", "url_id", urlID, "error", err)
+		errorResponse(c, http.StatusInternalServerError, gin.H{"error": "Failed to store report"})
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "abuse report received", "url_id", urlID, "reason", req.Reason)
+	c.JSON(http.StatusAccepted, gin.H{"message": "Report received. Thank you for helping keep links safe."})
+}
+
+// GetModerationQueue lists reported links with report counts, most
+// reported first. ?status=all includes links without open reports.
+func GetModerationQueue(c *gin.Context) {
+	page := getIntQuery(c, "page", 1)
+	limit := getIntQuery(c, "limit", 20)
+	offset := (page - 1) * limit
+	openOnly := c.DefaultQuery("status", models.ReportStatusOpen) != "all"
+
+	var total int
+	query := `
+		SELECT COUNT(DISTINCT r.url_id) FROM abuse_reports r
+		JOIN urls u ON u.id = r.url_id
+		WHERE u.deleted_at IS NULL AND (r.status = 'open' OR NOT $1)
+	`
+	ctx, span := startDBSpan(c.Request.Context(), "abuse_reports.count_queue", query)
+	err := database.DB.QueryRowContext(ctx, query, openOnly).Scan(&total)
+	endSpan(span, err)
+	if err != nil {
+		errorResponse(c, http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	query = `
+		SELECT u.id, COALESCE(u.custom_code, u.short_code), u.original_url, u.is_active,
+			COUNT(*) FILTER (WHERE r.status = 'open') AS open_reports, COUNT(*),
+			MIN(r.created_at), MAX(r.created_at)
+		FROM abuse_reports r
+		JOIN urls u ON u.id = r.url_id
+		WHERE u.deleted_at IS NULL
+		GROUP BY u.id
+		HAVING COUNT(*) FILTER (WHERE r.status = 'open') > 0 OR NOT $1
+		ORDER BY open_reports DESC, MAX(r.created_at) DESC
+		LIMIT $2 OFFSET $3
+	`
+	ctx, span = startDBSpan(c.Request.Context(), "abuse_reports.queue", query)
+	rows, err := database.DB.QueryContext(ctx, query, openOnly, limit, offset)
+	if err != nil {
+		endSpan(span, err)
+		errorResponse(c, http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	items := []models.ModerationQueueItem{}
+	index := make(map[string]int)
+	var urlIDs []string
+	for rows.Next() {
+		var item models.ModerationQueueItem
+		if err := rows.Scan(&item.URLID, &item.ShortCode, &item.OriginalURL, &item.IsActive, &item.OpenReports, &item.TotalReports, &item.FirstReportedAt, &item.LastReportedAt); err != nil {
+			continue
+		}
+		item.Reasons = make(map[string]int64)
+		index[item.URLID] = len(items)
+		urlIDs = append(urlIDs, item.URLID)
+		items = append(items, item)
+	}
+	endSpan(span, rows.Err())
+
+	if len(urlIDs) > 0 {
+		query = `
+			SELECT url_id, reason, COUNT(*) FROM abuse_reports
+			WHERE url_id = ANY($1) AND (status = 'open' OR NOT $2)
+			GROUP BY url_id, reason
+		`
+		ctx, span = startDBSpan(c.Request.Context(), "abuse_reports.queue_reasons", query)
+		reasonRows, err := database.DB.QueryContext(ctx, query, pq.Array(urlIDs), openOnly)
+		if err == nil {
+			for reasonRows.Next() {
+				var urlID, reason string
+				var count int64
+				if err := reasonRows.Scan(&urlID, &reason, &count); err == nil {
+					items[index[urlID]].Reasons[reason] = count
+				}
+			}
+			err = reasonRows.Err()
+			reasonRows.Close()
+		}
+		endSpan(span, err)
+		if err != nil {
+			errorResponse(c, http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": items,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+			"pages": (total + limit - 1) / limit,
+		},
+	})
+}
+
+// GetURLReports lists the individual reports for a link, newest first
+func GetURLReports(c *gin.Context) {
+	id := c.Param("id")
+	if _, err := uuid.Parse(id); err != nil {
+		errorResponse(c, http.StatusNotFound, gin.H{"error": "URL not found"})
+		return
+	}
+
+	query := `
+		SELECT id, url_id, short_code, reason, details, host(reporter_ip), status, resolved_action, resolved_at, created_at
+		FROM abuse_reports WHERE url_id = $1
+		ORDER BY created_at DESC
+	`
+	ctx, span := startDBSpan(c.Request.Context(), "abuse_reports.list", query)
+	rows, err := database.DB.QueryContext(ctx, query, id)
+	if err != nil {
+		endSpan(span, err)
+		errorResponse(c, http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	reports := []models.AbuseReport{}
+	for rows.Next() {
+		var r models.AbuseReport
+		if err := rows.Scan(&r.ID, &r.URLID, &r.ShortCode, &r.Reason, &r.Details, &r.ReporterIP, &r.Status, &r.ResolvedAction, &r.ResolvedAt, &r.CreatedAt); err != nil {
+			continue
+		}
+		reports = append(reports, r)
+	}
+	endSpan(span, rows.Err())
+
+	c.JSON(http.StatusOK, gin.H{"data": reports})
+}
+
+// DisableURL disables a link so it serves the "link disabled" page, and
+// resolves its open reports
+func DisableURL(c *gin.Context) {
+	id := c.Param("id")
+	reason := moderationReason(c)
+	actor := middleware.RequestActor(c)
+
+	err := database.WithTx(c.Request.Context(), func(tx *sql.Tx) error {
+		link, err := lockURL(c.Request.Context(), tx, id)
+		if err != nil {
+			return err
+		}
+		if err := disableURLs(c.Request.Context(), tx, []string{id}, moderationDisabledReason(reason)); err != nil {
+			return err
+		}
+		if err := resolveReports(c.Request.Context(), tx, []string{id}, models.ReportStatusActioned, models.ModerationDisable); err != nil {
+			return err
+		}
+		disabled, err := lockURL(c.Request.Context(), tx, id)
+		if err != nil {
+			return err
+		}
+		if err := recordAudit(c, tx, audit.ActionDeactivate, audit.TargetURL, id, link, disabled); err != nil {
+			return err
+		}
+		return recordModerationAction(c.Request.Context(), tx, &id, models.ModerationDisable, reason, actor, gin.H{
+			"short_code":   link.Code(),
+			"original_url": link.OriginalURL,
+		})
+	})
+	if !moderationSucceeded(c, err, "disable") {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "URL disabled"})
+}
+
+// ModerationDeleteURL disables a reported link and moves it to the trash,
+// from which it is purged after the retention window. Its reports and the
+// action are kept for auditing.
+func ModerationDeleteURL(c *gin.Context) {
+	id := c.Param("id")
+	reason := moderationReason(c)
+	actor := middleware.RequestActor(c)
+
+	err := database.WithTx(c.Request.Context(), func(tx *sql.Tx) error {
+		link, err := lockURL(c.Request.Context(), tx, id)
+		if err != nil {
+			return err
+		}
+		if err := resolveReports(c.Request.Context(), tx, []string{id}, models.ReportStatusActioned, models.ModerationDelete); err != nil {
+			return err
+		}
+		if err := recordModerationAction(c.Request.Context(), tx, &id, models.ModerationDelete, reason, actor, gin.H{
+			"short_code":   link.Code(),
+			"original_url": link.OriginalURL,
+		}); err != nil {
+			return err
+		}
+		// Disable the link too, so restoring it from the trash does not
+		// bring it back into service
+		if err := disableURLs(c.Request.Context(), tx, []string{id}, moderationDisabledReason(reason)); err != nil {
+			return err
+		}
+		disabled, err := lockURL(c.Request.Context(), tx, id)
+		if err != nil {
+			return err
+		}
+		deleted, err := softDeleteURL(c.Request.Context(), tx, disabled)
+		if err != nil {
+			return err
+		}
+		return recordAudit(c, tx, audit.ActionDelete, audit.TargetURL, id, link, deleted)
+	})
+	if !moderationSucceeded(c, err, "delete") {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "URL deleted"})
+}
+
+// BanCreator bans the creator of a link (by user ID when known, otherwise
+// by the IP address it was created from) and disables all of their links
+func BanCreator(c *gin.Context) {
+	id := c.Param("id")
+	reason := moderationReason(c)
+	actor := middleware.RequestActor(c)
+
+	var ban models.Ban
+	var disabled []string
+	err := database.WithTx(c.Request.Context(), func(tx *sql.Tx) error {
+		link, err := lockURL(c.Request.Context(), tx, id)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case link.UserID != nil:
+			ban.Kind, ban.Value = models.BanKindUser, *link.UserID
+		case link.CreatorIP != nil:
+			ban.Kind, ban.Value = models.BanKindIP, *link.CreatorIP
+		default:
+			return errCreatorUnknown
+		}
+		if err := insertBan(c.Request.Context(), tx, &ban, reason, actor); err != nil {
+			return err
+		}
+		if err := recordAudit(c, tx, audit.ActionBan, audit.TargetBan, ban.ID, nil, ban); err != nil {
+			return err
+		}
+
+		column := "user_id"
+		if ban.Kind == models.BanKindIP {
+			column = "creator_ip"
+		}
+		rows, err := tx.QueryContext(c.Request.Context(), "SELECT id FROM urls WHERE "+column+" = $1 AND is_active = true AND deleted_at IS NULL", ban.Value)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var linkID string
+			if err := rows.Scan(&linkID); err != nil {
+				rows.Close()
+				return err
+			}
+			disabled = append(disabled, linkID)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		before := make([]models.URL, 0, len(disabled))
+		for _, linkID := range disabled {
+			snapshot, err := lockURL(c.Request.Context(), tx, linkID)
+			if err != nil {
+				return err
+			}
+			before = append(before, snapshot)
+		}
+		if err := disableURLs(c.Request.Context(), tx, disabled, moderationDisabledReason("creator banned")); err != nil {
+			return err
+		}
+		for _, snapshot := range before {
+			after, err := lockURL(c.Request.Context(), tx, snapshot.ID)
+			if err != nil {
+				return err
+			}
+			if err := recordAudit(c, tx, audit.ActionDeactivate, audit.TargetURL, snapshot.ID, snapshot, after); err != nil {
+				return err
+			}
+		}
+		if err := resolveReports(c.Request.Context(), tx, append(disabled, id), models.ReportStatusActioned, models.ModerationBanCreator); err != nil {
+			return err
+		}
+		return recordModerationAction(c.Request.Context(), tx, &id, models.ModerationBanCreator, reason, actor, gin.H{
+			"ban_id":         ban.ID,
+			"kind":           ban.Kind,
+			"value":          ban.Value,
+			"disabled_links": disabled,
+		})
+	})
+	if errors.Is(err, errCreatorUnknown) {
+		errorResponse(c, http.StatusConflict, gin.H{"error": "The creator of this link is unknown"})
+		return
+	}
+	if !moderationSucceeded(c, err, "ban creator") {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Creator banned",
+		"ban":            ban,
+		"disabled_links": len(disabled),
+	})
+}
+
+// DismissReports closes a link's open reports without acting on the link
+func DismissReports(c *gin.Context) {
+	id := c.Param("id")
+	reason := moderationReason(c)
+	actor := middleware.RequestActor(c)
+
+	err := database.WithTx(c.Request.Context(), func(tx *sql.Tx) error {
+		if _, err := lockURL(c.Request.Context(), tx, id); err != nil {
+			return err
+		}
+		if err := resolveReports(c.Request.Context(), tx, []string{id}, models.ReportStatusDismissed, models.ModerationDismiss); err != nil {
+			return err
+		}
+		if err := recordAudit(c, tx, audit.ActionDismiss, audit.TargetURL, id, nil, nil); err != nil {
+			return err
+		}
+		return recordModerationAction(c.Request.Context(), tx, &id, models.ModerationDismiss, reason, actor, nil)
+	})
+	if !moderationSucceeded(c, err, "dismiss reports") {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Reports dismissed"})
+}
+
+// CreateBan bans an IP address from creating links
+func CreateBan(c *gin.Context) {
+	var req models.BanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorResponse(c, http.StatusBadRequest, gin.H{
+			"error":   "Invalid request data",
+			"details": err.Error(),
+		})
+		return
+	}
+	ip := net.ParseIP(strings.TrimSpace(req.IP))
+	if ip == nil {
+		errorResponse(c, http.StatusBadRequest, gin.H{"error": "IP must be a valid IPv4 or IPv6 address"})
+		return
+	}
+	actor := middleware.RequestActor(c)
+
+	ban := models.Ban{Kind: models.BanKindIP, Value: ip.String()}
+	err := database.WithTx(c.Request.Context(), func(tx *sql.Tx) error {
+		if err := insertBan(c.Request.Context(), tx, &ban, req.Reason, actor); err != nil {
+			return err
+		}
+		if err := recordAudit(c, tx, audit.ActionBan, audit.TargetBan, ban.ID, nil, ban); err != nil {
+			return err
+		}
+		return recordModerationAction(c.Request.Context(), tx, nil, models.ModerationBanIP, req.Reason, actor, gin.H{
+			"ban_id": ban.ID,
+			"value":  ban.Value,
+		})
+	})
+	if !moderationSucceeded(c, err, "ban IP") {
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "IP banned", "data": ban})
+}
+
+// GetBans lists active bans, newest first
+func GetBans(c *gin.Context) {
+	query := "SELECT id, kind, value, reason, created_by, created_at FROM bans ORDER BY created_at DESC"
+	ctx, span := startDBSpan(c.Request.Context(), "bans.list", query)
+	rows, err := database.DB.QueryContext(ctx, query)
+	if err != nil {
+		endSpan(span, err)
+		errorResponse(c, http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	bans := []models.Ban{}
+	for rows.Next() {
+		var b models.Ban
+		if err := rows.Scan(&b.ID, &b.Kind, &b.Value, &b.Reason, &b.CreatedBy, &b.CreatedAt); err != nil {
+			continue
+		}
+		bans = append(bans, b)
+	}
+	endSpan(span, rows.Err())
+
+	c.JSON(http.StatusOK, gin.H{"data": bans})
+}
+
+// DeleteBan lifts a ban
+func DeleteBan(c *gin.Context) {
+	id := c.Param("id")
+
+	err := database.WithTx(c.Request.Context(), func(tx *sql.Tx) error {
+		if _, err := uuid.Parse(id); err != nil {
+			return errBanNotFound
+		}
+		var ban models.Ban
+		query := "DELETE FROM bans WHERE id = $1 RETURNING id, kind, value, reason, created_by, created_at"
+		ctx, span := startDBSpan(c.Request.Context(), "bans.delete", query)
+		err := tx.QueryRowContext(ctx, query, id).Scan(&ban.ID, &ban.Kind, &ban.Value, &ban.Reason, &ban.CreatedBy, &ban.CreatedAt)
+		endSpan(span, err)
+		if err == sql.ErrNoRows {
+			return errBanNotFound
+		}
+		if err != nil {
+			return err
+		}
+		return recordAudit(c, tx, audit.ActionUnban, audit.TargetBan, ban.ID, ban, nil)
+	})
+	if errors.Is(err, errBanNotFound) {
+		errorResponse(c, http.StatusNotFound, gin.H{"error": "Ban not found"})
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "failed to lift ban", "ban_id", id, "error", err)
+		errorResponse(c, http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Ban lifted"})
+}
+
+// GetModerationActions lists moderation actions, newest first, optionally
+// filtered by ?url_id=
+func GetModerationActions(c *gin.Context) {
+	page := getIntQuery(c, "page", 1)
+	limit := getIntQuery(c, "limit", 50)
+	offset := (page - 1) * limit
+	urlID := c.Query("url_id")
+
+	query := `
+		SELECT id, url_id, action, reason, actor, details, created_at
+		FROM moderation_actions
+		WHERE $1 = '' OR url_id::text = $1
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3
+	`
+	ctx, span := startDBSpan(c.Request.Context(), "moderation_actions.list", query)
+	rows, err := database.DB.QueryContext(ctx, query, urlID, limit, offset)
+	if err != nil {
+		endSpan(span, err)
+		errorResponse(c, http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	actions := []models.ModerationAction{}
+	for rows.Next() {
+		var a models.ModerationAction
+		var details []byte
+		if err := rows.Scan(&a.ID, &a.URLID, &a.Action, &a.Reason, &a.Actor, &details, &a.CreatedAt); err != nil {
+			continue
+		}
+		if len(details) > 0 {
+			a.Details = json.RawMessage(details)
+		}
+		actions = append(actions, a)
+	}
+	endSpan(span, rows.Err())
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": actions,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+		},
+	})
+}
+
+// isBanned reports whether the user or IP address is banned from creating
+// links
+func isBanned(ctx context.Context, userID, ip string) (bool, error) {
+	var banned bool
+	query := `
+		SELECT EXISTS(
+			SELECT 1 FROM bans
+			WHERE (kind = 'ip' AND value = $1) OR (kind = 'user' AND value = $2 AND $2 <> '')
+		)
+	`
+	ctx, span := startDBSpan(ctx, "bans.check", query)
+	err := database.DB.QueryRowContext(ctx, query, ip, userID).Scan(&banned)
+	endSpan(span, err)
+	return banned, err
+}
+
+// renderLinkDisabled serves the "link disabled" page, or a JSON error to
+// API clients
+func renderLinkDisabled(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	if c.NegotiateFormat(gin.MIMEHTML, gin.MIMEJSON) == gin.MIMEJSON {
+		errorResponse(c, http.StatusGone, gin.H{
+			"error": "This link has been disabled",
+			"code":  "link_disabled",
+		})
+		return
+	}
+
+	c.Status(http.StatusGone)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	if err := linkDisabledPage.Execute(c.Writer, nil); err != nil {
+		slog.ErrorContext(c.Request.Context(), "failed to render link disabled page", "error", err)
+	}
+}
+
+// linkDisabledPage is shown instead of redirecting for disabled links
+var linkDisabledPage = template.Must(template.New("disabled").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Link disabled</title>
+<style>
+body { font-family: system-ui, sans-serif; background: #f9fafb; color: #111827; display: flex; align-items: center; justify-content: center; min-height: 100vh; margin: 0; }
+main { max-width: 28rem; padding: 2rem; text-align: center; }
+h1 { font-size: 1.5rem; }
+p { color: #4b5563; line-height: 1.5; }
+</style>
+</head>
+<body>
+<main>
+<h1>This link has been disabled</h1>
+<p>The link you followed was disabled because it was reported or detected as harmful, or it violates our terms of use.</p>
+</main>
+</body>
+</html>
+`))
+
+// disableURLs deactivates links, recording why
+func disableURLs(ctx context.Context, tx *sql.Tx, ids []string, reason string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	now := time.Now()
+	_, err := tx.ExecContext(ctx, `
+		UPDATE urls SET is_active = false, disabled_reason = $1, disabled_at = $2, updated_at = $2
+		WHERE id = ANY($3)
+	`, reason, now, pq.Array(ids))
+	return err
+}
+
+// resolveReports closes the open reports of the given links
+func resolveReports(ctx context.Context, tx *sql.Tx, urlIDs []string, status, action string) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE abuse_reports SET status = $1, resolved_action = $2, resolved_at = $3
+		WHERE url_id = ANY($4) AND status = 'open'
+	`, status, action, time.Now(), pq.Array(urlIDs))
+	return err
+}
+
+// recordModerationAction stores an action for auditing
+func recordModerationAction(ctx context.Context, tx *sql.Tx, urlID *string, action, reason, actor string, details gin.H) error {
+	var detailsJSON []byte
+	if details != nil {
+		var err error
+		if detailsJSON, err = json.Marshal(details); err != nil {
+			return err
+		}
+	}
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO moderation_actions (id, url_id, action, reason, actor, details, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, uuid.New().String(), urlID, action, getStringPtr(reason), actor, detailsJSON, time.Now())
+	return err
+}
+
+// insertBan stores a ban, or loads the existing one for the same identity
+func insertBan(ctx context.Context, tx *sql.Tx, ban *models.Ban, reason, actor string) error {
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO bans (id, kind, value, reason, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (kind, value) DO UPDATE SET kind = EXCLUDED.kind
+		RETURNING id, reason, created_by, created_at
+	`, uuid.New().String(), ban.Kind, ban.Value, getStringPtr(reason), actor, time.Now()).Scan(&ban.ID, &ban.Reason, &ban.CreatedBy, &ban.CreatedAt)
+	return err
+}
+
+// moderationReason reads the optional reason from the request body
+func moderationReason(c *gin.Context) string {
+	var req models.ModerationRequest
+	if c.Request.ContentLength != 0 {
+		c.ShouldBindJSON(&req)
+	}
+	return strings.TrimSpace(req.Reason)
+}
+
+// moderationDisabledReason builds the disabled_reason stored on links
+// disabled by moderators
+func moderationDisabledReason(reason string) string {
+	if reason == "" {
+		return "moderation"
+	}
+	return "moderation: " + reason
+}
+
+// moderationSucceeded writes the error response for a failed moderation
+// action and reports whether it succeeded
+func moderationSucceeded(c *gin.Context, err error, action string) bool {
+	if err == nil {
+		slog.InfoContext(c.Request.Context(), "moderation action applied", "action", action, "url_id", c.Param("id"), "actor", middleware.RequestActor(c))
+		return true
+	}
+	if errors.Is(err, errLinkNotFound) {
+		errorResponse(c, http.StatusNotFound, gin.H{"error": "URL not found"})
+		return false
+	}
+	slog.ErrorContext(c.Request.Context(), "moderation action failed", "action", action, "url_id", c.Param("id"), "error", err)
+	errorResponse(c, http.StatusInternalServerError, gin.H{"error": "Database error"})
+	return false
+}
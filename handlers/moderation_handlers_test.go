@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderLinkDisabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/:shortCode", renderLinkDisabled)
+
+	req, _ := http.NewRequest("GET", "/abc123", nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusGone, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	assert.Contains(t, w.Body.String(), "This link has been disabled")
+
+	req, _ = http.NewRequest("GET", "/abc123", nil)
+	req.Header.Set("Accept", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusGone, w.Code)
+	assert.JSONEq(t, `{"error":"This link has been disabled","code":"link_disabled"}`, w.Body.String())
+}
+
+func TestReportURLValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/reports", ReportURL)
+
+	tests := []struct {
+		body  string
+		error string
+	}{
+		{`{"short_code":"abc123"}`, "Invalid request data"},
+		{`{"short_code":"abc123","reason":"boring"}`, "Reason must be one of"},
+		{`{"reason":"spam"}`, "Short code or short URL is required"},
+		{`{"short_url":"https://sho.rt/","reason":"spam"}`, "Short code or short URL is required"},
+		{`{"short_code":"abc123","reason":"spam","details":"` + strings.Repeat("x", maxReportDetailsLength+1) + `"}`, "Details are too long"},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("POST", "/reports", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, tt.body)
+		assert.Contains(t, w.Body.String(), tt.error, tt.body)
+	}
+}
+
+func TestGetURLReportsRejectsMalformedID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/urls/:id/reports", GetURLReports)
+
+	// Malformed IDs are answered like the other moderation endpoints,
+	// without reaching the database
+	req, _ := http.NewRequest("GET", "/urls/not-a-uuid/reports", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"error":"URL not found"}`, w.Body.String())
+}
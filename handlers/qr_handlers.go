@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image/color"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"url-shortener/database"
+	"url-shortener/models"
+	"url-shortener/qr"
+)
+
+// qrRenderVersion changes when QR rendering changes, so cached images
+// are not reused across versions
+const qrRenderVersion = "1"
+
+// unsafeFilenameChars are the characters replaced in download filenames
+var unsafeFilenameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// GetURLQRCode serves the QR code of a link by ID, whether or not it is
+// active
+func GetURLQRCode(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		errorResponse(c, http.StatusBadRequest, gin.H{"error": "URL ID is required"})
+		return
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		errorResponse(c, http.StatusNotFound, gin.H{"error": "URL not found"})
+		return
+	}
+
+	var shortCode string
+	var customCode *string
+	query := `SELECT id, short_code, custom_code FROM urls WHERE id = $1 AND deleted_at IS NULL`
+	ctx, span := startDBSpan(c.Request.Context(), "urls.get_code", query)
+	err := database.DB.QueryRowContext(ctx, query, id).Scan(&id, &shortCode, &customCode)
+	endSpan(span, err)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			errorResponse(c, http.StatusNotFound, gin.H{"error": "URL not found"})
+			return
+		}
+		errorResponse(c, http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	serveQRCode(c, id, linkCode(shortCode, customCode), false)
+}
+
+// GetShortCodeQRCode serves the QR code of an active link by its short or
+// custom code. It is public, like the short link itself.
+func GetShortCodeQRCode(c *gin.Context) {
+	code := c.Param("shortCode")
+
+	var id, shortCode string
+	var customCode *string
+	query := `
+		SELECT id, short_code, custom_code FROM urls
+		WHERE (short_code = $1 OR custom_code = $1) AND deleted_at IS NULL AND is_active = true
+	`
+	ctx, span := startDBSpan(c.Request.Context(), "urls.get_code", query)
+	err := database.DB.QueryRowContext(ctx, query, code).Scan(&id, &shortCode, &customCode)
+	endSpan(span, err)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			errorResponse(c, http.StatusNotFound, gin.H{"error": "URL not found"})
+			return
+		}
+		errorResponse(c, http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	serveQRCode(c, id, linkCode(shortCode, customCode), true)
+}
+
+// linkCode returns the code a link is shared with: its custom code if it
+// has one
+func linkCode(shortCode string, customCode *string) string {
+	if customCode != nil {
+		return *customCode
+	}
+	return shortCode
+}
+
+// serveQRCode renders the QR code of the short link for code as a PNG, or
+// in the vector format named by ?format=svg|pdf|eps. The link's logo, or
+// the workspace logo, is drawn in the middle unless ?logo=false. Images
+// only depend on the link's code, logo and the options, so they are served
+// with an ETag and may be cached; public images may also be cached by CDNs.
+func serveQRCode(c *gin.Context, urlID, code string, public bool) {
+	format, err := qr.ParseFormat(c.DefaultQuery("format", string(qr.FormatPNG)))
+	if err != nil {
+		errorResponse(c, http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_qr_options"})
+		return
+	}
+	opts, apiErr := qrOptions(c)
+	if apiErr != nil {
+		apiErr.write(c)
+		return
+	}
+	content := qrScanURL(getBaseURL(c) + "/" + code)
+
+	var logo *linkLogo
+	var logoVersion string
+	if c.Query("logo") != "false" {
+		if logo, err = loadLinkLogo(c.Request.Context(), urlID); err != nil {
+			slog.ErrorContext(c.Request.Context(), "failed to load QR logo", "url_id", urlID, "error", err)
+			errorResponse(c, http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if logo != nil {
+			logoVersion = logo.version
+		}
+	}
+
+	etag := qrETag(content, format, opts, logoVersion)
+	visibility := "private"
+	if public {
+		visibility = "public"
+	}
+	c.Header("Cache-Control", fmt.Sprintf("%s, max-age=%d", visibility, int(appConfig.QR.CacheMaxAge.Seconds())))
+	c.Header("ETag", etag)
+	if match := c.GetHeader("If-None-Match"); match != "" && strings.Contains(match, etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	if logo != nil {
+		if opts.Logo, err = logo.decode(); err != nil {
+			slog.ErrorContext(c.Request.Context(), "stored QR logo is unreadable", "url_id", urlID, "error", err)
+			errorResponse(c, http.StatusInternalServerError, gin.H{"error": "Failed to render QR code"})
+			return
+		}
+	}
+	image, err := qr.Render(content, format, opts)
+	if errors.Is(err, qr.ErrLogoTooLarge) {
+		errorResponse(c, http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "code": "logo_too_large"})
+		return
+	}
+	if err != nil {
+		// The content is a short URL, so only a PNG size too small for
+		// the code can fail
+		errorResponse(c, http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_qr_options"})
+		return
+	}
+
+	ext := "." + string(format)
+	disposition := "inline"
+	filename := code + ext
+	if name := c.Query("filename"); name != "" {
+		disposition = "attachment"
+		filename = qrFilename(name, ext)
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`%s; filename="%s"`, disposition, filename))
+	slog.DebugContext(c.Request.Context(), "QR code rendered", "code", code, "format", format, "size", opts.Size, "bytes", len(image))
+	c.Data(http.StatusOK, format.ContentType(), image)
+}
+
+// qrOptions reads the rendering options from the query string: size,
+// level (L, M, Q or H), fg and bg (hex colors), margin (modules) and
+// logo_size (share of the code width)
+func qrOptions(c *gin.Context) (qr.Options, *apiError) {
+	opts := qr.DefaultOptions()
+	invalid := func(err error) *apiError {
+		return &apiError{status: http.StatusBadRequest, body: gin.H{"error": err.Error(), "code": "invalid_qr_options"}}
+	}
+
+	if value := c.Query("size"); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil {
+			return opts, invalid(errors.New("size must be a number of pixels"))
+		}
+		opts.Size = size
+	}
+	if value := c.Query("margin"); value != "" {
+		margin, err := strconv.Atoi(value)
+		if err != nil {
+			return opts, invalid(errors.New("margin must be a number of modules"))
+		}
+		opts.Margin = margin
+	}
+	if value := c.Query("logo_size"); value != "" {
+		logoSize, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return opts, invalid(errors.New("logo_size must be a fraction of the code width"))
+		}
+		opts.LogoSize = logoSize
+	}
+	if value := c.Query("level"); value != "" {
+		level, err := qr.ParseLevel(value)
+		if err != nil {
+			return opts, invalid(err)
+		}
+		opts.Level = level
+	}
+	for param, target := range map[string]*color.RGBA{"fg": &opts.Foreground, "bg": &opts.Background} {
+		if value := c.Query(param); value != "" {
+			parsed, err := qr.ParseColor(value)
+			if err != nil {
+				return opts, invalid(fmt.Errorf("%s: %v", param, err))
+			}
+			*target = parsed
+		}
+	}
+	if err := opts.Validate(appConfig.QR.MaxSize); err != nil {
+		return opts, invalid(err)
+	}
+	return opts, nil
+}
+
+// qrETag identifies the image rendered for a URL in the format with the
+// options and the logo version, empty without a logo
+func qrETag(content string, format qr.Format, opts qr.Options, logoVersion string) string {
+	key := fmt.Sprintf("%s|%s|%s|%d|%d|%x|%x|%d|%g|%s", qrRenderVersion, content, format, opts.Size, opts.Level, opts.Foreground, opts.Background, opts.Margin, opts.LogoSize, logoVersion)
+	sum := sha256.Sum256([]byte(key))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// qrFilename makes a requested download filename safe for a header,
+// adding the image extension if it is missing
+func qrFilename(name, ext string) string {
+	name = strings.Trim(unsafeFilenameChars.ReplaceAllString(name, "-"), "-.")
+	if name == "" {
+		name = "qr"
+	}
+	if len(name) > 100 {
+		name = name[:100]
+	}
+	if !strings.HasSuffix(strings.ToLower(name), ext) {
+		name += ext
+	}
+	return name
+}
+
+// includeQR reports whether link responses embed the QR code: as asked
+// with ?include_qr, or defaultValue
+func includeQR(c *gin.Context, defaultValue bool) bool {
+	include, err := strconv.ParseBool(c.Query("include_qr"))
+	if err != nil {
+		return defaultValue
+	}
+	return include
+}
+
+// inlineQRCode returns the QR code of a short URL as a PNG data URI, or an
+// empty string if it cannot be rendered, which leaves it out of the
+// response
+func inlineQRCode(c *gin.Context, shortURL string) string {
+	uri, err := inlineQRCodes.DataURI(qrScanURL(shortURL))
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "QR code generation failed", "short_url", shortURL, "error", err)
+		return ""
+	}
+	return uri
+}
+
+// qrSourceParam is the query parameter that marks visits from QR codes
+const qrSourceParam = "src"
+
+// qrScanURL is the URL encoded in a short link's QR codes: the short URL
+// with a marker that attributes its visits to QR code scans
+func qrScanURL(shortURL string) string {
+	return shortURL + "?" + qrSourceParam + "=" + models.ClickSourceQR
+}
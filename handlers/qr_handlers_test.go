@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"hash/crc32"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"url-shortener/models"
+	"url-shortener/qr"
+)
+
+func TestQROptions(t *testing.T) {
+	opts, apiErr := qrOptions(testContext("/qr"))
+	require.Nil(t, apiErr)
+	assert.Equal(t, qr.DefaultOptions(), opts)
+
+	opts, apiErr = qrOptions(testContext("/qr?size=512&level=H&fg=%23336699&bg=fff&margin=1"))
+	require.Nil(t, apiErr)
+	assert.Equal(t, 512, opts.Size)
+	assert.Equal(t, 1, opts.Margin)
+	assert.Equal(t, color.RGBA{R: 0x33, G: 0x66, B: 0x99, A: 0xff}, opts.Foreground)
+
+	for _, query := range []string{"size=big", "size=10", "size=100000", "margin=-2", "level=Z", "fg=blue", "fg=000&bg=000000", "logo_size=0.5", "logo_size=big"} {
+		_, apiErr = qrOptions(testContext("/qr?" + query))
+		require.NotNil(t, apiErr, query)
+		assert.Equal(t, "invalid_qr_options", apiErr.body["code"], query)
+	}
+}
+
+func TestQRETag(t *testing.T) {
+	opts := qr.DefaultOptions()
+	etag := qrETag("https://sho.rt/abc", qr.FormatPNG, opts, "")
+	assert.Equal(t, etag, qrETag("https://sho.rt/abc", qr.FormatPNG, opts, ""))
+	assert.NotEqual(t, etag, qrETag("https://sho.rt/abd", qr.FormatPNG, opts, ""))
+	assert.NotEqual(t, etag, qrETag("https://sho.rt/abc", qr.FormatSVG, opts, ""))
+	assert.NotEqual(t, etag, qrETag("https://sho.rt/abc", qr.FormatPNG, opts, "logo@1"))
+	opts.Size++
+	assert.NotEqual(t, etag, qrETag("https://sho.rt/abc", qr.FormatPNG, opts, ""))
+}
+
+func TestQRFilename(t *testing.T) {
+	assert.Equal(t, "spring-sale.png", qrFilename("spring sale", ".png"))
+	assert.Equal(t, "poster.PNG", qrFilename("poster.PNG", ".png"))
+	assert.Equal(t, "etc-passwd.png", qrFilename("../etc/passwd", ".png"))
+	assert.Equal(t, "qr.png", qrFilename(`"";`, ".png"))
+}
+
+func TestGetURLQRCodeRejectsMalformedID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/urls/:id/qr", GetURLQRCode)
+
+	req, _ := http.NewRequest("GET", "/urls/not-a-uuid/qr", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"error":"URL not found"}`, w.Body.String())
+}
+
+func TestQRLogoRejectsBadUploads(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.PUT("/qr/logo", PutWorkspaceQRLogo)
+
+	// A PNG header claiming more pixels than a logo may have
+	ihdr := []byte("IHDR\x00\x00\x20\x00\x00\x00\x20\x00\x08\x06\x00\x00\x00")
+	huge := append([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0d"), ihdr...)
+	huge = binary.BigEndian.AppendUint32(huge, crc32.ChecksumIEEE(ihdr))
+	tests := []struct {
+		contentType string
+		body        []byte
+		status      int
+		error       string
+	}{
+		{"application/json", []byte(`{}`), http.StatusBadRequest, "Content-Type must be image/png, image/jpeg, image/gif or multipart/form-data"},
+		{"image/png", []byte("not an image"), http.StatusBadRequest, "logo must be a PNG, JPEG or GIF image"},
+		{"image/png", huge, http.StatusBadRequest, "logo must be at most 4096x4096 pixels"},
+		{"image/png", bytes.Repeat([]byte("x"), maxLogoBytes+1), http.StatusRequestEntityTooLarge, "logo_too_large"},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("PUT", "/qr/logo", bytes.NewReader(tt.body))
+		req.Header.Set("Content-Type", tt.contentType)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, tt.status, w.Code, tt.error)
+		assert.Contains(t, w.Body.String(), tt.error)
+	}
+}
+
+func TestIncludeQR(t *testing.T) {
+	assert.True(t, includeQR(testContext("/urls"), true))
+	assert.False(t, includeQR(testContext("/urls"), false))
+	assert.False(t, includeQR(testContext("/urls?include_qr=false"), true))
+	assert.True(t, includeQR(testContext("/urls?include_qr=1"), false))
+	assert.True(t, includeQR(testContext("/urls?include_qr=maybe"), true))
+}
+
+func TestInlineQRCode(t *testing.T) {
+	uri := inlineQRCode(testContext("/shorten"), "https://sho.rt/abc123")
+	require.True(t, strings.HasPrefix(uri, "data:image/png;base64,"), uri)
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(uri, "data:image/png;base64,"))
+	require.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")))
+}
+
+func TestQRScanSource(t *testing.T) {
+	scanURL := qrScanURL("https://sho.rt/abc123")
+	assert.Equal(t, "https://sho.rt/abc123?src=qr", scanURL)
+
+	assert.Equal(t, models.ClickSourceQR, clickSource(testContext("/abc123?src=qr")))
+	assert.Equal(t, models.ClickSourceLink, clickSource(testContext("/abc123")))
+	assert.Equal(t, models.ClickSourceLink, clickSource(testContext("/abc123?src=email")))
+}
+
+func TestClicksBySource(t *testing.T) {
+	assert.Equal(t, []models.SourceClicks{
+		{Source: models.ClickSourceLink},
+		{Source: models.ClickSourceQR},
+	}, clicksBySource(nil))
+
+	assert.Equal(t, []models.SourceClicks{
+		{Source: models.ClickSourceLink, Clicks: 7},
+		{Source: models.ClickSourceQR, Clicks: 3},
+		{Source: "nfc", Clicks: 1},
+	}, clicksBySource(map[string]int64{"nfc": 1, models.ClickSourceQR: 3, models.ClickSourceLink: 7}))
+}
@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"url-shortener/audit"
+	"url-shortener/database"
+	"url-shortener/models"
+	"url-shortener/qr"
+)
+
+// maxLogoBytes bounds the size of an uploaded logo
+const maxLogoBytes = 1 << 20
+
+// workspaceLogoTarget is the audit target ID of the workspace logo
+const workspaceLogoTarget = "workspace"
+
+// errNoLogo reports that there is no logo to remove
+var errNoLogo = errors.New("no logo")
+
+// PutWorkspaceQRLogo sets the logo drawn in the QR codes of links without
+// a logo of their own
+func PutWorkspaceQRLogo(c *gin.Context) {
+	saveQRLogo(c, nil)
+}
+
+// DeleteWorkspaceQRLogo removes the workspace logo
+func DeleteWorkspaceQRLogo(c *gin.Context) {
+	deleteQRLogo(c, nil)
+}
+
+// PutURLQRLogo sets the logo drawn in one link's QR codes, replacing the
+// workspace logo for that link
+func PutURLQRLogo(c *gin.Context) {
+	id := c.Param("id")
+	saveQRLogo(c, &id)
+}
+
+// DeleteURLQRLogo removes a link's logo, so its QR codes use the workspace
+// logo again
+func DeleteURLQRLogo(c *gin.Context) {
+	id := c.Param("id")
+	deleteQRLogo(c, &id)
+}
+
+// saveQRLogo stores an uploaded logo, sent as a PNG, JPEG or GIF body or
+// as the "file" field of a multipart form, for a link or, with a nil
+// urlID, for the workspace
+func saveQRLogo(c *gin.Context, urlID *string) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxLogoBytes)
+	body, err := importBody(c, "image/png", "image/jpeg", "image/gif")
+	if err != nil {
+		errorResponse(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			errorResponse(c, http.StatusRequestEntityTooLarge, gin.H{"error": "Logo must be at most 1 MiB", "code": "logo_too_large"})
+			return
+		}
+		errorResponse(c, http.StatusBadRequest, gin.H{"error": "Failed to read logo"})
+		return
+	}
+	img, err := qr.ReadLogo(bytes.NewReader(data))
+	if err != nil {
+		errorResponse(c, http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_logo"})
+		return
+	}
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, img); err != nil {
+		errorResponse(c, http.StatusInternalServerError, gin.H{"error": "Failed to save logo"})
+		return
+	}
+
+	logo := models.QRLogo{
+		ID:        uuid.New().String(),
+		URLID:     urlID,
+		Width:     img.Bounds().Dx(),
+		Height:    img.Bounds().Dy(),
+		Bytes:     encoded.Len(),
+		UpdatedAt: time.Now(),
+	}
+	err = database.WithTx(c.Request.Context(), func(tx *sql.Tx) error {
+		if urlID != nil {
+			if _, err := lockURL(c.Request.Context(), tx, *urlID); err != nil {
+				return err
+			}
+		}
+		before, err := findQRLogo(c.Request.Context(), tx, urlID)
+		if err != nil {
+			return err
+		}
+		if before != nil {
+			logo.ID = before.ID
+		}
+
+		conflict := "(url_id)"
+		if urlID == nil {
+			conflict = "((url_id IS NULL)) WHERE url_id IS NULL"
+		}
+		query := `
+			INSERT INTO qr_logos (id, url_id, image, width, height, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT ` + conflict + ` DO UPDATE
+			SET image = EXCLUDED.image, width = EXCLUDED.width, height = EXCLUDED.height, updated_at = EXCLUDED.updated_at
+		`
+		ctx, span := startDBSpan(c.Request.Context(), "qr_logos.upsert", query)
+		_, err = tx.ExecContext(ctx, query, logo.ID, logo.URLID, encoded.Bytes(), logo.Width, logo.Height, logo.UpdatedAt)
+		endSpan(span, err)
+		if err != nil {
+			return err
+		}
+
+		action := audit.ActionUpdate
+		if before == nil {
+			action = audit.ActionCreate
+		}
+		return recordAudit(c, tx, action, audit.TargetQRLogo, logoTarget(urlID), before, logo)
+	})
+	if err != nil {
+		if errors.Is(err, errLinkNotFound) {
+			errorResponse(c, http.StatusNotFound, gin.H{"error": "URL not found"})
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "failed to save QR logo", "target", logoTarget(urlID), "error", err)
+		errorResponse(c, http.StatusInternalServerError, gin.H{"error": "Failed to save logo"})
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "QR logo saved", "target", logoTarget(urlID), "width", logo.Width, "height", logo.Height)
+	c.JSON(http.StatusOK, gin.H{"message": "Logo saved", "data": logo})
+}
+
+// deleteQRLogo removes the logo of a link or, with a nil urlID, of the
+// workspace
+func deleteQRLogo(c *gin.Context, urlID *string) {
+	if urlID != nil {
+		if _, err := uuid.Parse(*urlID); err != nil {
+			errorResponse(c, http.StatusNotFound, gin.H{"error": "Logo not found"})
+			return
+		}
+	}
+	err := database.WithTx(c.Request.Context(), func(tx *sql.Tx) error {
+		before, err := findQRLogo(c.Request.Context(), tx, urlID)
+		if err != nil {
+			return err
+		}
+		if before == nil {
+			return errNoLogo
+		}
+		query := `DELETE FROM qr_logos WHERE id = $1`
+		ctx, span := startDBSpan(c.Request.Context(), "qr_logos.delete", query)
+		_, err = tx.ExecContext(ctx, query, before.ID)
+		endSpan(span, err)
+		if err != nil {
+			return err
+		}
+		return recordAudit(c, tx, audit.ActionDelete, audit.TargetQRLogo, logoTarget(urlID), before, nil)
+	})
+	if err != nil {
+		if errors.Is(err, errNoLogo) {
+			errorResponse(c, http.StatusNotFound, gin.H{"error": "Logo not found"})
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "failed to delete QR logo", "target", logoTarget(urlID), "error", err)
+		errorResponse(c, http.StatusInternalServerError, gin.H{"error": "Failed to delete logo"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Logo removed"})
+}
+
+// findQRLogo returns the logo of a link or of the workspace, or nil if it
+// has none, locking it for the rest of the transaction
+func findQRLogo(ctx context.Context, tx *sql.Tx, urlID *string) (*models.QRLogo, error) {
+	query := `
+		SELECT id, url_id, width, height, octet_length(image), updated_at
+		FROM qr_logos WHERE url_id = $1 OR ($1 IS NULL AND url_id IS NULL)
+		FOR UPDATE
+	`
+	ctx, span := startDBSpan(ctx, "qr_logos.find", query)
+	var logo models.QRLogo
+	err := tx.QueryRowContext(ctx, query, urlID).Scan(&logo.ID, &logo.URLID, &logo.Width, &logo.Height, &logo.Bytes, &logo.UpdatedAt)
+	endSpan(span, err)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &logo, nil
+}
+
+// linkLogo is the logo drawn in a link's QR codes
+type linkLogo struct {
+	image []byte
+	// version changes whenever the logo does, for cache validation
+	version string
+}
+
+// loadLinkLogo returns the logo drawn in a link's QR codes: its own logo,
+// or else the workspace logo. It returns nil if neither is set.
+func loadLinkLogo(ctx context.Context, urlID string) (*linkLogo, error) {
+	query := `
+		SELECT image, id, updated_at FROM qr_logos
+		WHERE url_id = $1 OR url_id IS NULL
+		ORDER BY url_id NULLS LAST
+		LIMIT 1
+	`
+	ctx, span := startDBSpan(ctx, "qr_logos.get", query)
+	var logo linkLogo
+	var id string
+	var updatedAt time.Time
+	err := database.DB.QueryRowContext(ctx, query, urlID).Scan(&logo.image, &id, &updatedAt)
+	endSpan(span, err)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	logo.version = id + "@" + updatedAt.UTC().Format(time.RFC3339Nano)
+	return &logo, nil
+}
+
+// decode returns the logo image
+func (l *linkLogo) decode() (image.Image, error) {
+	return png.Decode(bytes.NewReader(l.image))
+}
+
+// logoTarget is the audit target ID of a logo
+func logoTarget(urlID *string) string {
+	if urlID == nil {
+		return workspaceLogoTarget
+	}
+	return *urlID
+}
@@ -0,0 +1,350 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"url-shortener/audit"
+	"url-shortener/database"
+	"url-shortener/jobs"
+	"url-shortener/middleware"
+	"url-shortener/models"
+)
+
+// errRevisionNotFound is returned when rolling back to a revision that does
+// not exist
+var errRevisionNotFound = errors.New("revision not found")
+
+// urlUpdate holds the fields of an update request. Title, description and
+// expiry can be cleared, so whether they were sent is tracked separately.
+type urlUpdate struct {
+	originalURL    *string
+	title          *string
+	description    *string
+	expiresAt      *time.Time
+	setTitle       bool
+	setDescription bool
+	setExpiresAt   bool
+}
+
+// apply copies the updated fields onto url
+func (u urlUpdate) apply(url *models.URL) {
+	if u.originalURL != nil {
+		url.OriginalURL = *u.originalURL
+	}
+	if u.setTitle {
+		url.Title = u.title
+	}
+	if u.setDescription {
+		url.Description = u.description
+	}
+	if u.setExpiresAt {
+		url.ExpiresAt = u.expiresAt
+	}
+}
+
+// UpdateURL changes a link's destination, title, description or expiry.
+// Each change is stored as a new revision so clicks stay attributed to the
+// destination they were sent to.
+func UpdateURL(c *gin.Context) {
+	id := c.Param("id")
+
+	var rawData map[string]interface{}
+	if err := c.ShouldBindJSON(&rawData); err != nil {
+		errorResponse(c, http.StatusBadRequest, gin.H{
+			"error":   "Invalid request data",
+			"details": err.Error(),
+		})
+		return
+	}
+	update, err := parseURLUpdate(rawData)
+	if err != nil {
+		errorResponse(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// New destinations go through the same checks as at creation
+	var screenedAt *time.Time
+	if update.originalURL != nil {
+		if !validateDestination(c, *update.originalURL) {
+			return
+		}
+		var ok bool
+		if screenedAt, ok = screenDestination(c, *update.originalURL); !ok {
+			return
+		}
+	}
+
+	saveRevision(c, id, audit.ActionUpdate, screenedAt, update.apply)
+}
+
+// GetURLRevisions lists a link's revisions, newest first, with the clicks
+// each one received
+func GetURLRevisions(c *gin.Context) {
+	id := c.Param("id")
+	if _, err := uuid.Parse(id); err != nil {
+		errorResponse(c, http.StatusNotFound, gin.H{"error": "URL not found"})
+		return
+	}
+
+	// Clicks recorded before revisions were tracked belong to the first
+	// revision. The daily rollups hold every click before the watermark,
+	// including those whose raw rows retention has dropped.
+	query := `
+		WITH state AS (
+			SELECT COALESCE((SELECT watermark FROM analytics_rollup_state WHERE name = $2), '-infinity'::timestamp) AS watermark
+		)
+		SELECT r.revision, r.original_url, r.title, r.description, r.expires_at, r.created_by, r.created_at,
+			r.revision = u.revision,
+			(SELECT COALESCE(SUM(d.clicks), 0) FROM click_rollups_daily d WHERE d.url_id = r.url_id AND d.revision = r.revision) +
+			(SELECT COUNT(*) FROM clicks c, state s WHERE c.url_id = r.url_id AND COALESCE(c.revision, 1) = r.revision AND c.clicked_at >= s.watermark)
+		FROM url_revisions r
+		JOIN urls u ON u.id = r.url_id
+		WHERE r.url_id = $1 AND u.deleted_at IS NULL
+		ORDER BY r.revision DESC
+	`
+	ctx, span := startDBSpan(c.Request.Context(), "url_revisions.list", query)
+	rows, err := database.DB.QueryContext(ctx, query, id, jobs.ClickRollup)
+	if err != nil {
+		endSpan(span, err)
+		errorResponse(c, http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	revisions := []models.URLRevision{}
+	for rows.Next() {
+		var r models.URLRevision
+		if err := rows.Scan(&r.Revision, &r.OriginalURL, &r.Title, &r.Description, &r.ExpiresAt, &r.CreatedBy, &r.CreatedAt, &r.Current, &r.Clicks); err != nil {
+			continue
+		}
+		revisions = append(revisions, r)
+	}
+	endSpan(span, rows.Err())
+
+	// Every link has at least the revision it was created with
+	if len(revisions) == 0 {
+		errorResponse(c, http.StatusNotFound, gin.H{"error": "URL not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": revisions})
+}
+
+// RollbackURL restores the fields of an earlier revision. The rollback is
+// itself stored as a new revision, so history is never rewritten.
+func RollbackURL(c *gin.Context) {
+	id := c.Param("id")
+	revision, err := strconv.Atoi(c.Param("revision"))
+	if err != nil || revision < 1 {
+		errorResponse(c, http.StatusBadRequest, gin.H{"error": "Revision must be a positive number"})
+		return
+	}
+
+	target, err := loadRevision(c.Request.Context(), id, revision)
+	if err != nil {
+		if errors.Is(err, errRevisionNotFound) {
+			errorResponse(c, http.StatusNotFound, gin.H{"error": "Revision not found"})
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "failed to load revision", "url_id", id, "revision", revision, "error", err)
+		errorResponse(c, http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// The old destination may have become unsafe since it was replaced
+	if !validateDestination(c, target.OriginalURL) {
+		return
+	}
+	screenedAt, ok := screenDestination(c, target.OriginalURL)
+	if !ok {
+		return
+	}
+
+	saveRevision(c, id, audit.ActionRollback, screenedAt, func(url *models.URL) {
+		url.OriginalURL = target.OriginalURL
+		url.Title = target.Title
+		url.Description = target.Description
+		url.ExpiresAt = target.ExpiresAt
+	})
+}
+
+// saveRevision applies change to a link and, if any revisioned field
+// differs, stores the result as the link's next revision and writes the
+// response. screenedAt is recorded when the destination changes.
+func saveRevision(c *gin.Context, id, action string, screenedAt *time.Time, change func(*models.URL)) {
+	var after models.URL
+	changed := false
+	err := database.WithTx(c.Request.Context(), func(tx *sql.Tx) error {
+		before, err := lockURL(c.Request.Context(), tx, id)
+		if err != nil {
+			return err
+		}
+		after = before
+		change(&after)
+		if sameRevision(before, after) {
+			return nil
+		}
+
+		changed = true
+		after.Revision = before.Revision + 1
+		after.UpdatedAt = time.Now()
+		if after.OriginalURL != before.OriginalURL {
+			after.ScreenedAt = screenedAt
+		}
+		query := `
+			UPDATE urls SET original_url = $1, title = $2, description = $3, expires_at = $4, screened_at = $5, revision = $6, updated_at = $7
+			WHERE id = $8
+		`
+		ctx, span := startDBSpan(c.Request.Context(), "urls.update", query)
+		_, err = tx.ExecContext(ctx, query, after.OriginalURL, after.Title, after.Description, after.ExpiresAt, after.ScreenedAt, after.Revision, after.UpdatedAt, id)
+		endSpan(span, err)
+		if err != nil {
+			return err
+		}
+		if err := insertRevision(c.Request.Context(), tx, after, middleware.RequestActor(c)); err != nil {
+			return err
+		}
+		return recordAudit(c, tx, action, audit.TargetURL, id, before, after)
+	})
+	if err != nil {
+		if errors.Is(err, errLinkNotFound) {
+			errorResponse(c, http.StatusNotFound, gin.H{"error": "URL not found"})
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "failed to update URL", "url_id", id, "action", action, "error", err)
+		errorResponse(c, http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	message := "URL updated successfully"
+	if !changed {
+		message = "No changes"
+	} else {
+		slog.InfoContext(c.Request.Context(), "URL updated", "url_id", id, "action", action, "revision", after.Revision)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": message,
+		"data":    after.ToResponse(getBaseURL(c)),
+	})
+}
+
+// insertRevision stores the current revisioned fields of url
+func insertRevision(ctx context.Context, tx *sql.Tx, url models.URL, actor string) error {
+	query := `
+		INSERT INTO url_revisions (url_id, revision, original_url, title, description, expires_at, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	ctx, span := startDBSpan(ctx, "url_revisions.insert", query)
+	_, err := tx.ExecContext(ctx, query, url.ID, url.Revision, url.OriginalURL, url.Title, url.Description, url.ExpiresAt, actor, url.UpdatedAt)
+	endSpan(span, err)
+	return err
+}
+
+// loadRevision reads one revision of a link that is not in the trash
+func loadRevision(ctx context.Context, id string, revision int) (models.URLRevision, error) {
+	var r models.URLRevision
+	if _, err := uuid.Parse(id); err != nil {
+		return r, errRevisionNotFound
+	}
+	query := `
+		SELECT r.revision, r.original_url, r.title, r.description, r.expires_at, r.created_by, r.created_at
+		FROM url_revisions r
+		JOIN urls u ON u.id = r.url_id
+		WHERE r.url_id = $1 AND r.revision = $2 AND u.deleted_at IS NULL
+	`
+	ctx, span := startDBSpan(ctx, "url_revisions.get", query)
+	err := database.DB.QueryRowContext(ctx, query, id, revision).Scan(&r.Revision, &r.OriginalURL, &r.Title, &r.Description, &r.ExpiresAt, &r.CreatedBy, &r.CreatedAt)
+	endSpan(span, err)
+	if err == sql.ErrNoRows {
+		return r, errRevisionNotFound
+	}
+	return r, err
+}
+
+// parseURLUpdate reads an update request. Empty strings and null clear
+// title, description and expires_at; the destination cannot be cleared.
+func parseURLUpdate(rawData map[string]interface{}) (urlUpdate, error) {
+	var update urlUpdate
+	known := false
+
+	if value, ok := rawData["original_url"]; ok {
+		known = true
+		originalURL, _ := value.(string)
+		if originalURL == "" {
+			return update, errors.New("Original URL cannot be empty")
+		}
+		if !strings.HasPrefix(originalURL, "http://") && !strings.HasPrefix(originalURL, "https://") {
+			return update, errors.New("URL must start with http:// or https://")
+		}
+		update.originalURL = &originalURL
+	}
+
+	for _, field := range []struct {
+		key    string
+		target **string
+		set    *bool
+	}{
+		{"title", &update.title, &update.setTitle},
+		{"description", &update.description, &update.setDescription},
+	} {
+		value, ok := rawData[field.key]
+		if !ok {
+			continue
+		}
+		known = true
+		*field.set = true
+		switch v := value.(type) {
+		case nil:
+		case string:
+			*field.target = getStringPtr(v)
+		default:
+			return update, fmt.Errorf("%s must be a string or null", field.key)
+		}
+	}
+
+	if value, ok := rawData["expires_at"]; ok {
+		known = true
+		update.setExpiresAt = true
+		switch v := value.(type) {
+		case nil:
+		case string:
+			if v != "" {
+				expiresAt, err := time.Parse(time.RFC3339, v)
+				if err != nil {
+					return update, errors.New("Invalid expires_at format, expected ISO 8601 (e.g., 2024-01-01T12:00:00Z)")
+				}
+				update.expiresAt = &expiresAt
+			}
+		default:
+			return update, errors.New("expires_at must be a string or null")
+		}
+	}
+
+	if !known {
+		return update, errors.New("Nothing to update: set original_url, title, description or expires_at")
+	}
+	return update, nil
+}
+
+// sameRevision reports whether two versions of a link have the same
+// revisioned fields
+func sameRevision(a, b models.URL) bool {
+	sameString := func(x, y *string) bool {
+		return (x == nil && y == nil) || (x != nil && y != nil && *x == *y)
+	}
+	sameTime := func(x, y *time.Time) bool {
+		return (x == nil && y == nil) || (x != nil && y != nil && x.Equal(*y))
+	}
+	return a.OriginalURL == b.OriginalURL && sameString(a.Title, b.Title) &&
+		sameString(a.Description, b.Description) && sameTime(a.ExpiresAt, b.ExpiresAt)
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"url-shortener/models"
+)
+
+func TestParseURLUpdate(t *testing.T) {
+	title := "Old title"
+	expiresAt := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	url := models.URL{OriginalURL: "https://example.com/a", Title: &title, ExpiresAt: &expiresAt}
+
+	update, err := parseURLUpdate(map[string]interface{}{
+		"original_url": "https://example.com/b",
+		"title":        nil,
+		"description":  "New description",
+	})
+	require.NoError(t, err)
+	update.apply(&url)
+	assert.Equal(t, "https://example.com/b", url.OriginalURL)
+	assert.Nil(t, url.Title)
+	assert.Equal(t, "New description", *url.Description)
+	assert.Equal(t, expiresAt, *url.ExpiresAt, "fields not sent are unchanged")
+
+	update, err = parseURLUpdate(map[string]interface{}{"expires_at": ""})
+	require.NoError(t, err)
+	update.apply(&url)
+	assert.Nil(t, url.ExpiresAt)
+}
+
+func TestParseURLUpdateErrors(t *testing.T) {
+	tests := []struct {
+		body  map[string]interface{}
+		error string
+	}{
+		{map[string]interface{}{}, "Nothing to update"},
+		{map[string]interface{}{"custom_code": "abc"}, "Nothing to update"},
+		{map[string]interface{}{"original_url": ""}, "cannot be empty"},
+		{map[string]interface{}{"original_url": nil}, "cannot be empty"},
+		{map[string]interface{}{"original_url": "ftp://example.com"}, "must start with http://"},
+		{map[string]interface{}{"title": 5.0}, "title must be a string or null"},
+		{map[string]interface{}{"expires_at": "tomorrow"}, "Invalid expires_at format"},
+	}
+	for _, tt := range tests {
+		_, err := parseURLUpdate(tt.body)
+		assert.ErrorContains(t, err, tt.error, "body: %v", tt.body)
+	}
+}
+
+func TestSameRevision(t *testing.T) {
+	a, b := "title", "title"
+	t1 := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.In(time.FixedZone("UTC+2", 2*60*60))
+
+	base := models.URL{OriginalURL: "https://example.com", Title: &a, ExpiresAt: &t1}
+	same := models.URL{OriginalURL: "https://example.com", Title: &b, ExpiresAt: &t2, ClickCount: 10}
+	assert.True(t, sameRevision(base, same))
+
+	moved := same
+	moved.OriginalURL = "https://example.org"
+	assert.False(t, sameRevision(base, moved))
+
+	cleared := same
+	cleared.Title = nil
+	assert.False(t, sameRevision(base, cleared))
+}
+
+func TestRollbackURLValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/urls/:id/revisions/:revision/rollback", RollbackURL)
+
+	for _, revision := range []string{"0", "-1", "latest"} {
+		req, _ := http.NewRequest("POST", "/urls/abc/revisions/"+revision+"/rollback", strings.NewReader("{}"))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, "revision %s", revision)
+	}
+}
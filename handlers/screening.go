@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"url-shortener/screening"
+)
+
+// urlScreener screens destination URLs; nil disables screening
+var urlScreener *screening.Screener
+
+// ConfigureScreening sets the screener used when links are created
+func ConfigureScreening(s *screening.Screener) {
+	urlScreener = s
+}
+
+// validateDestination rejects destinations in private networks, on this
+// service's own host or on other URL shorteners. It aborts the request and
+// returns false when the destination is not allowed.
+func validateDestination(c *gin.Context, rawURL string) bool {
+	if apiErr := checkDestination(c.Request.Context(), rawURL, c.Request.Host); apiErr != nil {
+		apiErr.write(c)
+		return false
+	}
+	return true
+}
+
+// checkDestination applies the destination policy to rawURL. requestHost
+// is the Host the request was made to.
+func checkDestination(ctx context.Context, rawURL, requestHost string) *apiError {
+	err := destinationPolicy.Validate(ctx, rawURL, requestHost)
+	if err == nil {
+		return nil
+	}
+
+	var destErr *screening.DestinationError
+	if !errors.As(err, &destErr) {
+		destErr = &screening.DestinationError{Code: screening.CodeInvalidDestination, Message: err.Error()}
+	}
+	slog.InfoContext(ctx, "destination URL rejected", "original_url", rawURL, "code", destErr.Code)
+	return &apiError{status: http.StatusBadRequest, body: gin.H{
+		"error": destErr.Message,
+		"code":  destErr.Code,
+	}}
+}
+
+// screenDestination checks a destination URL before a link is created. It
+// aborts the request and returns false when the URL is flagged. The
+// returned time is when the URL passed screening, or nil if it was not
+// screened, so the re-check job picks it up first.
+//
+// A failing lookup service does not block link creation; the local
+// blocklists are still applied.
+func screenDestination(c *gin.Context, rawURL string) (*time.Time, bool) {
+	if urlScreener == nil {
+		return nil, true
+	}
+
+	verdict, flagged, err := urlScreener.Check(c.Request.Context(), rawURL)
+	if flagged {
+		unsafeDestinationError(c.Request.Context(), rawURL, verdict).write(c)
+		return nil, false
+	}
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "URL screening incomplete", "original_url", rawURL, "error", err)
+		return nil, true
+	}
+
+	now := time.Now()
+	return &now, true
+}
+
+// unsafeDestinationError logs and describes a destination flagged by
+// screening
+func unsafeDestinationError(ctx context.Context, rawURL string, verdict screening.Verdict) *apiError {
+	slog.WarnContext(ctx, "destination URL flagged by screening",
+		"original_url", rawURL, "threat", verdict.Threat, "source", verdict.Source)
+	return &apiError{status: http.StatusUnprocessableEntity, body: gin.H{
+		"error":  "Destination URL is flagged as unsafe",
+		"code":   "unsafe_destination",
+		"threat": verdict.Threat,
+	}}
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("url-shortener/handlers")
+
+// startDBSpan starts a client span for a single SQL statement
+func startDBSpan(ctx context.Context, name, query string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBOperation(sqlOperation(query)),
+			semconv.DBStatement(strings.Join(strings.Fields(query), " ")),
+		),
+	)
+}
+
+// endSpan records err on the span (a missing row is not an error) and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// sqlOperation returns the leading SQL keyword of a statement
+func sqlOperation(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToUpper(fields[0])
+}
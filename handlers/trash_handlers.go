@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"url-shortener/audit"
+	"url-shortener/database"
+	"url-shortener/models"
+)
+
+// errRetentionExpired is returned when restoring a link whose retention
+// window has passed but which has not been purged yet
+var errRetentionExpired = errors.New("retention window expired")
+
+// Custom code availability, as reported by customCodeStatus
+const (
+	codeAvailable       = "available"
+	codeTaken           = "taken"
+	codeRecentlyDeleted = "recently_deleted"
+)
+
+// GetTrash lists deleted links that can still be restored, most recently
+// deleted first
+func GetTrash(c *gin.Context) {
+	page := getIntQuery(c, "page", 1)
+	limit := getIntQuery(c, "limit", 10)
+	offset := (page - 1) * limit
+	cutoff := time.Now().Add(-appConfig.Trash.Retention)
+
+	var total int
+	query := "SELECT COUNT(*) FROM urls WHERE deleted_at > $1"
+	ctx, span := startDBSpan(c.Request.Context(), "urls.count_trash", query)
+	err := database.DB.QueryRowContext(ctx, query, cutoff).Scan(&total)
+	endSpan(span, err)
+	if err != nil {
+		errorResponse(c, http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	query = `
+		SELECT id, original_url, short_code, custom_code, title, description, is_active, expires_at, click_count, created_at, updated_at, disabled_reason, disabled_at, deleted_at, revision
+		FROM urls
+		WHERE deleted_at > $1
+		ORDER BY deleted_at DESC
+		LIMIT $2 OFFSET $3
+	`
+	ctx, span = startDBSpan(c.Request.Context(), "urls.list_trash", query)
+	rows, err := database.DB.QueryContext(ctx, query, cutoff, limit, offset)
+	if err != nil {
+		endSpan(span, err)
+		errorResponse(c, http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	items := []models.TrashItem{}
+	baseURL := getBaseURL(c)
+	for rows.Next() {
+		var url models.URL
+		err := rows.Scan(&url.ID, &url.OriginalURL, &url.ShortCode, &url.CustomCode, &url.Title, &url.Description, &url.IsActive, &url.ExpiresAt, &url.ClickCount, &url.CreatedAt, &url.UpdatedAt, &url.DisabledReason, &url.DisabledAt, &url.DeletedAt, &url.Revision)
+		if err != nil {
+			continue
+		}
+		items = append(items, models.TrashItem{
+			URLResponse:     url.ToResponse(baseURL),
+			RestorableUntil: url.DeletedAt.Add(appConfig.Trash.Retention),
+		})
+	}
+	endSpan(span, rows.Err())
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": items,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+			"pages": (total + limit - 1) / limit,
+		},
+	})
+}
+
+// RestoreURL takes a link out of the trash. Links deleted longer ago than
+// the retention window can no longer be restored.
+func RestoreURL(c *gin.Context) {
+	id := c.Param("id")
+
+	var restored models.URL
+	err := database.WithTx(c.Request.Context(), func(tx *sql.Tx) error {
+		url, err := lockDeletedURL(c.Request.Context(), tx, id)
+		if err != nil {
+			return err
+		}
+		if time.Since(*url.DeletedAt) > appConfig.Trash.Retention {
+			return errRetentionExpired
+		}
+
+		restored = url
+		restored.DeletedAt = nil
+		restored.UpdatedAt = time.Now()
+		query := "UPDATE urls SET deleted_at = NULL, updated_at = $1 WHERE id = $2"
+		ctx, span := startDBSpan(c.Request.Context(), "urls.restore", query)
+		_, err = tx.ExecContext(ctx, query, restored.UpdatedAt, id)
+		endSpan(span, err)
+		if err != nil {
+			return err
+		}
+		return recordAudit(c, tx, audit.ActionRestore, audit.TargetURL, id, url, restored)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errLinkNotFound):
+			errorResponse(c, http.StatusNotFound, gin.H{"error": "URL not found in trash"})
+		case errors.Is(err, errRetentionExpired):
+			errorResponse(c, http.StatusGone, gin.H{
+				"error": "URL was deleted too long ago to be restored",
+				"code":  "retention_expired",
+			})
+		default:
+			slog.ErrorContext(c.Request.Context(), "failed to restore URL", "url_id", id, "error", err)
+			errorResponse(c, http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "URL restored", "url_id", id)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "URL restored successfully",
+		"data":    restored.ToResponse(getBaseURL(c)),
+	})
+}
+
+// softDeleteURL moves a locked link to the trash and returns its new state
+func softDeleteURL(ctx context.Context, tx *sql.Tx, url models.URL) (models.URL, error) {
+	now := time.Now()
+	query := "UPDATE urls SET deleted_at = $1, updated_at = $1 WHERE id = $2"
+	ctx, span := startDBSpan(ctx, "urls.soft_delete", query)
+	_, err := tx.ExecContext(ctx, query, now, url.ID)
+	endSpan(span, err)
+
+	url.DeletedAt = &now
+	url.UpdatedAt = now
+	return url, err
+}
+
+// customCodeStatus reports whether a custom code is free, used by a link,
+// or held back because its link was recently deleted. A code is in use if
+// it is a link's custom code or its generated short code, since redirects
+// match either. Codes stay held while the link is in the trash and for the
+// reuse cooldown after it is purged.
+func customCodeStatus(ctx context.Context, code string) (string, error) {
+	var status string
+	query := `
+		SELECT COALESCE(
+			(SELECT CASE WHEN deleted_at IS NULL THEN 'taken' ELSE 'recently_deleted' END FROM urls
+				WHERE custom_code = $1 OR short_code = $1 ORDER BY deleted_at IS NOT NULL LIMIT 1),
+			(SELECT 'recently_deleted' FROM retired_codes WHERE code = $1 AND reserved_until > $2),
+			'available'
+		)
+	`
+	ctx, span := startDBSpan(ctx, "urls.custom_code_status", query)
+	err := database.DB.QueryRowContext(ctx, query, code, time.Now()).Scan(&status)
+	endSpan(span, err)
+	return status, err
+}
@@ -1,152 +1,97 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
-	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"github.com/skip2/go-qrcode"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"url-shortener/audit"
 	"url-shortener/database"
+	"url-shortener/logging"
+	"url-shortener/middleware"
 	"url-shortener/models"
 )
 
 // CreateShortURL creates a new shortened URL
 func CreateShortURL(c *gin.Context) {
-	var req models.CreateURLRequest
-	
 	// Bind the raw JSON first to handle empty strings properly
 	var rawData map[string]interface{}
 	if err := c.ShouldBindJSON(&rawData); err != nil {
-		log.Printf("Error binding JSON: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{
+		slog.WarnContext(c.Request.Context(), "invalid create request body", "error", err)
+		errorResponse(c, http.StatusBadRequest, gin.H{
 			"error":   "Invalid request data",
 			"details": err.Error(),
 		})
 		return
 	}
-	
-	// Extract and validate original URL
-	if originalURL, ok := rawData["original_url"].(string); ok && originalURL != "" {
-		// Basic URL validation
-		if !strings.HasPrefix(originalURL, "http://") && !strings.HasPrefix(originalURL, "https://") {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": "URL must start with http:// or https://",
-			})
-			return
-		}
-		req.OriginalURL = originalURL
-	} else {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Original URL is required",
-		})
+
+	req, apiErr := parseCreateRequest(rawData, validateCustomCode)
+	if apiErr != nil {
+		apiErr.write(c)
 		return
 	}
-	
-	// Extract optional fields
-	if customCode, ok := rawData["custom_code"].(string); ok && customCode != "" {
-		req.CustomCode = &customCode
-	}
-	
-	if title, ok := rawData["title"].(string); ok && title != "" {
-		req.Title = &title
+
+	// Banned users and addresses cannot create links
+	if apiErr := checkBanned(c); apiErr != nil {
+		apiErr.write(c)
+		return
 	}
-	
-	if description, ok := rawData["description"].(string); ok && description != "" {
-		req.Description = &description
+
+	// Reject destinations that could be used for SSRF or redirect loops
+	if !validateDestination(c, req.OriginalURL) {
+		return
 	}
-	
-	// Handle expires_at field
-	if expiresAtStr, ok := rawData["expires_at"].(string); ok && expiresAtStr != "" {
-		expiresAt, err := time.Parse(time.RFC3339, expiresAtStr)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error":   "Invalid expires_at format",
-				"details": "Expected ISO 8601 format (e.g., 2024-01-01T12:00:00Z)",
-			})
-			return
-		}
-		req.ExpiresAt = &expiresAt
+
+	// Reject destinations known to host phishing or malware
+	screenedAt, ok := screenDestination(c, req.OriginalURL)
+	if !ok {
+		return
 	}
 
-	// Validate custom code if provided
+	// Check if custom code already exists
 	if req.CustomCode != nil {
-		customCode := *req.CustomCode
-		if len(customCode) < 3 || len(customCode) > 50 {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": "Custom code must be between 3 and 50 characters",
-			})
-			return
-		}
-
-		// Validate custom code format (alphanumeric and hyphens only)
-		for _, char := range customCode {
-			if !((char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9') || char == '-') {
-				c.JSON(http.StatusBadRequest, gin.H{
-					"error": "Custom code can only contain letters, numbers, and hyphens",
-				})
-				return
-			}
-		}
-
-		// Check if custom code already exists
-		var exists bool
-		err := database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM urls WHERE custom_code = $1)", customCode).Scan(&exists)
-		if err != nil {
-			log.Printf("Database error checking custom code: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
-			return
-		}
-		if exists {
-			c.JSON(http.StatusConflict, gin.H{"error": "Custom code already exists"})
+		if apiErr := checkCustomCode(c.Request.Context(), *req.CustomCode); apiErr != nil {
+			apiErr.write(c)
 			return
 		}
 	}
 
 	// Create new URL
-	url := models.NewURL(req.OriginalURL, req.CustomCode)
-	url.Title = req.Title
-	url.Description = req.Description
-	url.ExpiresAt = req.ExpiresAt
+	url := newURLFromRequest(c, req, screenedAt)
 
 	// Insert into database
-	_, err := database.DB.Exec(`
-		INSERT INTO urls (id, original_url, short_code, custom_code, title, description, expires_at, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-	`, url.ID, url.OriginalURL, url.ShortCode, url.CustomCode, url.Title, url.Description, url.ExpiresAt, url.CreatedAt, url.UpdatedAt)
+	err := database.WithTx(c.Request.Context(), func(tx *sql.Tx) error {
+		return insertURL(c, tx, url)
+	})
 
 	if err != nil {
-		log.Printf("Database error creating URL: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create URL"})
+		if isUniqueViolation(err, customCodeConstraint) {
+			customCodeTakenError().write(c)
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "failed to create URL", "error", err)
+		errorResponse(c, http.StatusInternalServerError, gin.H{"error": "Failed to create URL"})
 		return
 	}
 
-	// Generate QR code
-	baseURL := getBaseURL(c)
-	shortURL := baseURL + "/" + url.ShortCode
-	if url.CustomCode != nil {
-		shortURL = baseURL + "/" + *url.CustomCode
+	response := url.ToResponse(getBaseURL(c))
+	if includeQR(c, appConfig.QR.Inline) {
+		response.QRCode = inlineQRCode(c, response.ShortURL)
 	}
 
-	qrCode, err := qrcode.Encode(shortURL, qrcode.Medium, 256)
-	if err != nil {
-		// QR code generation failed, but URL was created successfully
-		log.Printf("QR code generation failed: %v", err)
-		qrCode = nil
-	}
-
-	response := url.ToResponse(baseURL)
-	if qrCode != nil {
-		response.QRCode = fmt.Sprintf("data:image/png;base64,%s", qrCode)
-	}
-
-	log.Printf("URL shortened successfully: %s -> %s", url.OriginalURL, shortURL)
+	slog.InfoContext(c.Request.Context(), "URL shortened", "url_id", url.ID, "original_url", url.OriginalURL, "short_url", response.ShortURL)
 
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "URL shortened successfully",
@@ -158,44 +103,65 @@ func CreateShortURL(c *gin.Context) {
 func RedirectToOriginal(c *gin.Context) {
 	shortCode := c.Param("shortCode")
 	if shortCode == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Short code is required"})
+		errorResponse(c, http.StatusBadRequest, gin.H{"error": "Short code is required"})
 		return
 	}
 
 	// Get URL from database
 	var url models.URL
-	err := database.DB.QueryRow(`
-		SELECT id, original_url, short_code, custom_code, is_active, expires_at, click_count
+	query := `
+		SELECT id, original_url, short_code, custom_code, is_active, expires_at, click_count, disabled_at, revision
 		FROM urls 
-		WHERE (short_code = $1 OR custom_code = $1) AND is_active = true
-	`, shortCode).Scan(&url.ID, &url.OriginalURL, &url.ShortCode, &url.CustomCode, &url.IsActive, &url.ExpiresAt, &url.ClickCount)
+		WHERE (short_code = $1 OR custom_code = $1) AND deleted_at IS NULL
+	`
+	ctx, span := startDBSpan(c.Request.Context(), "urls.lookup", query)
+	err := database.DB.QueryRowContext(ctx, query, shortCode).Scan(&url.ID, &url.OriginalURL, &url.ShortCode, &url.CustomCode, &url.IsActive, &url.ExpiresAt, &url.ClickCount, &url.DisabledAt, &url.Revision)
+	endSpan(span, err)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			c.JSON(http.StatusNotFound, gin.H{"error": "URL not found"})
+			errorResponse(c, http.StatusNotFound, gin.H{"error": "URL not found"})
+			return
+		}
+		errorResponse(c, http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// Links disabled by moderation or screening explain why they no longer
+	// redirect; other inactive links are simply not found
+	if !url.IsActive {
+		if url.DisabledAt != nil {
+			renderLinkDisabled(c)
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		errorResponse(c, http.StatusNotFound, gin.H{"error": "URL not found"})
 		return
 	}
 
 	// Check if URL is expired
 	if url.IsExpired() {
-		c.JSON(http.StatusGone, gin.H{"error": "URL has expired"})
+		errorResponse(c, http.StatusGone, gin.H{"error": "URL has expired"})
 		return
 	}
 
-	// Record click
-	go recordClick(url.ID, c)
+	// Record click in the background, keeping the request's trace and request
+	// ID but not its cancellation. The gin context must not be used after the
+	// handler returns, so the click is built here rather than in the goroutine.
+	click := newClick(url, c)
+	go recordClick(context.WithoutCancel(c.Request.Context()), click)
 
 	// Increment click count
-	_, err = database.DB.Exec("UPDATE urls SET click_count = click_count + 1, updated_at = $1 WHERE id = $2", time.Now(), url.ID)
+	query = "UPDATE urls SET click_count = click_count + 1, updated_at = $1 WHERE id = $2"
+	ctx, span = startDBSpan(c.Request.Context(), "urls.increment_click_count", query)
+	_, err = database.DB.ExecContext(ctx, query, time.Now(), url.ID)
+	endSpan(span, err)
 	if err != nil {
 		// Log error but don't fail the redirect
-		fmt.Printf("Failed to update click count: %v\n", err)
+		slog.ErrorContext(c.Request.Context(), "failed to update click count", "url_id", url.ID, "error", err)
 	}
 
-	// Redirect to original URL
+	// Redirect to original URL. The short URL's query, including the QR
+	// source marker, is not passed on to the destination.
 	c.Redirect(http.StatusMovedPermanently, url.OriginalURL)
 }
 
@@ -207,36 +173,49 @@ func GetAllURLs(c *gin.Context) {
 
 	// Get total count
 	var total int
-	err := database.DB.QueryRow("SELECT COUNT(*) FROM urls").Scan(&total)
+	query := "SELECT COUNT(*) FROM urls WHERE deleted_at IS NULL"
+	ctx, span := startDBSpan(c.Request.Context(), "urls.count", query)
+	err := database.DB.QueryRowContext(ctx, query).Scan(&total)
+	endSpan(span, err)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		errorResponse(c, http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
 
 	// Get URLs
-	rows, err := database.DB.Query(`
-		SELECT id, original_url, short_code, custom_code, title, description, is_active, expires_at, click_count, created_at, updated_at
+	query = `
+		SELECT id, original_url, short_code, custom_code, title, description, is_active, expires_at, click_count, created_at, updated_at, disabled_reason, disabled_at, revision
 		FROM urls 
+		WHERE deleted_at IS NULL
 		ORDER BY created_at DESC 
 		LIMIT $1 OFFSET $2
-	`, limit, offset)
+	`
+	ctx, span = startDBSpan(c.Request.Context(), "urls.list", query)
+	rows, err := database.DB.QueryContext(ctx, query, limit, offset)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		endSpan(span, err)
+		errorResponse(c, http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
 	defer rows.Close()
 
 	var urls []models.URLResponse
 	baseURL := getBaseURL(c)
+	withQR := includeQR(c, false)
 
 	for rows.Next() {
 		var url models.URL
-		err := rows.Scan(&url.ID, &url.OriginalURL, &url.ShortCode, &url.CustomCode, &url.Title, &url.Description, &url.IsActive, &url.ExpiresAt, &url.ClickCount, &url.CreatedAt, &url.UpdatedAt)
+		err := rows.Scan(&url.ID, &url.OriginalURL, &url.ShortCode, &url.CustomCode, &url.Title, &url.Description, &url.IsActive, &url.ExpiresAt, &url.ClickCount, &url.CreatedAt, &url.UpdatedAt, &url.DisabledReason, &url.DisabledAt, &url.Revision)
 		if err != nil {
 			continue
 		}
-		urls = append(urls, url.ToResponse(baseURL))
+		response := url.ToResponse(baseURL)
+		if withQR {
+			response.QRCode = inlineQRCode(c, response.ShortURL)
+		}
+		urls = append(urls, response)
 	}
+	endSpan(span, rows.Err())
 
 	c.JSON(http.StatusOK, gin.H{
 		"data": urls,
@@ -253,199 +232,186 @@ func GetAllURLs(c *gin.Context) {
 func GetURLByID(c *gin.Context) {
 	id := c.Param("id")
 	if id == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "URL ID is required"})
+		errorResponse(c, http.StatusBadRequest, gin.H{"error": "URL ID is required"})
 		return
 	}
 
 	var url models.URL
-	err := database.DB.QueryRow(`
-		SELECT id, original_url, short_code, custom_code, title, description, is_active, expires_at, click_count, created_at, updated_at
-		FROM urls WHERE id = $1
-	`, id).Scan(&url.ID, &url.OriginalURL, &url.ShortCode, &url.CustomCode, &url.Title, &url.Description, &url.IsActive, &url.ExpiresAt, &url.ClickCount, &url.CreatedAt, &url.UpdatedAt)
+	query := `
+		SELECT id, original_url, short_code, custom_code, title, description, is_active, expires_at, click_count, created_at, updated_at, disabled_reason, disabled_at, revision
+		FROM urls WHERE id = $1 AND deleted_at IS NULL
+	`
+	ctx, span := startDBSpan(c.Request.Context(), "urls.get", query)
+	err := database.DB.QueryRowContext(ctx, query, id).Scan(&url.ID, &url.OriginalURL, &url.ShortCode, &url.CustomCode, &url.Title, &url.Description, &url.IsActive, &url.ExpiresAt, &url.ClickCount, &url.CreatedAt, &url.UpdatedAt, &url.DisabledReason, &url.DisabledAt, &url.Revision)
+	endSpan(span, err)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			c.JSON(http.StatusNotFound, gin.H{"error": "URL not found"})
+			errorResponse(c, http.StatusNotFound, gin.H{"error": "URL not found"})
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		errorResponse(c, http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
 
-	baseURL := getBaseURL(c)
-	response := url.ToResponse(baseURL)
-
-	// Generate QR code
-	shortURL := baseURL + "/" + url.ShortCode
-	if url.CustomCode != nil {
-		shortURL = baseURL + "/" + *url.CustomCode
-	}
-
-	qrCode, err := qrcode.Encode(shortURL, qrcode.Medium, 256)
-	if err == nil {
-		response.QRCode = fmt.Sprintf("data:image/png;base64,%s", qrCode)
+	response := url.ToResponse(getBaseURL(c))
+	if includeQR(c, appConfig.QR.Inline) {
+		response.QRCode = inlineQRCode(c, response.ShortURL)
 	}
 
 	c.JSON(http.StatusOK, gin.H{"data": response})
 }
 
-// DeleteURL deletes a URL
+// DeleteURL moves a URL to the trash. It stops redirecting but keeps its
+// click history and can be restored until the retention window ends.
 func DeleteURL(c *gin.Context) {
 	id := c.Param("id")
 	if id == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "URL ID is required"})
+		errorResponse(c, http.StatusBadRequest, gin.H{"error": "URL ID is required"})
 		return
 	}
 
-	result, err := database.DB.Exec("DELETE FROM urls WHERE id = $1", id)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
-		return
-	}
+	err := database.WithTx(c.Request.Context(), func(tx *sql.Tx) error {
+		url, err := lockURL(c.Request.Context(), tx, id)
+		if err != nil {
+			return err
+		}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "URL not found"})
+		deleted, err := softDeleteURL(c.Request.Context(), tx, url)
+		if err != nil {
+			return err
+		}
+		return recordAudit(c, tx, audit.ActionDelete, audit.TargetURL, id, url, deleted)
+	})
+	if err != nil {
+		if errors.Is(err, errLinkNotFound) {
+			errorResponse(c, http.StatusNotFound, gin.H{"error": "URL not found"})
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "failed to delete URL", "url_id", id, "error", err)
+		errorResponse(c, http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "URL deleted successfully"})
 }
 
-// GetURLAnalytics gets analytics for a specific URL
+// GetURLAnalytics gets analytics for a specific URL over a date range,
+// with the click timeline bucketed by the requested granularity
 func GetURLAnalytics(c *gin.Context) {
 	id := c.Param("id")
 	if id == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "URL ID is required"})
+		errorResponse(c, http.StatusBadRequest, gin.H{"error": "URL ID is required"})
+		return
+	}
+	q, apiErr := parseAnalyticsQuery(c)
+	if apiErr != nil {
+		apiErr.write(c)
 		return
 	}
+	reqCtx := c.Request.Context()
 
 	// Get basic URL info
 	var url models.URL
-	err := database.DB.QueryRow("SELECT id, click_count FROM urls WHERE id = $1", id).Scan(&url.ID, &url.ClickCount)
+	query := "SELECT id, click_count FROM urls WHERE id = $1 AND deleted_at IS NULL"
+	ctx, span := startDBSpan(reqCtx, "urls.get_click_count", query)
+	err := database.DB.QueryRowContext(ctx, query, id).Scan(&url.ID, &url.ClickCount)
+	endSpan(span, err)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			c.JSON(http.StatusNotFound, gin.H{"error": "URL not found"})
+			errorResponse(c, http.StatusNotFound, gin.H{"error": "URL not found"})
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		errorResponse(c, http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
 
-	// Get unique clicks count
-	var uniqueClicks int64
-	err = database.DB.QueryRow("SELECT COUNT(DISTINCT ip_address) FROM clicks WHERE url_id = $1", id).Scan(&uniqueClicks)
+	// Rolled up periods are read from the rollups, the rest from clicks
+	watermark, err := rollupWatermark(reqCtx)
 	if err != nil {
-		uniqueClicks = 0
+		slog.ErrorContext(reqCtx, "failed to read analytics rollup watermark", "error", err)
+		errorResponse(c, http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
 	}
 
-	// Get top countries
-	rows, err := database.DB.Query(`
-		SELECT country, COUNT(*) as clicks 
-		FROM clicks 
-		WHERE url_id = $1 AND country IS NOT NULL 
-		GROUP BY country 
-		ORDER BY clicks DESC 
-		LIMIT 5
-	`, id)
+	// Get clicks in the range by revision, source, country, device and browser
+	breakdown, err := loadClickBreakdown(reqCtx, id, q, watermark)
 	if err != nil {
-		rows = nil
-	}
-
-	var topCountries []models.Country
-	if rows != nil {
-		defer rows.Close()
-		for rows.Next() {
-			var country models.Country
-			rows.Scan(&country.Country, &country.Clicks)
-			topCountries = append(topCountries, country)
-		}
+		slog.ErrorContext(reqCtx, "failed to load click breakdown", "url_id", id, "error", err)
+		errorResponse(c, http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
 	}
 
-	// Get top devices
-	rows, err = database.DB.Query(`
-		SELECT device, COUNT(*) as clicks 
-		FROM clicks 
-		WHERE url_id = $1 AND device IS NOT NULL 
-		GROUP BY device 
-		ORDER BY clicks DESC 
-		LIMIT 5
-	`, id)
+	// Get unique clicks count
+	uniqueClicks, err := loadUniqueClicks(reqCtx, id, q, watermark)
 	if err != nil {
-		rows = nil
+		uniqueClicks = 0
 	}
 
-	var topDevices []models.Device
-	if rows != nil {
-		defer rows.Close()
-		for rows.Next() {
-			var device models.Device
-			rows.Scan(&device.Device, &device.Clicks)
-			topDevices = append(topDevices, device)
-		}
+	// Get top countries, devices and browsers
+	var topCountries []models.Country
+	for _, n := range topClicks(breakdown.countries, q.top) {
+		topCountries = append(topCountries, models.Country{Country: n.name, Clicks: n.clicks})
 	}
-
-	// Get top browsers
-	rows, err = database.DB.Query(`
-		SELECT browser, COUNT(*) as clicks 
-		FROM clicks 
-		WHERE url_id = $1 AND browser IS NOT NULL 
-		GROUP BY browser 
-		ORDER BY clicks DESC 
-		LIMIT 5
-	`, id)
-	if err != nil {
-		rows = nil
+	var topDevices []models.Device
+	for _, n := range topClicks(breakdown.devices, q.top) {
+		topDevices = append(topDevices, models.Device{Device: n.name, Clicks: n.clicks})
 	}
-
 	var topBrowsers []models.Browser
-	if rows != nil {
-		defer rows.Close()
-		for rows.Next() {
-			var browser models.Browser
-			rows.Scan(&browser.Browser, &browser.Clicks)
-			topBrowsers = append(topBrowsers, browser)
-		}
+	for _, n := range topClicks(breakdown.browsers, q.top) {
+		topBrowsers = append(topBrowsers, models.Browser{Browser: n.name, Clicks: n.clicks})
 	}
 
-	// Get click timeline (last 30 days)
-	rows, err = database.DB.Query(`
-		SELECT DATE(clicked_at) as date, COUNT(*) as clicks 
-		FROM clicks 
-		WHERE url_id = $1 AND clicked_at >= NOW() - INTERVAL '30 days'
-		GROUP BY DATE(clicked_at) 
-		ORDER BY date DESC
-	`, id)
+	// Get click timeline, with the unique visitors of each bucket
+	visitors, err := loadVisitorTimeline(reqCtx, id, q, watermark)
 	if err != nil {
-		rows = nil
+		slog.WarnContext(reqCtx, "failed to load visitor timeline", "url_id", id, "error", err)
+		visitors = nil
+	}
+	timeline, err := loadClickTimeline(reqCtx, id, q, watermark, visitors)
+	if err != nil {
+		slog.ErrorContext(reqCtx, "failed to load click timeline", "url_id", id, "error", err)
+		errorResponse(c, http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
 	}
 
-	var timeline []models.Timeline
-	if rows != nil {
-		defer rows.Close()
-		for rows.Next() {
-			var t models.Timeline
-			rows.Scan(&t.Date, &t.Clicks)
-			timeline = append(timeline, t)
-		}
+	// Get clicks per revision
+	byRevision, err := loadRevisionClicks(reqCtx, id, breakdown)
+	if err != nil {
+		byRevision = nil
 	}
 
 	// Get last clicked at
 	var lastClickedAt *time.Time
-	err = database.DB.QueryRow("SELECT MAX(clicked_at) FROM clicks WHERE url_id = $1", id).Scan(&lastClickedAt)
+	query = "SELECT MAX(clicked_at) FROM clicks WHERE url_id = $1"
+	ctx, span = startDBSpan(reqCtx, "clicks.last_clicked_at", query)
+	err = database.DB.QueryRowContext(ctx, query, id).Scan(&lastClickedAt)
+	endSpan(span, err)
 	if err != nil {
 		lastClickedAt = nil
 	}
 
 	analytics := models.Analytics{
-		URLID:         url.ID,
-		TotalClicks:   url.ClickCount,
-		UniqueClicks:  uniqueClicks,
-		TopCountries:  topCountries,
-		TopDevices:    topDevices,
-		TopBrowsers:   topBrowsers,
-		ClickTimeline: timeline,
-		LastClickedAt: lastClickedAt,
+		URLID:            url.ID,
+		From:             q.From.In(q.Location),
+		To:               q.To.In(q.Location),
+		Granularity:      string(q.Granularity),
+		Timezone:         q.Location.String(),
+		TotalClicks:      url.ClickCount,
+		PeriodClicks:     breakdown.total,
+		UniqueClicks:     uniqueClicks,
+		TopCountries:     topCountries,
+		TopDevices:       topDevices,
+		TopBrowsers:      topBrowsers,
+		ClickTimeline:    timeline,
+		ClicksByRevision: byRevision,
+		ClicksBySource:   clicksBySource(breakdown.sources),
+		TopReferrers:     topReferrers(breakdown, q.top),
+		ReferrerTypes:    referrerTypes(breakdown.referrerTypes),
+		TopUTMSources:    topUTM(breakdown.utmSources, q.top),
+		TopUTMMediums:    topUTM(breakdown.utmMediums, q.top),
+		TopUTMCampaigns:  topUTM(breakdown.utmCampaigns, q.top),
+		LastClickedAt:    lastClickedAt,
 	}
 
 	c.JSON(http.StatusOK, gin.H{"data": analytics})
@@ -453,27 +419,38 @@ func GetURLAnalytics(c *gin.Context) {
 
 // GetAllAnalytics gets analytics for all URLs
 func GetAllAnalytics(c *gin.Context) {
+	reqCtx := c.Request.Context()
+
 	// Get total clicks
 	var totalClicks int64
-	err := database.DB.QueryRow("SELECT SUM(click_count) FROM urls").Scan(&totalClicks)
+	query := "SELECT SUM(click_count) FROM urls WHERE deleted_at IS NULL"
+	ctx, span := startDBSpan(reqCtx, "urls.sum_click_count", query)
+	err := database.DB.QueryRowContext(ctx, query).Scan(&totalClicks)
+	endSpan(span, err)
 	if err != nil {
 		totalClicks = 0
 	}
 
 	// Get total URLs
 	var totalURLs int64
-	err = database.DB.QueryRow("SELECT COUNT(*) FROM urls").Scan(&totalURLs)
+	query = "SELECT COUNT(*) FROM urls WHERE deleted_at IS NULL"
+	ctx, span = startDBSpan(reqCtx, "urls.count", query)
+	err = database.DB.QueryRowContext(ctx, query).Scan(&totalURLs)
+	endSpan(span, err)
 	if err != nil {
 		totalURLs = 0
 	}
 
 	// Get top performing URLs
-	rows, err := database.DB.Query(`
+	query = `
 		SELECT id, original_url, short_code, custom_code, click_count 
 		FROM urls 
+		WHERE deleted_at IS NULL
 		ORDER BY click_count DESC 
 		LIMIT 10
-	`)
+	`
+	ctx, span = startDBSpan(reqCtx, "urls.top_by_clicks", query)
+	rows, err := database.DB.QueryContext(ctx, query)
 	if err != nil {
 		rows = nil
 	}
@@ -499,7 +476,9 @@ func GetAllAnalytics(c *gin.Context) {
 				"click_count":  clickCount,
 			})
 		}
+		err = rows.Err()
 	}
+	endSpan(span, err)
 
 	c.JSON(http.StatusOK, gin.H{
 		"data": gin.H{
@@ -512,33 +491,295 @@ func GetAllAnalytics(c *gin.Context) {
 
 // Helper functions
 
-func recordClick(urlID string, c *gin.Context) {
+// clickRecordTimeout bounds how long a background click insert may take
+const clickRecordTimeout = 5 * time.Second
+
+func newClick(url models.URL, c *gin.Context) models.Click {
 	click := models.Click{
 		ID:        uuid.New().String(),
-		URLID:     urlID,
+		URLID:     url.ID,
+		Revision:  url.Revision,
 		IPAddress: c.ClientIP(),
 		UserAgent: c.GetHeader("User-Agent"),
 		Referer:   getStringPtr(c.GetHeader("Referer")),
+		Source:    clickSource(c),
 		ClickedAt: time.Now(),
 	}
+	attributeClick(&click, c.Request.URL.Query(), url.OriginalURL)
+	return click
+}
+
+// clickSource tells a visit from a scanned QR code, whose URL carries the
+// source marker, from any other visit
+func clickSource(c *gin.Context) string {
+	if c.Query(qrSourceParam) == models.ClickSourceQR {
+		return models.ClickSourceQR
+	}
+	return models.ClickSourceLink
+}
+
+// clicksBySource lists the click counts of every source, including those
+// without clicks, followed by any other recorded source
+func clicksBySource(counts map[string]int64) []models.SourceClicks {
+	sources := []models.SourceClicks{
+		{Source: models.ClickSourceLink, Clicks: counts[models.ClickSourceLink]},
+		{Source: models.ClickSourceQR, Clicks: counts[models.ClickSourceQR]},
+	}
+	var others []string
+	for source := range counts {
+		if source != models.ClickSourceLink && source != models.ClickSourceQR {
+			others = append(others, source)
+		}
+	}
+	sort.Strings(others)
+	for _, source := range others {
+		sources = append(sources, models.SourceClicks{Source: source, Clicks: counts[source]})
+	}
+	return sources
+}
+
+func recordClick(ctx context.Context, click models.Click) {
+	ctx, span := tracer.Start(ctx, "click.record", trace.WithAttributes(
+		attribute.String("url.id", click.URLID),
+	))
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, clickRecordTimeout)
+	defer cancel()
 
 	// TODO: Add geolocation and device detection
 	// For now, we'll store basic information
+	identifyVisitor(ctx, &click)
+
+	query := `
+		INSERT INTO clicks (id, url_id, ip_address, user_agent, referer, revision, source,
+			referrer_domain, referrer_type, utm_source, utm_medium, utm_campaign, visitor_id, clicked_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+	`
+	ctx, dbSpan := startDBSpan(ctx, "clicks.insert", query)
+	_, err := database.DB.ExecContext(ctx, query, click.ID, click.URLID, getStringPtr(click.IPAddress), click.UserAgent, click.Referer, click.Revision, click.Source,
+		click.ReferrerDomain, click.ReferrerType, click.UTMSource, click.UTMMedium, click.UTMCampaign, click.VisitorID, click.ClickedAt)
+	endSpan(dbSpan, err)
+
+	if err != nil {
+		span.SetStatus(codes.Error, "failed to record click")
+		slog.ErrorContext(ctx, "failed to record click", "url_id", click.URLID, "error", err)
+	}
+}
+
+// lockURL loads a link that is not in the trash and locks its row for the
+// rest of the transaction
+func lockURL(ctx context.Context, tx *sql.Tx, id string) (models.URL, error) {
+	return lockURLRow(ctx, tx, id, false)
+}
 
-	_, err := database.DB.Exec(`
-		INSERT INTO clicks (id, url_id, ip_address, user_agent, referer, clicked_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
-	`, click.ID, click.URLID, click.IPAddress, click.UserAgent, click.Referer, click.ClickedAt)
+// lockDeletedURL loads a link in the trash and locks its row for the rest
+// of the transaction
+func lockDeletedURL(ctx context.Context, tx *sql.Tx, id string) (models.URL, error) {
+	return lockURLRow(ctx, tx, id, true)
+}
+
+func lockURLRow(ctx context.Context, tx *sql.Tx, id string, deleted bool) (models.URL, error) {
+	var url models.URL
+	if _, err := uuid.Parse(id); err != nil {
+		return url, errLinkNotFound
+	}
+	err := tx.QueryRowContext(ctx, `
+		SELECT id, original_url, short_code, custom_code, title, description, user_id, host(creator_ip), is_active,
+			expires_at, click_count, created_at, updated_at, disabled_reason, disabled_at, screened_at, deleted_at, revision
+		FROM urls WHERE id = $1 AND (deleted_at IS NOT NULL) = $2 FOR UPDATE
+	`, id, deleted).Scan(&url.ID, &url.OriginalURL, &url.ShortCode, &url.CustomCode, &url.Title, &url.Description, &url.UserID, &url.CreatorIP, &url.IsActive,
+		&url.ExpiresAt, &url.ClickCount, &url.CreatedAt, &url.UpdatedAt, &url.DisabledReason, &url.DisabledAt, &url.ScreenedAt, &url.DeletedAt, &url.Revision)
+	if err == sql.ErrNoRows {
+		return url, errLinkNotFound
+	}
+	return url, err
+}
 
+// parseCreateRequest reads and validates the fields of a create request,
+// checking custom codes with checkCode. Empty strings are treated as absent.
+func parseCreateRequest(rawData map[string]interface{}, checkCode func(string) *apiError) (models.CreateURLRequest, *apiError) {
+	var req models.CreateURLRequest
+
+	// Extract and validate original URL
+	if originalURL, ok := rawData["original_url"].(string); ok && originalURL != "" {
+		// Basic URL validation
+		if !strings.HasPrefix(originalURL, "http://") && !strings.HasPrefix(originalURL, "https://") {
+			return req, &apiError{status: http.StatusBadRequest, body: gin.H{
+				"error": "URL must start with http:// or https://",
+			}}
+		}
+		req.OriginalURL = originalURL
+	} else {
+		return req, &apiError{status: http.StatusBadRequest, body: gin.H{
+			"error": "Original URL is required",
+		}}
+	}
+
+	// Extract optional fields
+	if customCode, ok := rawData["custom_code"].(string); ok && customCode != "" {
+		req.CustomCode = &customCode
+	}
+
+	if title, ok := rawData["title"].(string); ok && title != "" {
+		req.Title = &title
+	}
+
+	if description, ok := rawData["description"].(string); ok && description != "" {
+		req.Description = &description
+	}
+
+	// Handle expires_at field
+	if expiresAtStr, ok := rawData["expires_at"].(string); ok && expiresAtStr != "" {
+		expiresAt, err := time.Parse(time.RFC3339, expiresAtStr)
+		if err != nil {
+			return req, &apiError{status: http.StatusBadRequest, body: gin.H{
+				"error":   "Invalid expires_at format",
+				"details": "Expected ISO 8601 format (e.g., 2024-01-01T12:00:00Z)",
+			}}
+		}
+		req.ExpiresAt = &expiresAt
+	}
+
+	// Validate custom code if provided
+	if req.CustomCode != nil {
+		if apiErr := checkCode(*req.CustomCode); apiErr != nil {
+			return req, apiErr
+		}
+	}
+
+	return req, nil
+}
+
+// validateCustomCode applies the format rule for codes chosen at creation
+func validateCustomCode(customCode string) *apiError {
+	if len(customCode) < 3 || len(customCode) > 50 {
+		return &apiError{status: http.StatusBadRequest, body: gin.H{
+			"error": "Custom code must be between 3 and 50 characters",
+		}}
+	}
+
+	// Validate custom code format (alphanumeric and hyphens only)
+	for _, char := range customCode {
+		if !((char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9') || char == '-') {
+			return &apiError{status: http.StatusBadRequest, body: gin.H{
+				"error": "Custom code can only contain letters, numbers, and hyphens",
+			}}
+		}
+	}
+	return nil
+}
+
+// checkBanned rejects requests from banned users and IP addresses
+func checkBanned(c *gin.Context) *apiError {
+	banned, err := isBanned(c.Request.Context(), c.GetString(middleware.UserIDKey), c.ClientIP())
 	if err != nil {
-		fmt.Printf("Failed to record click: %v\n", err)
+		slog.ErrorContext(c.Request.Context(), "failed to check bans", "error", err)
+		return &apiError{status: http.StatusInternalServerError, body: gin.H{"error": "Database error"}}
+	}
+	if banned {
+		return &apiError{status: http.StatusForbidden, body: gin.H{
+			"error": "You are not allowed to create links",
+			"code":  "banned",
+		}}
 	}
+	return nil
+}
+
+// lookupCodeStatus reports the availability of a custom code
+var lookupCodeStatus = customCodeStatus
+
+// checkCustomCode rejects custom codes that are in use. Codes of deleted
+// links cannot be claimed until the link is purged and its cooldown has
+// passed.
+func checkCustomCode(ctx context.Context, customCode string) *apiError {
+	status, err := lookupCodeStatus(ctx, customCode)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to check custom code", "error", err)
+		return &apiError{status: http.StatusInternalServerError, body: gin.H{"error": "Database error"}}
+	}
+	switch status {
+	case codeTaken:
+		return customCodeTakenError()
+	case codeRecentlyDeleted:
+		return &apiError{status: http.StatusConflict, body: gin.H{
+			"error": "Custom code belonged to a recently deleted link and cannot be reused yet",
+			"code":  "code_recently_deleted",
+		}}
+	}
+	return nil
+}
+
+// customCodeTakenError is the error for a custom code used by another link
+func customCodeTakenError() *apiError {
+	return &apiError{status: http.StatusConflict, body: gin.H{"error": "Custom code already exists", "code": "code_taken"}}
+}
+
+// newURLFromRequest builds a link from a validated create request
+func newURLFromRequest(c *gin.Context, req models.CreateURLRequest, screenedAt *time.Time) *models.URL {
+	url := models.NewURL(req.OriginalURL, req.CustomCode)
+	url.Title = req.Title
+	url.Description = req.Description
+	url.ExpiresAt = req.ExpiresAt
+	url.ScreenedAt = screenedAt
+	url.UserID = getStringPtr(c.GetString(middleware.UserIDKey))
+	url.CreatorIP = getStringPtr(c.ClientIP())
+	return url
+}
+
+// insertURL stores a new link with its first revision and audit entry
+func insertURL(c *gin.Context, tx *sql.Tx, url *models.URL) error {
+	query := `
+		INSERT INTO urls (id, original_url, short_code, custom_code, title, description, expires_at, created_at, updated_at, screened_at, user_id, creator_ip, click_count)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	`
+	ctx, span := startDBSpan(c.Request.Context(), "urls.insert", query)
+	_, err := tx.ExecContext(ctx, query, url.ID, url.OriginalURL, url.ShortCode, url.CustomCode, url.Title, url.Description, url.ExpiresAt, url.CreatedAt, url.UpdatedAt, url.ScreenedAt, url.UserID, url.CreatorIP, url.ClickCount)
+	endSpan(span, err)
+	if err != nil {
+		return err
+	}
+	if err := insertRevision(c.Request.Context(), tx, *url, middleware.RequestActor(c)); err != nil {
+		return err
+	}
+	return recordAudit(c, tx, audit.ActionCreate, audit.TargetURL, url.ID, nil, url)
+}
+
+// customCodeConstraint is the unique constraint on urls.custom_code
+const customCodeConstraint = "urls_custom_code_key"
+
+// isUniqueViolation reports whether err violates the named unique
+// constraint, e.g. a custom code claimed by a concurrent request
+func isUniqueViolation(err error, constraint string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == constraint
+}
+
+// apiError is an error response that has not been written yet, so checks
+// can be shared by endpoints that report errors differently
+type apiError struct {
+	status int
+	body   gin.H
+}
+
+// write sends the error response
+func (e *apiError) write(c *gin.Context) {
+	errorResponse(c, e.status, e.body)
+}
+
+// errorResponse writes a JSON error body that includes the request ID, so
+// clients can quote it when reporting problems
+func errorResponse(c *gin.Context, status int, body gin.H) {
+	if requestID := logging.RequestIDFromContext(c.Request.Context()); requestID != "" {
+		body["request_id"] = requestID
+	}
+	c.JSON(status, body)
 }
 
 func getBaseURL(c *gin.Context) string {
-	// Check if APP_URL is set in environment
-	if appURL := os.Getenv("APP_URL"); appURL != "" {
-		return appURL
+	// Prefer the configured public URL
+	if appURL := appConfig.Server.AppURL; appURL != "" {
+		return strings.TrimRight(appURL, "/")
 	}
 	
 	// Fallback to request host
@@ -563,4 +804,4 @@ func getStringPtr(s string) *string {
 		return nil
 	}
 	return &s
-} 
\ No newline at end of file
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"url-shortener/analytics"
+	"url-shortener/database"
+	"url-shortener/models"
+)
+
+// visitorSaltSize is the length of the daily visitor ID salts
+const visitorSaltSize = 32
+
+// saltCache keeps the visitor ID salt of the latest day seen, so only the
+// first click of a day loads it
+type saltCache struct {
+	mu   sync.Mutex
+	day  time.Time
+	salt []byte
+	load func(ctx context.Context, day time.Time) ([]byte, error)
+}
+
+// visitorSalts provides the salts visitor IDs are hashed with
+var visitorSalts = &saltCache{load: loadVisitorSalt}
+
+// get returns the salt of the UTC day t falls in
+func (s *saltCache) get(ctx context.Context, t time.Time) ([]byte, error) {
+	day := t.UTC().Truncate(24 * time.Hour)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if day.Equal(s.day) {
+		return s.salt, nil
+	}
+	salt, err := s.load(ctx, day)
+	if err != nil {
+		return nil, err
+	}
+	// Clicks recorded just after midnight may still belong to the day
+	// before; they must not evict the current day's salt
+	if day.After(s.day) {
+		s.day, s.salt = day, salt
+	}
+	return salt, nil
+}
+
+// loadVisitorSalt returns the salt of a day, creating it on the first
+// click of the day. Salts are shared by replicas through the database and
+// deleted once their day and the next are over, after which the visitor
+// IDs hashed with them can no longer be recomputed from an address.
+func loadVisitorSalt(ctx context.Context, day time.Time) ([]byte, error) {
+	salt := make([]byte, visitorSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate visitor salt: %v", err)
+	}
+	date := day.Format("2006-01-02")
+
+	query := "INSERT INTO visitor_salts (day, salt) VALUES ($1, $2) ON CONFLICT (day) DO NOTHING"
+	spanCtx, span := startDBSpan(ctx, "visitor_salts.insert", query)
+	_, err := database.DB.ExecContext(spanCtx, query, date, salt)
+	endSpan(span, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create visitor salt: %v", err)
+	}
+
+	// Another replica may have created the day's salt first
+	query = "SELECT salt FROM visitor_salts WHERE day = $1"
+	spanCtx, span = startDBSpan(ctx, "visitor_salts.get", query)
+	err = database.DB.QueryRowContext(spanCtx, query, date).Scan(&salt)
+	endSpan(span, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load visitor salt: %v", err)
+	}
+
+	query = "DELETE FROM visitor_salts WHERE day < $1"
+	spanCtx, span = startDBSpan(ctx, "visitor_salts.delete_expired", query)
+	_, err = database.DB.ExecContext(spanCtx, query, day.AddDate(0, 0, -1).Format("2006-01-02"))
+	endSpan(span, err)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to delete expired visitor salts", "error", err)
+	}
+	return salt, nil
+}
+
+// identifyVisitor sets a click's visitor ID from its full IP address and
+// user agent, then reduces the stored address as configured. Without a
+// salt the click is recorded without a visitor ID.
+func identifyVisitor(ctx context.Context, click *models.Click) {
+	salt, err := visitorSalts.get(ctx, click.ClickedAt)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to identify visitor", "url_id", click.URLID, "error", err)
+	} else {
+		id := analytics.VisitorID(salt, click.IPAddress, click.UserAgent)
+		click.VisitorID = &id
+	}
+	click.IPAddress = storedIP(click.IPAddress, appConfig.Analytics.IPStorage)
+}
+
+// storedIP returns the part of an IP address kept under an IP storage
+// setting, or an empty string if none is. Full addresses are only kept
+// when asked for.
+func storedIP(ip, storage string) string {
+	switch storage {
+	case "full":
+		return ip
+	case "none":
+		return ""
+	default:
+		return analytics.TruncateIP(ip)
+	}
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaltCache(t *testing.T) {
+	var loads []string
+	cache := &saltCache{load: func(ctx context.Context, day time.Time) ([]byte, error) {
+		loads = append(loads, day.Format("2006-01-02"))
+		if day.Year() == 2000 {
+			return nil, errors.New("unavailable")
+		}
+		return []byte(day.Format("2006-01-02")), nil
+	}}
+	ctx := context.Background()
+	at := func(day, hour int) time.Time { return time.Date(2024, 5, day, hour, 0, 0, 0, time.UTC) }
+
+	salt, err := cache.get(ctx, at(1, 9))
+	require.NoError(t, err)
+	assert.Equal(t, "2024-05-01", string(salt))
+	salt, err = cache.get(ctx, at(1, 23))
+	require.NoError(t, err)
+	assert.Equal(t, "2024-05-01", string(salt))
+	assert.Equal(t, []string{"2024-05-01"}, loads)
+
+	// A late click from the day before does not evict the current salt
+	_, err = cache.get(ctx, at(2, 0))
+	require.NoError(t, err)
+	salt, err = cache.get(ctx, at(1, 23))
+	require.NoError(t, err)
+	assert.Equal(t, "2024-05-01", string(salt))
+	salt, err = cache.get(ctx, at(2, 1))
+	require.NoError(t, err)
+	assert.Equal(t, "2024-05-02", string(salt))
+	assert.Equal(t, []string{"2024-05-01", "2024-05-02", "2024-05-01"}, loads)
+
+	_, err = cache.get(ctx, time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC))
+	assert.Error(t, err)
+}
+
+func TestStoredIP(t *testing.T) {
+	assert.Equal(t, "203.0.113.42", storedIP("203.0.113.42", "full"))
+	assert.Equal(t, "203.0.113.0", storedIP("203.0.113.42", "truncated"))
+	assert.Equal(t, "2001:db8:1::", storedIP("2001:db8:1:2::42", "truncated"))
+	assert.Equal(t, "", storedIP("203.0.113.42", "none"))
+	assert.Equal(t, "203.0.113.0", storedIP("203.0.113.42", ""), "addresses are truncated unless full storage is chosen")
+}
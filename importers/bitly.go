@@ -0,0 +1,105 @@
+package importers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// bitlyColumns lists the header names used for each field across Bitly's
+// export formats, normalized by normalizeHeader
+var bitlyColumns = map[string][]string{
+	"url":     {"long url", "destination", "destination url", "original url", "url"},
+	"link":    {"bitlink", "link", "short link", "short url", "id"},
+	"title":   {"title"},
+	"created": {"created", "created at", "date created", "creation date", "created date"},
+	"clicks":  {"clicks", "total clicks", "click count"},
+}
+
+// BitlyReader reads links from a Bitly CSV export
+type BitlyReader struct {
+	csv     *csv.Reader
+	columns map[string]int
+}
+
+// NewBitlyReader reads the header of a Bitly CSV export. The export must
+// have a long URL and a bitlink column; title, creation date and clicks
+// are read when present.
+func NewBitlyReader(r io.Reader) (*BitlyReader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.New("Bitly export must start with a header row")
+	}
+
+	indexes := make(map[string]int, len(header))
+	for i, name := range header {
+		name = normalizeHeader(name)
+		if _, dup := indexes[name]; !dup {
+			indexes[name] = i
+		}
+	}
+	columns := make(map[string]int)
+	for field, names := range bitlyColumns {
+		for _, name := range names {
+			if index, ok := indexes[name]; ok {
+				columns[field] = index
+				break
+			}
+		}
+	}
+	for _, field := range []string{"url", "link"} {
+		if _, ok := columns[field]; !ok {
+			return nil, fmt.Errorf("Bitly export has no %s column (expected one of %s)", field, strings.Join(bitlyColumns[field], ", "))
+		}
+	}
+	return &BitlyReader{csv: reader, columns: columns}, nil
+}
+
+// Next returns the next link of the export
+func (b *BitlyReader) Next() (Link, error) {
+	record, err := b.csv.Read()
+	if err != nil {
+		return Link{}, err
+	}
+	line, _ := b.csv.FieldPos(0)
+	value := func(field string) string {
+		if index, ok := b.columns[field]; ok && index < len(record) {
+			return strings.TrimSpace(record[index])
+		}
+		return ""
+	}
+
+	link := Link{
+		Line:  line,
+		Code:  codeFromShortURL(value("link")),
+		URL:   value("url"),
+		Title: truncateTitle(value("title")),
+	}
+	if link.Code == "" {
+		return link, &RowError{Line: line, Err: "bitlink is missing"}
+	}
+	if created := value("created"); created != "" {
+		t, err := ParseTime(created)
+		if err != nil {
+			return link, &RowError{Line: line, Err: err.Error()}
+		}
+		link.CreatedAt = &t
+	}
+	if link.Clicks, err = parseClicks(value("clicks")); err != nil {
+		return link, &RowError{Line: line, Err: err.Error()}
+	}
+	return link, nil
+}
+
+// normalizeHeader lowercases a header name and treats underscores and
+// hyphens as spaces
+func normalizeHeader(name string) string {
+	name = strings.TrimPrefix(name, "\ufeff")
+	name = strings.NewReplacer("_", " ", "-", " ").Replace(strings.ToLower(name))
+	return strings.Join(strings.Fields(name), " ")
+}
@@ -0,0 +1,116 @@
+// Package importers reads the link exports of other URL shorteners so they
+// can be migrated. Readers stream their input and return one link at a
+// time, so exports of any size can be imported.
+package importers
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxTitleLength is the longest title a link can store
+const maxTitleLength = 255
+
+// Link is a link read from another shortener's export
+type Link struct {
+	// Line locates the link in the export: the line of a CSV row or SQL
+	// tuple, or the 1-based position of a JSON entry
+	Line      int
+	Code      string
+	URL       string
+	Title     string
+	CreatedAt *time.Time
+	Clicks    int64
+}
+
+// Reader returns the links of an export one at a time. Next returns io.EOF
+// after the last link, and a *RowError for a link that cannot be read but
+// after which reading can continue. Any other error is fatal.
+type Reader interface {
+	Next() (Link, error)
+}
+
+// RowError reports a malformed link in an export
+type RowError struct {
+	Line int
+	Err  string
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+// timeLayouts are the date formats found in shortener exports. Times
+// without a zone are read as UTC.
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05 -0700 MST",
+	"2006-01-02 15:04:05-07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"1/2/2006 15:04:05",
+	"1/2/2006 15:04",
+	"1/2/2006",
+}
+
+// ParseTime reads a date in one of the formats used by shortener exports,
+// or a Unix timestamp in seconds
+func ParseTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.UTC); err == nil {
+			return t, nil
+		}
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil && seconds > 0 {
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("unrecognized date %q", value)
+}
+
+// parseClicks reads a click total, which may use thousands separators
+func parseClicks(value string) (int64, error) {
+	value = strings.NewReplacer(",", "", " ", "", "_", "").Replace(strings.TrimSpace(value))
+	if value == "" {
+		return 0, nil
+	}
+	clicks, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || clicks < 0 {
+		return 0, fmt.Errorf("invalid click count %q", value)
+	}
+	return clicks, nil
+}
+
+// codeFromShortURL returns the code of a short link given as a full URL
+// ("https://bit.ly/abc"), a URL without scheme ("bit.ly/abc") or a bare
+// code
+func codeFromShortURL(shortURL string) string {
+	shortURL = strings.TrimSpace(shortURL)
+	if !strings.Contains(shortURL, "://") {
+		shortURL = "https://" + shortURL
+	}
+	u, err := url.Parse(shortURL)
+	if err != nil {
+		return ""
+	}
+	if u.Path == "" || u.Path == "/" {
+		// A bare code parses as the host
+		return u.Host
+	}
+	return strings.Trim(u.Path, "/")
+}
+
+// truncateTitle shortens titles that are too long to store
+func truncateTitle(title string) string {
+	title = strings.TrimSpace(title)
+	if utf8.RuneCountInString(title) <= maxTitleLength {
+		return title
+	}
+	return string([]rune(title)[:maxTitleLength])
+}
@@ -0,0 +1,179 @@
+package importers
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readAll returns the links of an export and the lines of its row errors
+func readAll(t *testing.T, reader Reader) ([]Link, []int) {
+	t.Helper()
+	var links []Link
+	var errLines []int
+	for {
+		link, err := reader.Next()
+		if err == io.EOF {
+			return links, errLines
+		}
+		var rowErr *RowError
+		if errors.As(err, &rowErr) {
+			errLines = append(errLines, rowErr.Line)
+			continue
+		}
+		require.NoError(t, err)
+		links = append(links, link)
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	want := time.Date(2021, 3, 4, 10, 11, 12, 0, time.UTC)
+	for _, value := range []string{"2021-03-04T10:11:12Z", "2021-03-04T10:11:12+0000", "2021-03-04 10:11:12", "2021-03-04T12:11:12+02:00", "1614852672"} {
+		got, err := ParseTime(value)
+		require.NoError(t, err, value)
+		assert.True(t, want.Equal(got), value)
+	}
+
+	got, err := ParseTime("3/4/2021")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC), got)
+
+	_, err = ParseTime("yesterday")
+	assert.Error(t, err)
+}
+
+func TestBitlyReader(t *testing.T) {
+	export := "\ufeffTitle,Bitlink,Long URL,Created,Clicks\n" +
+		"Spring sale,https://bit.ly/3xYzAbc,https://example.com/sale,2021-03-04 10:11:12,\"1,204\"\n" +
+		"Branded,brand.co/launch,https://example.com/launch,,\n" +
+		"Bad date,bit.ly/abc1234,https://example.com,someday,3\n" +
+		"No link,,https://example.com,,\n"
+
+	reader, err := NewBitlyReader(strings.NewReader(export))
+	require.NoError(t, err)
+	links, errLines := readAll(t, reader)
+
+	require.Len(t, links, 2)
+	assert.Equal(t, "3xYzAbc", links[0].Code)
+	assert.Equal(t, "https://example.com/sale", links[0].URL)
+	assert.Equal(t, "Spring sale", links[0].Title)
+	assert.Equal(t, int64(1204), links[0].Clicks)
+	require.NotNil(t, links[0].CreatedAt)
+	assert.Equal(t, time.Date(2021, 3, 4, 10, 11, 12, 0, time.UTC), *links[0].CreatedAt)
+	assert.Equal(t, 2, links[0].Line)
+
+	assert.Equal(t, "launch", links[1].Code)
+	assert.Nil(t, links[1].CreatedAt)
+	assert.Zero(t, links[1].Clicks)
+
+	assert.Equal(t, []int{4, 5}, errLines)
+}
+
+func TestBitlyReaderRequiresColumns(t *testing.T) {
+	_, err := NewBitlyReader(strings.NewReader("title,long_url\n"))
+	assert.ErrorContains(t, err, "no link column")
+
+	_, err = NewBitlyReader(strings.NewReader(""))
+	assert.ErrorContains(t, err, "header row")
+}
+
+func TestYOURLSSQLReader(t *testing.T) {
+	dump := `-- MySQL dump 10.13
+/*!40101 SET NAMES utf8mb4 */;
+CREATE TABLE ` + "`yourls_url`" + ` (
+  ` + "`keyword`" + ` varchar(100) NOT NULL,
+  ` + "`url`" + ` text NOT NULL
+) ENGINE=InnoDB;
+INSERT INTO ` + "`yourls_log`" + ` VALUES (1,'2021-01-01 00:00:00','abc','direct','Mozilla; (x)','127.0.0.1','US');
+INSERT INTO ` + "`yourls_url`" + ` VALUES ('abc','https://example.com/a?x=1&y=2','It\'s \"quoted\"; really','2021-03-04 10:11:12','127.0.0.1',42),
+('def','https://example.com/d',NULL,'0000-00-00 00:00:00','127.0.0.1',0);
+# a comment
+INSERT IGNORE INTO mydb.yourls_url (url, keyword, clicks) VALUES ('https://example.com/g', 'ghi', '7'), ('https://example.com/h', '', 1);
+INSERT INTO yourls_url VALUES ('short','https://example.com','t','2021-01-01 00:00:00','ip');
+`
+	reader, err := NewYOURLSReader(strings.NewReader(dump), "")
+	require.NoError(t, err)
+	links, errLines := readAll(t, reader)
+
+	require.Len(t, links, 3)
+	assert.Equal(t, "abc", links[0].Code)
+	assert.Equal(t, "https://example.com/a?x=1&y=2", links[0].URL)
+	assert.Equal(t, `It's "quoted"; really`, links[0].Title)
+	assert.Equal(t, int64(42), links[0].Clicks)
+	require.NotNil(t, links[0].CreatedAt)
+	assert.Equal(t, 2021, links[0].CreatedAt.Year())
+	assert.Equal(t, 8, links[0].Line)
+
+	assert.Equal(t, "def", links[1].Code)
+	assert.Empty(t, links[1].Title)
+	assert.Nil(t, links[1].CreatedAt)
+	assert.Equal(t, 9, links[1].Line)
+
+	assert.Equal(t, "ghi", links[2].Code)
+	assert.Equal(t, "https://example.com/g", links[2].URL)
+	assert.Equal(t, int64(7), links[2].Clicks)
+
+	// A missing keyword and a tuple with too few values are row errors
+	assert.Equal(t, []int{11, 12}, errLines)
+}
+
+func TestYOURLSSQLReaderTable(t *testing.T) {
+	dump := "INSERT INTO short_url VALUES ('abc','https://example.com','','','',0);\n" +
+		"INSERT INTO links_url VALUES ('def','https://example.org','','','',0);\n"
+	reader, err := NewYOURLSReader(strings.NewReader(dump), "links_url")
+	require.NoError(t, err)
+	links, _ := readAll(t, reader)
+	require.Len(t, links, 1)
+	assert.Equal(t, "def", links[0].Code)
+}
+
+func TestYOURLSSQLReaderMalformed(t *testing.T) {
+	reader, err := NewYOURLSReader(strings.NewReader("INSERT INTO yourls_url VALUES ('abc','https://example.com"), "")
+	require.NoError(t, err)
+	_, err = reader.Next()
+	var rowErr *RowError
+	assert.False(t, errors.As(err, &rowErr))
+	assert.ErrorContains(t, err, "unterminated string")
+}
+
+func TestYOURLSJSONReader(t *testing.T) {
+	export := `{"statusCode": 200, "links": {
+		"link_1": {"shorturl": "https://sho.rt/abc", "url": "https://example.com", "title": "Example", "timestamp": "2021-03-04 10:11:12", "clicks": "12"},
+		"link_2": {"keyword": "def", "url": "https://example.org", "clicks": 3},
+		"link_3": {"url": "https://example.net"},
+		"link_4": "not a link"
+	}}`
+	reader, err := NewYOURLSReader(strings.NewReader(export), "")
+	require.NoError(t, err)
+	links, errLines := readAll(t, reader)
+
+	require.Len(t, links, 2)
+	assert.Equal(t, "abc", links[0].Code)
+	assert.Equal(t, int64(12), links[0].Clicks)
+	require.NotNil(t, links[0].CreatedAt)
+	assert.Equal(t, "def", links[1].Code)
+	assert.Equal(t, int64(3), links[1].Clicks)
+	assert.Equal(t, 2, links[1].Line)
+	assert.Equal(t, []int{3, 4}, errLines)
+
+	reader, err = NewYOURLSReader(strings.NewReader(` [{"keyword": "x1y", "url": "https://example.com"}, {"url": "https://example.org"}]`), "")
+	require.NoError(t, err)
+	links, errLines = readAll(t, reader)
+	require.Len(t, links, 1)
+	assert.Equal(t, "x1y", links[0].Code)
+	assert.Equal(t, []int{2}, errLines)
+
+	_, err = NewYOURLSReader(strings.NewReader(`{"statusCode": 200}`), "")
+	assert.ErrorContains(t, err, `no "links"`)
+}
+
+func TestTruncateTitle(t *testing.T) {
+	assert.Equal(t, "Title", truncateTitle("  Title "))
+	long := strings.Repeat("é", maxTitleLength+10)
+	assert.Len(t, []rune(truncateTitle(long)), maxTitleLength)
+}
@@ -0,0 +1,586 @@
+package importers
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// yourlsColumns is the column order of the YOURLS url table, used when an
+// INSERT statement does not name its columns
+var yourlsColumns = []string{"keyword", "url", "title", "timestamp", "ip", "clicks"}
+
+// NewYOURLSReader reads a YOURLS export, either a SQL dump of the database
+// or a JSON export, telling them apart by the first character. table is
+// the name of the url table in a SQL dump; empty means any table whose
+// name ends in "url", such as the default yourls_url.
+func NewYOURLSReader(r io.Reader, table string) (Reader, error) {
+	br := bufio.NewReader(r)
+	for {
+		ch, _, err := br.ReadRune()
+		if err == io.EOF {
+			return nil, errors.New("YOURLS export is empty")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if ch == '\ufeff' || unicode.IsSpace(ch) {
+			continue
+		}
+		br.UnreadRune()
+		if ch == '[' || ch == '{' {
+			return NewYOURLSJSONReader(br)
+		}
+		return NewYOURLSSQLReader(br, table), nil
+	}
+}
+
+// YOURLSSQLReader reads links from the INSERT statements of a YOURLS SQL
+// dump, as written by mysqldump or phpMyAdmin. Other statements, and
+// inserts into other tables such as the click log, are skipped.
+type YOURLSSQLReader struct {
+	lex     *sqlLexer
+	table   string
+	columns []string
+	// inValues is set while reading the tuples of a url table INSERT
+	inValues bool
+}
+
+// NewYOURLSSQLReader returns a reader for a YOURLS SQL dump
+func NewYOURLSSQLReader(r io.Reader, table string) *YOURLSSQLReader {
+	return &YOURLSSQLReader{lex: newSQLLexer(r), table: strings.ToLower(table)}
+}
+
+// Next returns the link of the next url table row in the dump
+func (y *YOURLSSQLReader) Next() (Link, error) {
+	for !y.inValues {
+		if err := y.nextInsert(); err != nil {
+			return Link{}, err
+		}
+	}
+
+	open, err := y.lex.next()
+	if err != nil {
+		return Link{}, err
+	}
+	if !open.is('(') {
+		return Link{}, fmt.Errorf("line %d: expected ( in VALUES, found %q", open.line, open.text)
+	}
+	var values []*string
+	for {
+		value, err := y.value()
+		if err != nil {
+			return Link{}, err
+		}
+		values = append(values, value)
+		tok, err := y.lex.next()
+		if err != nil {
+			return Link{}, err
+		}
+		if tok.is(')') {
+			break
+		}
+		if !tok.is(',') {
+			return Link{}, fmt.Errorf("line %d: expected , or ) in VALUES, found %q", tok.line, tok.text)
+		}
+	}
+
+	// Tuples are separated by commas and the statement ends with a semicolon
+	tok, err := y.lex.next()
+	switch {
+	case err == io.EOF || (err == nil && tok.is(';')):
+		y.inValues = false
+	case err != nil:
+		return Link{}, err
+	case !tok.is(','):
+		return Link{}, fmt.Errorf("line %d: expected , or ; after VALUES tuple, found %q", tok.line, tok.text)
+	}
+
+	if len(values) != len(y.columns) {
+		return Link{}, &RowError{Line: open.line, Err: fmt.Sprintf("row has %d values for %d columns", len(values), len(y.columns))}
+	}
+	row := make(map[string]string, len(values))
+	for i, column := range y.columns {
+		if values[i] != nil {
+			row[column] = *values[i]
+		}
+	}
+	return yourlsLink(open.line, row["keyword"], row["url"], row["title"], row["timestamp"], row["clicks"])
+}
+
+// nextInsert skips to the next INSERT into the url table and reads its
+// column list
+func (y *YOURLSSQLReader) nextInsert() error {
+	tok, err := y.lex.next()
+	if err != nil {
+		return err
+	}
+	if !tok.isWord("INSERT") && !tok.isWord("REPLACE") {
+		return y.skipStatement(tok)
+	}
+
+	// INSERT [LOW_PRIORITY | DELAYED | HIGH_PRIORITY] [IGNORE] [INTO] table
+	for {
+		if tok, err = y.lex.next(); err != nil {
+			return err
+		}
+		if tok.kind == tokWord && isInsertModifier(tok.text) {
+			continue
+		}
+		break
+	}
+	table := tok.text
+	// A qualified name (database.table) names the table last
+	for {
+		dot, err := y.lex.peek()
+		if err != nil || !dot.is('.') {
+			break
+		}
+		y.lex.next()
+		if tok, err = y.lex.next(); err != nil {
+			return err
+		}
+		table = tok.text
+	}
+	if !y.matchesTable(table) {
+		return y.skipStatement(tok)
+	}
+
+	columns := yourlsColumns
+	if tok, err = y.lex.next(); err != nil {
+		return err
+	}
+	if tok.is('(') {
+		columns = nil
+		for {
+			if tok, err = y.lex.next(); err != nil {
+				return err
+			}
+			if tok.is(')') {
+				break
+			}
+			if tok.is(',') {
+				continue
+			}
+			columns = append(columns, strings.ToLower(tok.text))
+		}
+		if tok, err = y.lex.next(); err != nil {
+			return err
+		}
+	}
+	if !tok.isWord("VALUES") && !tok.isWord("VALUE") {
+		return y.skipStatement(tok)
+	}
+	y.columns = columns
+	y.inValues = true
+	return nil
+}
+
+// matchesTable reports whether an INSERT targets the url table
+func (y *YOURLSSQLReader) matchesTable(table string) bool {
+	table = strings.ToLower(table)
+	if y.table != "" {
+		return table == y.table
+	}
+	return strings.HasSuffix(table, "url")
+}
+
+// skipStatement reads up to the semicolon ending the statement containing
+// tok, without keeping its contents
+func (y *YOURLSSQLReader) skipStatement(tok sqlToken) error {
+	for !tok.is(';') {
+		var err error
+		if tok, err = y.lex.next(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// value reads one value of a VALUES tuple: a string, a number or NULL
+func (y *YOURLSSQLReader) value() (*string, error) {
+	tok, err := y.lex.next()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case tok.kind == tokString:
+		return &tok.text, nil
+	case tok.isWord("NULL"):
+		return nil, nil
+	case tok.is('-') || tok.is('+'):
+		number, err := y.lex.next()
+		if err != nil {
+			return nil, err
+		}
+		text := tok.text + number.text
+		return &text, nil
+	case tok.kind == tokWord:
+		return &tok.text, nil
+	}
+	return nil, fmt.Errorf("line %d: unexpected %q in VALUES", tok.line, tok.text)
+}
+
+func isInsertModifier(word string) bool {
+	switch strings.ToUpper(word) {
+	case "LOW_PRIORITY", "DELAYED", "HIGH_PRIORITY", "IGNORE", "INTO":
+		return true
+	}
+	return false
+}
+
+// YOURLSJSONReader reads links from a YOURLS JSON export: an array of
+// links, or an object whose "links" member is an array of links or an
+// object of links, as returned by the YOURLS API
+type YOURLSJSONReader struct {
+	dec   *json.Decoder
+	keyed bool
+	index int
+}
+
+// yourlsJSONLink is one link of a YOURLS JSON export. Numbers are often
+// exported as strings, so every field accepts either.
+type yourlsJSONLink struct {
+	Keyword   flexString `json:"keyword"`
+	ShortURL  flexString `json:"shorturl"`
+	URL       flexString `json:"url"`
+	Title     flexString `json:"title"`
+	Timestamp flexString `json:"timestamp"`
+	Clicks    flexString `json:"clicks"`
+}
+
+// NewYOURLSJSONReader reads up to the first link of a YOURLS JSON export
+func NewYOURLSJSONReader(r io.Reader) (*YOURLSJSONReader, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	if tok == json.Delim('[') {
+		return &YOURLSJSONReader{dec: dec}, nil
+	}
+	if tok != json.Delim('{') {
+		return nil, errors.New("YOURLS JSON export must be an array or an object")
+	}
+
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON: %v", err)
+		}
+		if key != "links" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return nil, fmt.Errorf("invalid JSON: %v", err)
+			}
+			continue
+		}
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON: %v", err)
+		}
+		switch tok {
+		case json.Delim('['):
+			return &YOURLSJSONReader{dec: dec}, nil
+		case json.Delim('{'):
+			return &YOURLSJSONReader{dec: dec, keyed: true}, nil
+		}
+		return nil, errors.New(`"links" must be an array or an object`)
+	}
+	return nil, errors.New(`YOURLS JSON export has no "links"`)
+}
+
+// Next returns the next link of the export
+func (y *YOURLSJSONReader) Next() (Link, error) {
+	if !y.dec.More() {
+		return Link{}, io.EOF
+	}
+	y.index++
+
+	// The keys of keyed exports are positions ("link_1"), not keywords
+	if y.keyed {
+		if _, err := y.dec.Token(); err != nil {
+			return Link{}, fmt.Errorf("invalid JSON: %v", err)
+		}
+	}
+	var raw json.RawMessage
+	if err := y.dec.Decode(&raw); err != nil {
+		return Link{}, fmt.Errorf("invalid JSON: %v", err)
+	}
+	var entry yourlsJSONLink
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		return Link{}, &RowError{Line: y.index, Err: "link must be an object"}
+	}
+
+	keyword := string(entry.Keyword)
+	if keyword == "" && entry.ShortURL != "" {
+		keyword = codeFromShortURL(string(entry.ShortURL))
+	}
+	return yourlsLink(y.index, keyword, string(entry.URL), string(entry.Title), string(entry.Timestamp), string(entry.Clicks))
+}
+
+// flexString decodes a JSON string or number as a string
+type flexString string
+
+func (f *flexString) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*f = flexString(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	*f = flexString(n.String())
+	return nil
+}
+
+// yourlsLink builds a link from the fields of a YOURLS row
+func yourlsLink(line int, keyword, longURL, title, timestamp, clicks string) (Link, error) {
+	link := Link{
+		Line:  line,
+		Code:  strings.TrimSpace(keyword),
+		URL:   strings.TrimSpace(longURL),
+		Title: truncateTitle(title),
+	}
+	if link.Code == "" {
+		return link, &RowError{Line: line, Err: "keyword is missing"}
+	}
+	// YOURLS writes a zero timestamp when the date is unknown
+	if timestamp = strings.TrimSpace(timestamp); timestamp != "" && !strings.HasPrefix(timestamp, "0000-00-00") {
+		t, err := ParseTime(timestamp)
+		if err != nil {
+			return link, &RowError{Line: line, Err: err.Error()}
+		}
+		link.CreatedAt = &t
+	}
+	var err error
+	if link.Clicks, err = parseClicks(clicks); err != nil {
+		return link, &RowError{Line: line, Err: err.Error()}
+	}
+	return link, nil
+}
+
+type tokenKind int
+
+const (
+	tokWord tokenKind = iota
+	tokString
+	tokPunct
+)
+
+// sqlToken is a word (keyword, number or unquoted identifier), a string
+// literal, a quoted identifier (kept as a word) or a punctuation character
+type sqlToken struct {
+	kind tokenKind
+	text string
+	line int
+}
+
+func (t sqlToken) is(punct rune) bool {
+	return t.kind == tokPunct && t.text == string(punct)
+}
+
+func (t sqlToken) isWord(word string) bool {
+	return t.kind == tokWord && strings.EqualFold(t.text, word)
+}
+
+// sqlLexer splits a MySQL dump into tokens, dropping comments
+type sqlLexer struct {
+	r      *bufio.Reader
+	line   int
+	peeked *sqlToken
+}
+
+func newSQLLexer(r io.Reader) *sqlLexer {
+	return &sqlLexer{r: bufio.NewReader(r), line: 1}
+}
+
+func (l *sqlLexer) peek() (sqlToken, error) {
+	if l.peeked == nil {
+		tok, err := l.next()
+		if err != nil {
+			return tok, err
+		}
+		l.peeked = &tok
+	}
+	return *l.peeked, nil
+}
+
+func (l *sqlLexer) read() (rune, error) {
+	ch, _, err := l.r.ReadRune()
+	if ch == '\n' {
+		l.line++
+	}
+	return ch, err
+}
+
+func (l *sqlLexer) unread(ch rune) {
+	l.r.UnreadRune()
+	if ch == '\n' {
+		l.line--
+	}
+}
+
+func (l *sqlLexer) next() (sqlToken, error) {
+	if l.peeked != nil {
+		tok := *l.peeked
+		l.peeked = nil
+		return tok, nil
+	}
+	for {
+		ch, err := l.read()
+		if err != nil {
+			return sqlToken{}, err
+		}
+		switch {
+		case unicode.IsSpace(ch):
+			continue
+		case ch == '#':
+			if err := l.skipLine(); err != nil {
+				return sqlToken{}, err
+			}
+			continue
+		case ch == '-' || ch == '/':
+			next, err := l.read()
+			if err == nil && ch == '-' && next == '-' {
+				if err := l.skipLine(); err != nil {
+					return sqlToken{}, err
+				}
+				continue
+			}
+			if err == nil && ch == '/' && next == '*' {
+				if err := l.skipBlockComment(); err != nil {
+					return sqlToken{}, err
+				}
+				continue
+			}
+			if err == nil {
+				l.unread(next)
+			}
+			return sqlToken{kind: tokPunct, text: string(ch), line: l.line}, nil
+		case ch == '\'' || ch == '"':
+			line := l.line
+			text, err := l.readQuoted(ch, true)
+			return sqlToken{kind: tokString, text: text, line: line}, err
+		case ch == '`':
+			line := l.line
+			text, err := l.readQuoted(ch, false)
+			return sqlToken{kind: tokWord, text: text, line: line}, err
+		case isWordRune(ch):
+			line := l.line
+			var b strings.Builder
+			b.WriteRune(ch)
+			for {
+				ch, err := l.read()
+				if err != nil {
+					break
+				}
+				if !isWordRune(ch) {
+					l.unread(ch)
+					break
+				}
+				b.WriteRune(ch)
+			}
+			return sqlToken{kind: tokWord, text: b.String(), line: line}, nil
+		default:
+			return sqlToken{kind: tokPunct, text: string(ch), line: l.line}, nil
+		}
+	}
+}
+
+func (l *sqlLexer) skipLine() error {
+	for {
+		ch, err := l.read()
+		if err != nil || ch == '\n' {
+			return err
+		}
+	}
+}
+
+// skipBlockComment skips a /* */ comment, including the /*!40101 ... */
+// version comments of mysqldump, which only hold session settings
+func (l *sqlLexer) skipBlockComment() error {
+	var prev rune
+	for {
+		ch, err := l.read()
+		if err != nil {
+			return err
+		}
+		if prev == '*' && ch == '/' {
+			return nil
+		}
+		prev = ch
+	}
+}
+
+// readQuoted reads a quoted string or identifier up to its closing quote.
+// A doubled quote stands for itself, and in strings a backslash escapes
+// the next character.
+func (l *sqlLexer) readQuoted(quote rune, escapes bool) (string, error) {
+	var b strings.Builder
+	for {
+		ch, err := l.read()
+		if err == io.EOF {
+			return "", fmt.Errorf("line %d: unterminated string", l.line)
+		}
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case ch == quote:
+			next, err := l.read()
+			if err == nil && next == quote {
+				b.WriteRune(quote)
+				continue
+			}
+			if err == nil {
+				l.unread(next)
+			}
+			return b.String(), nil
+		case ch == '\\' && escapes:
+			next, err := l.read()
+			if err != nil {
+				return "", fmt.Errorf("line %d: unterminated string", l.line)
+			}
+			b.WriteString(unescapeMySQL(next))
+		default:
+			b.WriteRune(ch)
+		}
+	}
+}
+
+// unescapeMySQL returns the character a MySQL backslash escape stands for
+func unescapeMySQL(ch rune) string {
+	switch ch {
+	case '0':
+		return "\x00"
+	case 'b':
+		return "\b"
+	case 'n':
+		return "\n"
+	case 'r':
+		return "\r"
+	case 't':
+		return "\t"
+	case 'Z':
+		return "\x1a"
+	case '%', '_':
+		// Kept escaped, as MySQL does, since they only matter in LIKE
+		return "\\" + string(ch)
+	}
+	return string(ch)
+}
+
+func isWordRune(ch rune) bool {
+	return ch == '_' || ch == '$' || unicode.IsLetter(ch) || unicode.IsDigit(ch)
+}
@@ -0,0 +1,30 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Every runs fn immediately and then once per interval until ctx is
+// cancelled. Runs never overlap; errors are logged and the schedule
+// continues.
+func Every(ctx context.Context, name string, interval time.Duration, fn func(context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		start := time.Now()
+		if err := fn(ctx); err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "background job failed", "job", name, "error", err)
+		} else {
+			slog.DebugContext(ctx, "background job finished", "job", name, "duration_ms", time.Since(start).Milliseconds())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"url-shortener/database"
+)
+
+// MaintainClickPartitions creates the monthly clicks partitions for the
+// current month and ahead months after it, and drops the partitions whose
+// clicks are all older than retention. A zero retention keeps raw clicks
+// forever. Partitions are only dropped once every day they cover is in the
+// daily rollups, so analytics for those days are still served from the
+// rollups after their raw clicks are gone. It returns the number of
+// partitions created and dropped.
+func MaintainClickPartitions(ctx context.Context, ahead int, retention time.Duration) (created, dropped int, err error) {
+	now := time.Now().UTC()
+	created, err = database.EnsureClickPartitions(ctx, now, ahead)
+	if err != nil || retention == 0 {
+		return created, 0, err
+	}
+
+	var watermark time.Time
+	err = database.DB.QueryRowContext(ctx, "SELECT watermark FROM analytics_rollup_state WHERE name = $1", ClickRollup).Scan(&watermark)
+	if err == sql.ErrNoRows {
+		// Nothing is rolled up yet, so every raw click is still needed
+		return created, 0, nil
+	}
+	if err != nil {
+		return created, 0, fmt.Errorf("failed to read click rollup watermark: %v", err)
+	}
+
+	// Rollups rebuild the day the watermark is in from raw clicks, so its
+	// clicks are kept until the watermark has passed it
+	cutoff := now.Add(-retention)
+	if rolledUp := watermark.UTC().Truncate(24 * time.Hour); rolledUp.Before(cutoff) {
+		cutoff = rolledUp
+	}
+
+	partitions, err := database.ClickPartitions(ctx)
+	if err != nil {
+		return created, 0, err
+	}
+	for _, p := range database.ExpiredClickPartitions(partitions, cutoff) {
+		if err := database.DropClickPartition(ctx, p.Name); err != nil {
+			return created, dropped, err
+		}
+		dropped++
+	}
+	return created, dropped, nil
+}
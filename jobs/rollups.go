@@ -0,0 +1,126 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"url-shortener/database"
+)
+
+// ClickRollup names the click rollups' row in analytics_rollup_state
+const ClickRollup = "clicks"
+
+// RawReferrerType selects the referrer type of a raw click. Clicks recorded
+// before referrers were classified are direct if they had no referrer and
+// of unknown type otherwise.
+const RawReferrerType = `COALESCE(referrer_type, CASE WHEN COALESCE(referer, '') = '' THEN 'direct' ELSE '' END)`
+
+// RawVisitor selects the visitor of a raw click: its visitor ID, or for
+// clicks recorded before visitor IDs, its IP address
+const RawVisitor = `COALESCE(visitor_id, host(ip_address))`
+
+// rollupBatch is how many hours of clicks one rollup transaction folds in
+const rollupBatch = 24 * time.Hour
+
+// RollupClicks folds the clicks of every hour that ended at least delay
+// ago into the hourly and daily rollups, resuming from the stored
+// watermark a batch of hours at a time. Each batch recomputes its hours,
+// and the days they fall in, from the clicks, so running it again or
+// after an interrupted run gives the same rollups. delay leaves time for
+// clicks that are still being recorded. It returns the new watermark:
+// every click before it is rolled up.
+func RollupClicks(ctx context.Context, delay time.Duration) (time.Time, error) {
+	target := time.Now().UTC().Add(-delay).Truncate(time.Hour)
+
+	// Start from the first click's hour, or from now on an empty database
+	_, err := database.DB.ExecContext(ctx, `
+		INSERT INTO analytics_rollup_state (name, watermark)
+		SELECT $1, COALESCE(date_trunc('hour', MIN(clicked_at)), $2) FROM clicks
+		ON CONFLICT (name) DO NOTHING
+	`, ClickRollup, target)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to initialize click rollups: %v", err)
+	}
+
+	for {
+		watermark, done, err := rollupClickBatch(ctx, target)
+		if err != nil {
+			return watermark, fmt.Errorf("failed to roll up clicks: %v", err)
+		}
+		if done {
+			return watermark, nil
+		}
+	}
+}
+
+// rollupClickBatch rolls up the clicks of up to rollupBatch hours after
+// the watermark, stopping at target. It reports done once the watermark
+// has reached target.
+func rollupClickBatch(ctx context.Context, target time.Time) (watermark time.Time, done bool, err error) {
+	err = database.WithTx(ctx, func(tx *sql.Tx) error {
+		// Locking the state row keeps concurrent runs, such as other
+		// replicas, from rolling up the same hours
+		err := tx.QueryRowContext(ctx, `SELECT watermark FROM analytics_rollup_state WHERE name = $1 FOR UPDATE`, ClickRollup).Scan(&watermark)
+		if err != nil {
+			return err
+		}
+		watermark = watermark.UTC()
+		if !watermark.Before(target) {
+			done = true
+			return nil
+		}
+
+		from, to := watermark, watermark.Add(rollupBatch)
+		if to.After(target) {
+			to = target
+		}
+		// Days are rebuilt whole from the hourly rollups and the day's clicks
+		day := from.Truncate(24 * time.Hour)
+
+		statements := []struct {
+			query string
+			args  []interface{}
+		}{
+			{`DELETE FROM click_rollups_hourly WHERE bucket >= $1 AND bucket < $2`, []interface{}{from, to}},
+			{`
+				INSERT INTO click_rollups_hourly (url_id, bucket, revision, source, country, device, browser,
+					referrer, referrer_type, utm_source, utm_medium, utm_campaign, clicks)
+				SELECT url_id, date_trunc('hour', clicked_at), COALESCE(revision, 1), source,
+					COALESCE(country, ''), COALESCE(device, ''), COALESCE(browser, ''),
+					COALESCE(referrer_domain, ''), ` + RawReferrerType + `,
+					COALESCE(utm_source, ''), COALESCE(utm_medium, ''), COALESCE(utm_campaign, ''), COUNT(*)
+				FROM clicks
+				WHERE clicked_at >= $1 AND clicked_at < $2
+				GROUP BY 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12
+			`, []interface{}{from, to}},
+			{`DELETE FROM click_rollups_daily WHERE bucket >= $1 AND bucket < $2`, []interface{}{day, to}},
+			{`
+				INSERT INTO click_rollups_daily (url_id, bucket, revision, source, country, device, browser,
+					referrer, referrer_type, utm_source, utm_medium, utm_campaign, clicks)
+				SELECT url_id, date_trunc('day', bucket), revision, source, country, device, browser,
+					referrer, referrer_type, utm_source, utm_medium, utm_campaign, SUM(clicks)
+				FROM click_rollups_hourly
+				WHERE bucket >= $1 AND bucket < $2
+				GROUP BY 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12
+			`, []interface{}{day, to}},
+			{`DELETE FROM click_visitors_daily WHERE bucket >= $1 AND bucket < $2`, []interface{}{day, to}},
+			{`
+				INSERT INTO click_visitors_daily (url_id, bucket, visitor)
+				SELECT DISTINCT url_id, date_trunc('day', clicked_at), ` + RawVisitor + `
+				FROM clicks
+				WHERE clicked_at >= $1 AND clicked_at < $2 AND ` + RawVisitor + ` IS NOT NULL
+			`, []interface{}{day, to}},
+			{`UPDATE analytics_rollup_state SET watermark = $2, updated_at = $3 WHERE name = $1`, []interface{}{ClickRollup, to, time.Now()}},
+		}
+		for _, statement := range statements {
+			if _, err := tx.ExecContext(ctx, statement.query, statement.args...); err != nil {
+				return err
+			}
+		}
+		watermark = to
+		return nil
+	})
+	return watermark, done, err
+}
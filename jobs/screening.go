@@ -0,0 +1,133 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+	"url-shortener/audit"
+	"url-shortener/database"
+	"url-shortener/screening"
+)
+
+// screeningActor is recorded in the audit log for links disabled by re-checks
+const screeningActor = "system:screening"
+
+// RecheckLinks screens up to batchSize active links whose last screening
+// is older than maxAge (or that were never screened), oldest first. Links
+// that are now flagged are disabled with the verdict as the reason. It
+// returns the number of links disabled.
+//
+// If the lookup service fails, links flagged by the local blocklists are
+// still disabled but no link is marked as screened, so the batch is retried
+// on the next run.
+func RecheckLinks(ctx context.Context, screener *screening.Screener, batchSize int, maxAge time.Duration) (int, error) {
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT id, original_url FROM urls
+		WHERE is_active = true AND deleted_at IS NULL AND (screened_at IS NULL OR screened_at < $1)
+		ORDER BY screened_at NULLS FIRST
+		LIMIT $2
+	`, time.Now().Add(-maxAge), batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list links to re-check: %v", err)
+	}
+	ids := make(map[string][]string)
+	var urls []string
+	for rows.Next() {
+		var id, originalURL string
+		if err := rows.Scan(&id, &originalURL); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to read link: %v", err)
+		}
+		if _, seen := ids[originalURL]; !seen {
+			urls = append(urls, originalURL)
+		}
+		ids[originalURL] = append(ids[originalURL], id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to list links to re-check: %v", err)
+	}
+	if len(urls) == 0 {
+		return 0, nil
+	}
+
+	verdicts, checkErr := screener.CheckAll(ctx, urls)
+
+	now := time.Now()
+	disabled := 0
+	var screened []string
+	for _, originalURL := range urls {
+		verdict, flagged := verdicts[originalURL]
+		if !flagged {
+			screened = append(screened, ids[originalURL]...)
+			continue
+		}
+		reason := "unsafe destination: " + verdict.Reason()
+		n, err := disableFlaggedLinks(ctx, ids[originalURL], reason, now)
+		if err != nil {
+			return disabled, fmt.Errorf("failed to disable flagged links: %v", err)
+		}
+		disabled += n
+		slog.WarnContext(ctx, "disabled links with unsafe destination",
+			"original_url", originalURL, "url_ids", ids[originalURL], "threat", verdict.Threat, "source", verdict.Source)
+	}
+
+	if checkErr != nil {
+		return disabled, checkErr
+	}
+	if len(screened) > 0 {
+		if _, err := database.DB.ExecContext(ctx, "UPDATE urls SET screened_at = $1 WHERE id = ANY($2)", now, pq.Array(screened)); err != nil {
+			return disabled, fmt.Errorf("failed to record screening time: %v", err)
+		}
+	}
+	return disabled, nil
+}
+
+// disableFlaggedLinks disables the still-active links among ids and records
+// each in the audit log
+func disableFlaggedLinks(ctx context.Context, ids []string, reason string, now time.Time) (int, error) {
+	disabled := 0
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `
+			UPDATE urls SET is_active = false, disabled_reason = $1, disabled_at = $2, screened_at = $2, updated_at = $2
+			WHERE id = ANY($3) AND is_active = true
+			RETURNING id
+		`, reason, now, pq.Array(ids))
+		if err != nil {
+			return err
+		}
+		var updated []string
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			updated = append(updated, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, id := range updated {
+			if err := audit.Record(ctx, tx, audit.Entry{
+				Actor:      screeningActor,
+				Action:     audit.ActionDeactivate,
+				TargetType: audit.TargetURL,
+				TargetID:   id,
+				Before:     map[string]any{"is_active": true},
+				After:      map[string]any{"is_active": false, "disabled_reason": reason, "disabled_at": now},
+			}); err != nil {
+				return err
+			}
+		}
+		disabled = len(updated)
+		return nil
+	})
+	return disabled, err
+}
@@ -0,0 +1,115 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"url-shortener/audit"
+	"url-shortener/database"
+)
+
+// trashActor is recorded in the audit log for links purged from the trash
+const trashActor = "system:trash"
+
+// purgeBatchSize bounds how many links one purge transaction removes
+const purgeBatchSize = 500
+
+// PurgeDeletedLinks permanently removes links that have been in the trash
+// longer than retention, together with their click history. The short and
+// custom codes of purged links are reserved for cooldown so they cannot be
+// claimed straight away by someone else. It returns the number of links
+// purged.
+func PurgeDeletedLinks(ctx context.Context, retention, cooldown time.Duration) (int, error) {
+	now := time.Now()
+	if _, err := database.DB.ExecContext(ctx, "DELETE FROM retired_codes WHERE reserved_until <= $1", now); err != nil {
+		return 0, fmt.Errorf("failed to release retired codes: %v", err)
+	}
+
+	purged := 0
+	for {
+		n, err := purgeBatch(ctx, now.Add(-retention), now.Add(cooldown), now)
+		purged += n
+		if err != nil {
+			return purged, fmt.Errorf("failed to purge deleted links: %v", err)
+		}
+		if n < purgeBatchSize {
+			return purged, nil
+		}
+	}
+}
+
+// purgeBatch deletes up to purgeBatchSize links deleted before cutoff,
+// retiring their codes until reservedUntil
+func purgeBatch(ctx context.Context, cutoff, reservedUntil, now time.Time) (int, error) {
+	purged := 0
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `
+			DELETE FROM urls WHERE id IN (
+				SELECT id FROM urls WHERE deleted_at < $1
+				ORDER BY deleted_at
+				LIMIT $2
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING id, original_url, short_code, custom_code, click_count, deleted_at
+		`, cutoff, purgeBatchSize)
+		if err != nil {
+			return err
+		}
+		type purgedLink struct {
+			id, originalURL, shortCode string
+			customCode                 *string
+			clickCount                 int64
+			deletedAt                  time.Time
+		}
+		var links []purgedLink
+		for rows.Next() {
+			var l purgedLink
+			if err := rows.Scan(&l.id, &l.originalURL, &l.shortCode, &l.customCode, &l.clickCount, &l.deletedAt); err != nil {
+				rows.Close()
+				return err
+			}
+			links = append(links, l)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, l := range links {
+			codes := []string{l.shortCode}
+			if l.customCode != nil {
+				codes = append(codes, *l.customCode)
+			}
+			for _, code := range codes {
+				if _, err := tx.ExecContext(ctx, `
+					INSERT INTO retired_codes (code, url_id, retired_at, reserved_until)
+					VALUES ($1, $2, $3, $4)
+					ON CONFLICT (code) DO UPDATE SET url_id = EXCLUDED.url_id, retired_at = EXCLUDED.retired_at, reserved_until = EXCLUDED.reserved_until
+				`, code, l.id, now, reservedUntil); err != nil {
+					return err
+				}
+			}
+
+			if err := audit.Record(ctx, tx, audit.Entry{
+				Actor:      trashActor,
+				Action:     audit.ActionPurge,
+				TargetType: audit.TargetURL,
+				TargetID:   l.id,
+				Before: map[string]any{
+					"original_url": l.originalURL,
+					"short_code":   l.shortCode,
+					"custom_code":  l.customCode,
+					"click_count":  l.clickCount,
+					"deleted_at":   l.deletedAt,
+				},
+			}); err != nil {
+				return err
+			}
+		}
+		purged = len(links)
+		return nil
+	})
+	return purged, err
+}
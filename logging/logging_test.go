@@ -0,0 +1,57 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestLoggerAddsRequestAndTraceIDs(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := NewLogger(&buf, "info", "json")
+	require.NoError(t, err)
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID,
+		SpanID:  spanID,
+	}))
+	ctx = WithRequestID(ctx, "req-123")
+
+	logger.With("component", "test").InfoContext(ctx, "hello", "url_id", "abc")
+
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "hello", record["msg"])
+	assert.Equal(t, "req-123", record["request_id"])
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", record["trace_id"])
+	assert.Equal(t, "00f067aa0ba902b7", record["span_id"])
+	assert.Equal(t, "test", record["component"])
+	assert.Equal(t, "abc", record["url_id"])
+}
+
+func TestLoggerRespectsLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := NewLogger(&buf, "warn", "text")
+	require.NoError(t, err)
+
+	logger.Info("dropped")
+	assert.Empty(t, buf.String())
+
+	logger.Warn("kept")
+	assert.Contains(t, buf.String(), "msg=kept")
+}
+
+func TestNewLoggerRejectsInvalidOptions(t *testing.T) {
+	_, err := NewLogger(&bytes.Buffer{}, "verbose", "json")
+	assert.Error(t, err)
+
+	_, err = NewLogger(&bytes.Buffer{}, "info", "xml")
+	assert.Error(t, err)
+}
@@ -1,43 +1,119 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"url-shortener/config"
 	"url-shortener/database"
 	"url-shortener/handlers"
+	"url-shortener/jobs"
+	"url-shortener/logging"
 	"url-shortener/middleware"
+	"url-shortener/ratelimit"
+	"url-shortener/screening"
+	"url-shortener/tracing"
 )
 
 func main() {
 	// Load environment variables
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found")
+	envErr := godotenv.Load()
+
+	// Load and validate configuration
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		fatal("Failed to load configuration", err)
+	}
+	handlers.Configure(cfg)
+
+	// Initialize structured logging
+	if err := logging.Setup(cfg.Log.Level, cfg.Log.Format); err != nil {
+		fatal("Failed to initialize logging", err)
+	}
+	if envErr != nil {
+		slog.Info("No .env file found")
+	}
+
+	// Initialize tracing
+	shutdownTracing, err := tracing.InitTracing(context.Background())
+	if err != nil {
+		fatal("Failed to initialize tracing", err)
 	}
 
 	// Initialize database
-	if err := database.InitDatabase(); err != nil {
-		log.Fatal("Failed to initialize database:", err)
+	if err := database.InitDatabase(cfg.Database); err != nil {
+		fatal("Failed to initialize database", err)
 	}
 
 	// Create tables
 	if err := database.CreateTables(); err != nil {
-		log.Fatal("Failed to create tables:", err)
+		fatal("Failed to create tables", err)
 	}
 
-	// Set Gin mode
-	if os.Getenv("GIN_MODE") == "release" {
-		gin.SetMode(gin.ReleaseMode)
+	// Initialize rate limit backend
+	rateLimitStore, err := ratelimit.NewStore(cfg.RateLimit)
+	if err != nil {
+		fatal("Failed to initialize rate limiter", err)
+	}
+
+	// Background jobs run until shutdown
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
+	// Initialize destination URL screening
+	if cfg.Screening.Enabled() {
+		screener, err := newScreener(cfg.Screening)
+		if err != nil {
+			fatal("Failed to initialize URL screening", err)
+		}
+		handlers.ConfigureScreening(screener)
+		startScreeningJobs(jobsCtx, screener, cfg.Screening)
 	}
 
+	// Purge links that have been in the trash past the retention window
+	go jobs.Every(jobsCtx, "trash_purge", cfg.Trash.PurgeInterval, func(ctx context.Context) error {
+		purged, err := jobs.PurgeDeletedLinks(ctx, cfg.Trash.Retention, cfg.Trash.CodeReuseCooldown)
+		if purged > 0 {
+			slog.Info("Purged deleted links", "count", purged)
+		}
+		return err
+	})
+
+	// Fold recorded clicks into the rollups analytics read from
+	go jobs.Every(jobsCtx, "analytics_rollup", cfg.Analytics.RollupInterval, func(ctx context.Context) error {
+		_, err := jobs.RollupClicks(ctx, cfg.Analytics.RollupDelay)
+		return err
+	})
+
+	// Create upcoming clicks partitions and drop those past raw retention
+	go jobs.Every(jobsCtx, "click_partitions", cfg.Analytics.PartitionInterval, func(ctx context.Context) error {
+		_, dropped, err := jobs.MaintainClickPartitions(ctx, cfg.Analytics.PartitionsAhead, cfg.Analytics.RawRetention)
+		if dropped > 0 {
+			slog.Info("Dropped expired click partitions", "count", dropped)
+		}
+		return err
+	})
+
+	// Set Gin mode
+	gin.SetMode(cfg.Server.GinMode)
+
 	// Initialize router
 	r := gin.New()
 
+	// Request IDs come first so every log line and error response carries one;
+	// tracing follows so the remaining middleware runs inside the request span
+	r.Use(middleware.RequestID())
+	r.Use(middleware.Tracing())
+
 	// Use custom logger instead of gin.Default()
 	r.Use(middleware.RequestLogger())
 	r.Use(gin.Recovery())
@@ -45,10 +121,18 @@ func main() {
 	// Security middleware
 	r.Use(middleware.SecurityHeaders())
 	r.Use(middleware.InputValidation())
-	r.Use(middleware.CORS())
+	r.Use(middleware.CORS(cfg.CORS))
 
-	// Rate limiting middleware (100 requests per minute per IP)
-	r.Use(middleware.RateLimitMiddleware(100, time.Minute))
+	// Rate limiting policies (token bucket per client identity), applied
+	// per route below so each route is counted against exactly one policy
+	policies := cfg.RateLimit.NamedPolicies()
+	defaultLimit := middleware.RateLimit(rateLimitStore, ratelimit.NewPolicy("default", policies["default"]))
+	redirectLimit := middleware.RateLimit(rateLimitStore, ratelimit.NewPolicy("redirect", policies["redirect"]))
+	analyticsLimit := middleware.RateLimit(rateLimitStore, ratelimit.NewPolicy("analytics", policies["analytics"]))
+	shortenLimit := middleware.RateLimitTiered(rateLimitStore,
+		ratelimit.NewPolicy("shorten", policies["shorten"]),
+		ratelimit.NewPolicy("shorten_anonymous", policies["shorten_anonymous"]),
+	)
 
 	// Health check endpoint
 	r.GET("/health", func(c *gin.Context) {
@@ -63,14 +147,50 @@ func main() {
 	api := r.Group("/api/v1")
 	{
 		// URL shortening endpoints
-		api.POST("/shorten", handlers.CreateShortURL)
-		api.GET("/urls", handlers.GetAllURLs)
-		api.GET("/urls/:id", handlers.GetURLByID)
-		api.DELETE("/urls/:id", handlers.DeleteURL)
+		api.POST("/shorten", shortenLimit, handlers.CreateShortURL)
+		api.POST("/shorten/bulk", shortenLimit, handlers.CreateShortURLsBulk)
+		api.POST("/import/csv", shortenLimit, handlers.ImportURLsCSV)
+		api.POST("/import/bitly", shortenLimit, handlers.ImportBitly)
+		api.POST("/import/yourls", shortenLimit, handlers.ImportYOURLS)
+
+		// URL management endpoints
+		manage := api.Group("", defaultLimit)
+		manage.GET("/urls", handlers.GetAllURLs)
+		manage.GET("/urls/:id", handlers.GetURLByID)
+		manage.PUT("/urls/:id", handlers.UpdateURL)
+		manage.DELETE("/urls/:id", handlers.DeleteURL)
+		manage.GET("/urls/:id/qr", handlers.GetURLQRCode)
+		manage.PUT("/urls/:id/qr/logo", handlers.PutURLQRLogo)
+		manage.DELETE("/urls/:id/qr/logo", handlers.DeleteURLQRLogo)
+		manage.GET("/urls/:id/revisions", handlers.GetURLRevisions)
+		manage.POST("/urls/:id/revisions/:revision/rollback", handlers.RollbackURL)
+		manage.GET("/export", handlers.ExportURLs)
+		manage.GET("/trash", handlers.GetTrash)
+		manage.POST("/trash/:id/restore", handlers.RestoreURL)
 		
 		// Analytics endpoints
-		api.GET("/analytics/:id", handlers.GetURLAnalytics)
-		api.GET("/analytics", handlers.GetAllAnalytics)
+		analytics := api.Group("/analytics", analyticsLimit)
+		analytics.GET("/:id", handlers.GetURLAnalytics)
+		analytics.GET("", handlers.GetAllAnalytics)
+
+		// Public abuse reporting
+		api.POST("/reports", defaultLimit, handlers.ReportURL)
+
+		// Moderation endpoints, authorized by the admin token
+		admin := api.Group("/admin", middleware.AdminAuth(cfg.Admin.Token), defaultLimit)
+		admin.GET("/reports", handlers.GetModerationQueue)
+		admin.GET("/urls/:id/reports", handlers.GetURLReports)
+		admin.POST("/urls/:id/disable", handlers.DisableURL)
+		admin.POST("/urls/:id/dismiss", handlers.DismissReports)
+		admin.POST("/urls/:id/ban-creator", handlers.BanCreator)
+		admin.DELETE("/urls/:id", handlers.ModerationDeleteURL)
+		admin.GET("/bans", handlers.GetBans)
+		admin.POST("/bans", handlers.CreateBan)
+		admin.DELETE("/bans/:id", handlers.DeleteBan)
+		admin.GET("/actions", handlers.GetModerationActions)
+		admin.GET("/audit-log", handlers.GetAuditLog)
+		admin.PUT("/qr/logo", handlers.PutWorkspaceQRLogo)
+		admin.DELETE("/qr/logo", handlers.DeleteWorkspaceQRLogo)
 	}
 
 	// URL validation middleware for short code routes
@@ -82,13 +202,17 @@ func main() {
 	r.StaticFile("/manifest.json", "./frontend/dist/manifest.json")
 	
 	// Redirect endpoint (for short URLs) - must be after static files
-	r.GET("/:shortCode", handlers.RedirectToOriginal)
+	r.GET("/:shortCode", redirectLimit, handlers.RedirectToOriginal)
+	r.GET("/:shortCode/qr", redirectLimit, handlers.GetShortCodeQRCode)
 	
 	// Fallback for React Router - serve index.html for all non-API routes
 	r.NoRoute(func(c *gin.Context) {
 		// Don't serve index.html for API routes
 		if strings.HasPrefix(c.Request.URL.Path, "/api") {
-			c.JSON(http.StatusNotFound, gin.H{"error": "API endpoint not found"})
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":      "API endpoint not found",
+				"request_id": logging.RequestIDFromContext(c.Request.Context()),
+			})
 			return
 		}
 		
@@ -96,14 +220,114 @@ func main() {
 		c.File("./frontend/dist/index.html")
 	})
 
-	// Get port from environment or use default
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	port := cfg.Server.Port
+
+	srv := &http.Server{
+		Addr:    ":" + port,
+		Handler: r,
+	}
+
+	go func() {
+		slog.Info("Server starting", "port", port)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal("Failed to start server", err)
+		}
+	}()
+
+	// Wait for an interrupt, then drain requests and flush pending spans
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	slog.Info("Shutting down server")
+	stopJobs()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Error("Server forced to shutdown", "error", err)
 	}
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("Failed to flush traces", "error", err)
+	}
+	database.CloseDatabase()
+}
+ 
+
+// fatal logs err and exits the process
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
 
-	log.Printf("Server starting on port %s", port)
-	if err := r.Run(":" + port); err != nil {
-		log.Fatal("Failed to start server:", err)
+// newScreener builds the URL screener from the configured blocklists and
+// lookup service
+func newScreener(cfg config.ScreeningConfig) (*screening.Screener, error) {
+	var blocklist *screening.Blocklist
+	if len(cfg.HostsFiles) > 0 || len(cfg.HashPrefixFiles) > 0 {
+		var err error
+		blocklist, err = screening.LoadBlocklist(cfg.HostsFiles, cfg.HashPrefixFiles)
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("URL blocklists loaded", "entries", blocklist.Len())
+	}
+
+	var lookup screening.Lookup
+	if cfg.SafeBrowsingAPIKey != "" {
+		lookup = screening.NewSafeBrowsingLookup(cfg.SafeBrowsingURL, cfg.SafeBrowsingAPIKey, cfg.Timeout)
+	}
+	return screening.New(blocklist, lookup), nil
+}
+
+// startScreeningJobs reloads the blocklists on SIGHUP and at the configured
+// interval, and periodically re-checks the destinations of active links
+func startScreeningJobs(ctx context.Context, screener *screening.Screener, cfg config.ScreeningConfig) {
+	if blocklist := screener.Blocklist(); blocklist != nil {
+		reload := func(context.Context) error {
+			if err := blocklist.Reload(); err != nil {
+				return err
+			}
+			slog.Info("URL blocklists reloaded", "entries", blocklist.Len())
+			return nil
+		}
+
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					signal.Stop(hup)
+					return
+				case <-hup:
+					if err := reload(ctx); err != nil {
+						slog.Error("Failed to reload URL blocklists", "error", err)
+					}
+				}
+			}
+		}()
+
+		if cfg.ReloadInterval > 0 {
+			go func() {
+				// The lists were just loaded, so skip the immediate run
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(cfg.ReloadInterval):
+				}
+				jobs.Every(ctx, "blocklist_reload", cfg.ReloadInterval, reload)
+			}()
+		}
+	}
+
+	if cfg.RecheckInterval > 0 {
+		go jobs.Every(ctx, "url_recheck", cfg.RecheckInterval, func(ctx context.Context) error {
+			disabled, err := jobs.RecheckLinks(ctx, screener, cfg.RecheckBatchSize, cfg.RecheckAge)
+			if disabled > 0 {
+				slog.Warn("Disabled links with unsafe destinations", "count", disabled)
+			}
+			return err
+		})
 	}
-} 
\ No newline at end of file
+}
@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// RequestActor names who is making a request for the audit log: the actor
+// set by authentication middleware, the verified user or API key, or
+// "anonymous". Identities the client merely claims, such as an unverified
+// API key header, are never recorded.
+func RequestActor(c *gin.Context) string {
+	if actor := c.GetString(ActorKey); actor != "" {
+		return actor
+	}
+	if userID := c.GetString(UserIDKey); userID != "" {
+		return "user:" + userID
+	}
+	if keyID := c.GetString(APIKeyIDKey); keyID != "" {
+		return "api_key:" + keyID
+	}
+	return "anonymous"
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminTokenHeader carries the token that authorizes admin endpoints
+const AdminTokenHeader = "X-Admin-Token"
+
+// ActorKey is the gin context key holding the name of the authenticated
+// actor performing a request, recorded with moderation actions
+const ActorKey = "actor"
+
+// AdminActor is the actor recorded for requests authorized by the admin token
+const AdminActor = "admin"
+
+// AdminAuth only lets requests carrying the admin token through. When no
+// token is configured the admin endpoints are disabled and respond 404.
+func AdminAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" {
+			abortWithError(c, http.StatusNotFound, gin.H{"error": "API endpoint not found"})
+			return
+		}
+
+		provided := c.GetHeader(AdminTokenHeader)
+		if provided == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			abortWithError(c, http.StatusUnauthorized, gin.H{"error": "Invalid or missing admin token"})
+			return
+		}
+
+		c.Set(ActorKey, AdminActor)
+		c.Next()
+	}
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func adminRequest(token, provided string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(AdminAuth(token))
+	router.GET("/admin", func(c *gin.Context) { c.String(http.StatusOK, c.GetString(ActorKey)) })
+
+	req, _ := http.NewRequest("GET", "/admin", nil)
+	if provided != "" {
+		req.Header.Set(AdminTokenHeader, provided)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAdminAuth(t *testing.T) {
+	w := adminRequest("s3cret-admin-token", "s3cret-admin-token")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, AdminActor, w.Body.String())
+
+	assert.Equal(t, http.StatusUnauthorized, adminRequest("s3cret-admin-token", "wrong").Code)
+	assert.Equal(t, http.StatusUnauthorized, adminRequest("s3cret-admin-token", "").Code)
+}
+
+func TestAdminAuthDisabledWithoutToken(t *testing.T) {
+	assert.Equal(t, http.StatusNotFound, adminRequest("", "anything").Code)
+}
+
+func TestRequestActor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest("GET", "/", nil)
+	assert.Equal(t, "anonymous", RequestActor(c))
+
+	// Unverified key headers are not an identity
+	c.Request.Header.Set("X-API-Key", "key-a")
+	c.Request.Header.Set("Authorization", "Bearer key-b")
+	assert.Equal(t, "anonymous", RequestActor(c))
+
+	c.Set(APIKeyIDKey, "7")
+	assert.Equal(t, "api_key:7", RequestActor(c))
+
+	c.Set(UserIDKey, "42")
+	assert.Equal(t, "user:42", RequestActor(c))
+
+	c.Set(ActorKey, AdminActor)
+	assert.Equal(t, AdminActor, RequestActor(c))
+}
@@ -0,0 +1,191 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"url-shortener/config"
+)
+
+// corsPolicy is a CORS configuration compiled for fast origin checks
+type corsPolicy struct {
+	allowAll         bool
+	exactOrigins     map[string]bool
+	wildcardOrigins  []wildcardOrigin
+	allowedMethods   map[string]bool
+	allowedHeaders   map[string]bool
+	methodsHeader    string
+	headersHeader    string
+	exposedHeader    string
+	allowCredentials bool
+	maxAge           string
+}
+
+// wildcardOrigin matches any subdomain of suffix, e.g. https://*.example.com
+type wildcardOrigin struct {
+	scheme string
+	suffix string // ".example.com"
+	port   string
+}
+
+// CORS middleware for handling Cross-Origin Resource Sharing.
+//
+// Allowed origins get Access-Control-* headers; other origins get none, and
+// preflight requests from them (or asking for a disallowed method or
+// header) are rejected with 403.
+func CORS(cfg config.CORSConfig) gin.HandlerFunc {
+	policy := newCORSPolicy(cfg)
+
+	return func(c *gin.Context) {
+		// Responses differ per origin, so caches must key on it
+		c.Writer.Header().Add("Vary", "Origin")
+
+		origin := c.GetHeader("Origin")
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+
+		if origin == "" {
+			if c.Request.Method == http.MethodOptions {
+				c.AbortWithStatus(http.StatusNoContent)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if !policy.originAllowed(origin) {
+			if preflight {
+				abortWithError(c, http.StatusForbidden, gin.H{"error": "CORS origin not allowed"})
+				return
+			}
+			c.Next()
+			return
+		}
+
+		c.Header("Access-Control-Allow-Origin", origin)
+		if policy.allowCredentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if policy.exposedHeader != "" {
+				c.Header("Access-Control-Expose-Headers", policy.exposedHeader)
+			}
+			if c.Request.Method == http.MethodOptions {
+				c.AbortWithStatus(http.StatusNoContent)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		c.Writer.Header().Add("Vary", "Access-Control-Request-Method")
+		c.Writer.Header().Add("Vary", "Access-Control-Request-Headers")
+
+		if !policy.allowedMethods[strings.ToUpper(c.GetHeader("Access-Control-Request-Method"))] {
+			abortWithError(c, http.StatusForbidden, gin.H{"error": "CORS method not allowed"})
+			return
+		}
+		for _, header := range strings.Split(c.GetHeader("Access-Control-Request-Headers"), ",") {
+			header = strings.TrimSpace(header)
+			if header != "" && !policy.allowedHeaders[http.CanonicalHeaderKey(header)] {
+				abortWithError(c, http.StatusForbidden, gin.H{"error": "CORS header not allowed: " + header})
+				return
+			}
+		}
+
+		c.Header("Access-Control-Allow-Methods", policy.methodsHeader)
+		if policy.headersHeader != "" {
+			c.Header("Access-Control-Allow-Headers", policy.headersHeader)
+		}
+		if policy.maxAge != "" {
+			c.Header("Access-Control-Max-Age", policy.maxAge)
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+// newCORSPolicy compiles cfg; entries are assumed to be validated already
+func newCORSPolicy(cfg config.CORSConfig) *corsPolicy {
+	policy := &corsPolicy{
+		exactOrigins:     make(map[string]bool),
+		allowedMethods:   make(map[string]bool),
+		allowedHeaders:   make(map[string]bool),
+		allowCredentials: cfg.AllowCredentials,
+	}
+
+	for _, origin := range cfg.AllowedOrigins {
+		origin = strings.TrimRight(origin, "/")
+		if origin == "*" {
+			policy.allowAll = true
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil {
+			continue
+		}
+		if strings.HasPrefix(u.Hostname(), "*.") {
+			policy.wildcardOrigins = append(policy.wildcardOrigins, wildcardOrigin{
+				scheme: strings.ToLower(u.Scheme),
+				suffix: strings.ToLower(strings.TrimPrefix(u.Hostname(), "*")),
+				port:   u.Port(),
+			})
+			continue
+		}
+		policy.exactOrigins[strings.ToLower(origin)] = true
+	}
+
+	var methods []string
+	for _, method := range cfg.AllowedMethods {
+		method = strings.ToUpper(strings.TrimSpace(method))
+		policy.allowedMethods[method] = true
+		methods = append(methods, method)
+	}
+	policy.methodsHeader = strings.Join(methods, ", ")
+
+	var headers []string
+	for _, header := range cfg.AllowedHeaders {
+		header = http.CanonicalHeaderKey(strings.TrimSpace(header))
+		policy.allowedHeaders[header] = true
+		headers = append(headers, header)
+	}
+	policy.headersHeader = strings.Join(headers, ", ")
+	policy.exposedHeader = strings.Join(cfg.ExposedHeaders, ", ")
+
+	if cfg.MaxAge > 0 {
+		policy.maxAge = strconv.Itoa(int(cfg.MaxAge.Seconds()))
+	}
+
+	return policy
+}
+
+// originAllowed reports whether origin matches an exact or wildcard entry
+func (p *corsPolicy) originAllowed(origin string) bool {
+	if p.allowAll {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if p.exactOrigins[origin] {
+		return true
+	}
+	if len(p.wildcardOrigins) == 0 {
+		return false
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	host := u.Hostname()
+	for _, pattern := range p.wildcardOrigins {
+		// The wildcard must cover at least one label: the apex domain
+		// itself is not matched by *.example.com
+		if u.Scheme == pattern.scheme && u.Port() == pattern.port &&
+			strings.HasSuffix(host, pattern.suffix) && len(host) > len(pattern.suffix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"url-shortener/config"
+)
+
+func newCORSRouter(cfg config.CORSConfig) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(CORS(cfg))
+	router.GET("/api/v1/urls", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.OPTIONS("/api/v1/urls", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return router
+}
+
+func corsRequest(router *gin.Engine, method, origin string, headers map[string]string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, "/api/v1/urls", nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func testCORSConfig() config.CORSConfig {
+	cfg := config.Default().CORS
+	cfg.AllowedOrigins = []string{"https://app.example.org", "https://*.example.com"}
+	return cfg
+}
+
+func TestCORSAllowsConfiguredOrigins(t *testing.T) {
+	router := newCORSRouter(testCORSConfig())
+
+	for _, origin := range []string{"https://app.example.org", "https://a.example.com", "https://a.b.example.com"} {
+		w := corsRequest(router, "GET", origin, nil)
+		assert.Equal(t, http.StatusOK, w.Code, origin)
+		assert.Equal(t, origin, w.Header().Get("Access-Control-Allow-Origin"), origin)
+		assert.Contains(t, w.Header().Values("Vary"), "Origin")
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+	}
+}
+
+func TestCORSIgnoresUnknownOrigins(t *testing.T) {
+	router := newCORSRouter(testCORSConfig())
+
+	for _, origin := range []string{
+		"https://example.com",      // apex is not covered by *.example.com
+		"http://a.example.com",     // scheme must match
+		"https://a.example.com:81", // port must match
+		"https://evilexample.com",
+		"https://example.com.evil.net",
+	} {
+		w := corsRequest(router, "GET", origin, nil)
+		assert.Equal(t, http.StatusOK, w.Code, origin)
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"), origin)
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"), origin)
+		assert.Contains(t, w.Header().Values("Vary"), "Origin")
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	cfg := testCORSConfig()
+	cfg.AllowCredentials = true
+	cfg.MaxAge = time.Hour
+	router := newCORSRouter(cfg)
+
+	w := corsRequest(router, "OPTIONS", "https://a.example.com", map[string]string{
+		"Access-Control-Request-Method":  "POST",
+		"Access-Control-Request-Headers": "content-type, x-request-id",
+	})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "https://a.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Contains(t, w.Header().Get("Access-Control-Allow-Methods"), "POST")
+	assert.Equal(t, "3600", w.Header().Get("Access-Control-Max-Age"))
+}
+
+func TestCORSRejectsDisallowedPreflights(t *testing.T) {
+	router := newCORSRouter(testCORSConfig())
+
+	tests := []struct {
+		name    string
+		origin  string
+		headers map[string]string
+	}{
+		{"unknown origin", "https://evil.net", map[string]string{"Access-Control-Request-Method": "GET"}},
+		{"disallowed method", "https://a.example.com", map[string]string{"Access-Control-Request-Method": "PATCH"}},
+		{"disallowed header", "https://a.example.com", map[string]string{
+			"Access-Control-Request-Method":  "GET",
+			"Access-Control-Request-Headers": "X-Secret",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := corsRequest(router, "OPTIONS", tt.origin, tt.headers)
+			assert.Equal(t, http.StatusForbidden, w.Code)
+			assert.Empty(t, w.Header().Get("Access-Control-Allow-Methods"))
+		})
+	}
+}
+
+func TestCORSAllowAll(t *testing.T) {
+	cfg := testCORSConfig()
+	cfg.AllowedOrigins = []string{"*"}
+	router := newCORSRouter(cfg)
+
+	w := corsRequest(router, "GET", "https://anything.test", nil)
+	assert.Equal(t, "https://anything.test", w.Header().Get("Access-Control-Allow-Origin"))
+}
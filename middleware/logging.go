@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"url-shortener/logging"
+)
+
+// RequestIDHeader is the header used to propagate request IDs
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds client-supplied request IDs
+const maxRequestIDLength = 128
+
+// RequestID propagates the caller's X-Request-ID or generates a new one, and
+// makes it available to loggers through the request context
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = uuid.New().String()
+		}
+
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), requestID))
+		c.Header(RequestIDHeader, requestID)
+
+		c.Next()
+	}
+}
+
+// RequestLogger logs one structured line per request once it completes
+func RequestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		path := c.Request.URL.Path
+
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", path),
+			slog.String("route", c.FullPath()),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("client_ip", c.ClientIP()),
+			slog.String("user_agent", c.Request.UserAgent()),
+			slog.Int("bytes", c.Writer.Size()),
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("errors", c.Errors.String()))
+		}
+
+		slog.LogAttrs(c.Request.Context(), level, "request completed", attrs...)
+	}
+}
+
+// abortWithError aborts the request with a JSON error body that includes
+// the request ID, so clients can quote it when reporting problems
+func abortWithError(c *gin.Context, status int, body gin.H) {
+	if requestID := logging.RequestIDFromContext(c.Request.Context()); requestID != "" {
+		body["request_id"] = requestID
+	}
+	c.AbortWithStatusJSON(status, body)
+}
+
+// validRequestID accepts short IDs made of printable ASCII characters only
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
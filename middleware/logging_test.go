@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"url-shortener/logging"
+)
+
+func TestRequestIDPropagatesHeader(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var seen string
+	router := gin.New()
+	router.Use(RequestID())
+	router.GET("/ping", func(c *gin.Context) {
+		seen = logging.RequestIDFromContext(c.Request.Context())
+		c.Status(http.StatusOK)
+	})
+
+	req, _ := http.NewRequest("GET", "/ping", nil)
+	req.Header.Set(RequestIDHeader, "abc-123")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, "abc-123", seen)
+	assert.Equal(t, "abc-123", w.Header().Get(RequestIDHeader))
+}
+
+func TestRequestIDGeneratesWhenMissingOrInvalid(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(RequestID())
+	router.GET("/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for _, header := range []string{"", "has spaces", strings.Repeat("a", maxRequestIDLength+1)} {
+		req, _ := http.NewRequest("GET", "/ping", nil)
+		if header != "" {
+			req.Header.Set(RequestIDHeader, header)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		generated := w.Header().Get(RequestIDHeader)
+		assert.NotEmpty(t, generated)
+		assert.NotEqual(t, header, generated)
+	}
+}
+
+func TestErrorResponsesIncludeRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(RequestID())
+	router.Use(InputValidation())
+	router.POST("/shorten", func(c *gin.Context) { c.Status(http.StatusCreated) })
+
+	req, _ := http.NewRequest("POST", "/shorten", strings.NewReader("x"))
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set(RequestIDHeader, "req-42")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "req-42", body["request_id"])
+}
@@ -1,118 +1,183 @@
 package middleware
 
 import (
+	"fmt"
+	"log/slog"
+	"math"
 	"net/http"
-	"sync"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"url-shortener/ratelimit"
 )
 
-// RateLimiter represents a simple in-memory rate limiter
-type RateLimiter struct {
-	requests map[string][]time.Time
-	mutex    sync.RWMutex
-	limit    int
-	window   time.Duration
-}
+// UserIDKey is the gin context key under which authentication middleware
+// stores the authenticated user's ID
+const UserIDKey = "user_id"
+
+// APIKeyIDKey is the gin context key under which authentication middleware
+// stores the ID of the API key a request was verified with. Key headers
+// are never trusted on their own: anyone can send a new one with every
+// request.
+const APIKeyIDKey = "api_key_id"
 
-// NewRateLimiter creates a new rate limiter instance
-func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
-	return &RateLimiter{
-		requests: make(map[string][]time.Time),
-		limit:    limit,
-		window:   window,
+// RateLimit enforces a token bucket policy on each request, keyed by the
+// first identity from policy.IdentifyBy present on the request. Responses
+// carry RateLimit-* headers describing the remaining budget and, when
+// limited, Retry-After.
+//
+// If the store fails the request is allowed, so an unavailable backend
+// degrades to no limiting rather than an outage.
+func RateLimit(store ratelimit.Store, policy ratelimit.Policy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		enforceRateLimit(c, store, policy)
 	}
 }
 
-// RateLimitMiddleware creates a middleware that limits requests per IP
-func RateLimitMiddleware(limit int, window time.Duration) gin.HandlerFunc {
-	limiter := NewRateLimiter(limit, window)
-	
+// RateLimitTiered applies the authenticated policy to requests made by a
+// verified user or API key, and the (usually stricter) anonymous policy to
+// everything else, including requests carrying unverified key headers
+func RateLimitTiered(store ratelimit.Store, authenticated, anonymous ratelimit.Policy) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Get client IP
-		clientIP := c.ClientIP()
-		
-		// Check if client has exceeded rate limit
-		if !limiter.Allow(clientIP) {
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error": "Rate limit exceeded. Please try again later.",
-				"retry_after": int(window.Seconds()),
-			})
-			c.Abort()
+		if c.GetString(UserIDKey) != "" || c.GetString(APIKeyIDKey) != "" {
+			enforceRateLimit(c, store, authenticated)
 			return
 		}
-		
+		enforceRateLimit(c, store, anonymous)
+	}
+}
+
+// rateLimitKey is the gin context key under which the limiter stores the
+// bucket a request was counted against
+const rateLimitKey = "rate_limit"
+
+// chargedBucket is the bucket a request was counted against
+type chargedBucket struct {
+	store  ratelimit.Store
+	policy ratelimit.Policy
+	key    string
+}
+
+// RateLimitError is returned when a request cannot be charged for the
+// items it carries
+type RateLimitError struct {
+	Policy string
+	// Capacity is the most items a request may carry under the policy
+	Capacity int
+	// RetryAfter is how many seconds until the bucket holds enough tokens,
+	// or zero if it never can
+	RetryAfter int
+}
+
+func (e *RateLimitError) Error() string {
+	if e.RetryAfter == 0 {
+		return fmt.Sprintf("Request exceeds the rate limit of %d items; split it into smaller requests", e.Capacity)
+	}
+	return "Rate limit exceeded. Please try again later."
+}
+
+// Body returns the JSON body of a 429 response for the error
+func (e *RateLimitError) Body() gin.H {
+	body := gin.H{"error": e.Error(), "policy": e.Policy}
+	if e.RetryAfter > 0 {
+		body["retry_after"] = e.RetryAfter
+	}
+	return body
+}
+
+// enforceRateLimit takes a token for the request and aborts it if none is left
+func enforceRateLimit(c *gin.Context, store ratelimit.Store, policy ratelimit.Policy) {
+	kind, identity := requestIdentity(c, policy.IdentifyBy)
+	bucket := &chargedBucket{
+		store:  store,
+		policy: policy,
+		key:    fmt.Sprintf("ratelimit:%s:%s:%s", policy.Name, kind, identity),
+	}
+
+	limitErr, err := bucket.take(c, 1)
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "rate limit check failed", "policy", policy.Name, "error", err)
 		c.Next()
+		return
 	}
+	if limitErr != nil {
+		abortWithError(c, http.StatusTooManyRequests, limitErr.Body())
+		return
+	}
+
+	c.Set(rateLimitKey, bucket)
+	c.Next()
 }
 
-// Allow checks if a request from the given IP is allowed
-func (rl *RateLimiter) Allow(ip string) bool {
-	rl.mutex.Lock()
-	defer rl.mutex.Unlock()
-	
-	now := time.Now()
-	windowStart := now.Add(-rl.window)
-	
-	// Get existing requests for this IP
-	requests, exists := rl.requests[ip]
-	if !exists {
-		requests = []time.Time{}
+// ChargeRateLimit takes n more tokens from the bucket a request was counted
+// against, for requests doing the work of several, such as bulk creates
+// and imports. It returns a RateLimitError, and takes nothing, if the bucket
+// does not hold n tokens; the caller responds 429 with its Body or stops
+// early. Requests without a rate limit are never refused, and like the
+// limiter it lets requests through when the store fails.
+func ChargeRateLimit(c *gin.Context, n int) *RateLimitError {
+	value, ok := c.Get(rateLimitKey)
+	if !ok || n <= 0 {
+		return nil
 	}
-	
-	// Filter out old requests outside the window
-	var validRequests []time.Time
-	for _, reqTime := range requests {
-		if reqTime.After(windowStart) {
-			validRequests = append(validRequests, reqTime)
-		}
+	// With the token the request itself took, n more can only ever be taken
+	// from a bucket holding more than n
+	bucket := value.(*chargedBucket)
+	if capacity := bucket.policy.Limit.Capacity(); n >= capacity {
+		return &RateLimitError{Policy: bucket.policy.Name, Capacity: capacity}
+	}
+
+	limitErr, err := bucket.take(c, n)
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "rate limit charge failed", "policy", bucket.policy.Name, "error", err)
+		return nil
+	}
+	return limitErr
+}
+
+// take consumes cost tokens and sets the RateLimit-* headers, plus
+// Retry-After when refused
+func (b *chargedBucket) take(c *gin.Context, cost int) (*RateLimitError, error) {
+	result, err := b.store.Take(c.Request.Context(), b.key, b.policy.Limit, cost)
+	if err != nil {
+		return nil, err
 	}
-	
-	// Check if limit is exceeded
-	if len(validRequests) >= rl.limit {
-		return false
+
+	c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", b.policy.Limit.Capacity(), int(b.policy.Limit.Window.Seconds())))
+	c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter)))
+
+	if !result.Allowed {
+		retryAfter := ceilSeconds(result.RetryAfter)
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		return &RateLimitError{Policy: b.policy.Name, Capacity: result.Limit, RetryAfter: retryAfter}, nil
 	}
-	
-	// Add current request
-	validRequests = append(validRequests, now)
-	rl.requests[ip] = validRequests
-	
-	return true
+	return nil, nil
 }
 
-// Cleanup removes old entries to prevent memory leaks
-func (rl *RateLimiter) Cleanup() {
-	rl.mutex.Lock()
-	defer rl.mutex.Unlock()
-	
-	now := time.Now()
-	windowStart := now.Add(-rl.window)
-	
-	for ip, requests := range rl.requests {
-		var validRequests []time.Time
-		for _, reqTime := range requests {
-			if reqTime.After(windowStart) {
-				validRequests = append(validRequests, reqTime)
+// requestIdentity returns the identity kind and value used to key the
+// bucket. Only identities set by authentication middleware are used; it
+// falls back to the client IP when no preferred identity is present.
+func requestIdentity(c *gin.Context, identifyBy []string) (string, string) {
+	for _, kind := range identifyBy {
+		switch kind {
+		case "user":
+			if userID := c.GetString(UserIDKey); userID != "" {
+				return "user", userID
 			}
-		}
-		
-		if len(validRequests) == 0 {
-			delete(rl.requests, ip)
-		} else {
-			rl.requests[ip] = validRequests
+		case "api_key":
+			if keyID := c.GetString(APIKeyIDKey); keyID != "" {
+				return "api_key", keyID
+			}
+		case "ip":
+			return "ip", c.ClientIP()
 		}
 	}
+	return "ip", c.ClientIP()
 }
 
-// StartCleanup starts a background goroutine to clean up old entries
-func (rl *RateLimiter) StartCleanup(interval time.Duration) {
-	go func() {
-		ticker := time.NewTicker(interval)
-		defer ticker.Stop()
-		
-		for range ticker.C {
-			rl.Cleanup()
-		}
-	}()
-} 
\ No newline at end of file
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,208 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"url-shortener/ratelimit"
+)
+
+// verifiedKeyHeader stands in for authentication middleware in tests: its
+// value is taken as the ID of a verified API key
+const verifiedKeyHeader = "X-Test-Verified-Key"
+
+// verifyTestKey sets the verified API key ID from verifiedKeyHeader
+func verifyTestKey(c *gin.Context) {
+	if keyID := c.GetHeader(verifiedKeyHeader); keyID != "" {
+		c.Set(APIKeyIDKey, keyID)
+	}
+}
+
+func newRateLimitRouter(store ratelimit.Store, identifyBy ...string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(verifyTestKey)
+	router.Use(RateLimit(store, ratelimit.Policy{
+		Name:       "test",
+		Limit:      ratelimit.Limit{Requests: 2, Window: time.Minute},
+		IdentifyBy: identifyBy,
+	}))
+	router.GET("/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return router
+}
+
+func rateLimitedRequest(router *gin.Engine, headers map[string]string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", "/ping", nil)
+	req.RemoteAddr = "203.0.113.7:1234"
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimitHeadersTrackBudget(t *testing.T) {
+	store := ratelimit.NewMemoryStore(time.Hour)
+	defer store.Close()
+	router := newRateLimitRouter(store, "ip")
+
+	w := rateLimitedRequest(router, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "2;w=60", w.Header().Get("RateLimit-Policy"))
+
+	w = rateLimitedRequest(router, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "60", w.Header().Get("RateLimit-Reset"))
+
+	w = rateLimitedRequest(router, nil)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+}
+
+func TestRateLimitKeysByPreferredIdentity(t *testing.T) {
+	store := ratelimit.NewMemoryStore(time.Hour)
+	defer store.Close()
+	router := newRateLimitRouter(store, "api_key", "ip")
+
+	// Exhaust the budget for one verified API key
+	for i := 0; i < 2; i++ {
+		rateLimitedRequest(router, map[string]string{verifiedKeyHeader: "key-a"})
+	}
+	w := rateLimitedRequest(router, map[string]string{verifiedKeyHeader: "key-a"})
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	// Another verified key from the same IP has its own budget, as does the
+	// bare IP
+	w = rateLimitedRequest(router, map[string]string{verifiedKeyHeader: "key-b"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = rateLimitedRequest(router, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRateLimitIgnoresUnverifiedKeys(t *testing.T) {
+	store := ratelimit.NewMemoryStore(time.Hour)
+	defer store.Close()
+	router := newRateLimitRouter(store, "api_key", "ip")
+
+	// Rotating an unknown key on every request stays in the IP's bucket
+	keys := []map[string]string{
+		{"X-API-Key": "random-1"},
+		{"Authorization": "Bearer random-2"},
+		{"X-API-Key": "random-3"},
+	}
+	for i, headers := range keys[:2] {
+		w := rateLimitedRequest(router, headers)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, strconv.Itoa(1-i), w.Header().Get("RateLimit-Remaining"))
+	}
+	w := rateLimitedRequest(router, keys[2])
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, ratelimit.Limit, int) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("backend down")
+}
+
+func TestRateLimitFailsOpen(t *testing.T) {
+	router := newRateLimitRouter(failingStore{}, "ip")
+
+	w := rateLimitedRequest(router, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+}
+
+func TestChargeRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := ratelimit.NewMemoryStore(time.Hour)
+	defer store.Close()
+
+	var charged []*RateLimitError
+	router := gin.New()
+	router.Use(RateLimit(store, ratelimit.Policy{
+		Name:       "test",
+		Limit:      ratelimit.Limit{Requests: 4, Window: time.Minute},
+		IdentifyBy: []string{"ip"},
+	}))
+	router.GET("/ping", func(c *gin.Context) {
+		n, _ := strconv.Atoi(c.Query("n"))
+		charged = append(charged, ChargeRateLimit(c, n))
+	})
+	charge := func(addr string, n int) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/ping?n="+strconv.Itoa(n), nil)
+		req.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Charges are taken from the request's bucket
+	w := charge("203.0.113.7:1234", 2)
+	assert.Nil(t, charged[0])
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+
+	// A charge the bucket cannot cover takes nothing
+	w = charge("203.0.113.7:1234", 1)
+	assert.Equal(t, &RateLimitError{Policy: "test", Capacity: 4, RetryAfter: 15}, charged[1])
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "15", w.Header().Get("Retry-After"))
+
+	// ...and one no bucket can cover is refused without a retry time
+	charge("203.0.113.8:1234", 4)
+	assert.Equal(t, &RateLimitError{Policy: "test", Capacity: 4}, charged[2])
+	assert.Contains(t, charged[2].Error(), "split it into smaller requests")
+
+	// Requests without a limiter are never refused
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest("GET", "/ping", nil)
+	assert.Nil(t, ChargeRateLimit(c, 100))
+}
+
+func TestRateLimitTieredSeparatesAnonymousClients(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := ratelimit.NewMemoryStore(time.Hour)
+	defer store.Close()
+
+	router := gin.New()
+	router.Use(verifyTestKey)
+	router.Use(RateLimitTiered(store,
+		ratelimit.Policy{Name: "shorten", Limit: ratelimit.Limit{Requests: 5, Window: time.Minute}, IdentifyBy: []string{"api_key", "ip"}},
+		ratelimit.Policy{Name: "shorten_anonymous", Limit: ratelimit.Limit{Requests: 1, Window: time.Minute}, IdentifyBy: []string{"ip"}},
+	))
+	router.GET("/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	// Anonymous callers get the strict policy
+	w := rateLimitedRequest(router, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Limit"))
+	w = rateLimitedRequest(router, nil)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	// Unverified key headers stay on the anonymous policy
+	w = rateLimitedRequest(router, map[string]string{"X-API-Key": "key-a"})
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Limit"))
+	w = rateLimitedRequest(router, map[string]string{"Authorization": "Bearer key-b"})
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	// Verified API keys from the same IP are counted separately and more
+	// generously
+	w = rateLimitedRequest(router, map[string]string{verifiedKeyHeader: "key-a"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "5", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "4", w.Header().Get("RateLimit-Remaining"))
+}
@@ -1,7 +1,6 @@
 package middleware
 
 import (
-	"fmt"
 	"net/http"
 	"strings"
 
@@ -41,14 +40,17 @@ func SecurityHeaders() gin.HandlerFunc {
 // InputValidation validates and sanitizes input
 func InputValidation() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Validate Content-Type for POST/PUT requests
+		// Validate Content-Type for POST/PUT requests. CSV and SQL bodies
+		// and file uploads are accepted for imports, and images for QR
+		// logos; JSON handlers reject them when binding.
 		if c.Request.Method == "POST" || c.Request.Method == "PUT" {
 			contentType := c.GetHeader("Content-Type")
-			if !strings.Contains(contentType, "application/json") {
-				c.JSON(http.StatusBadRequest, gin.H{
+			if !strings.Contains(contentType, "application/json") && !strings.Contains(contentType, "text/csv") &&
+				!strings.Contains(contentType, "application/sql") && !strings.Contains(contentType, "multipart/form-data") &&
+				!strings.HasPrefix(contentType, "image/") {
+				abortWithError(c, http.StatusBadRequest, gin.H{
 					"error": "Content-Type must be application/json",
 				})
-				c.Abort()
 				return
 			}
 		}
@@ -57,63 +59,6 @@ func InputValidation() gin.HandlerFunc {
 	}
 }
 
-// CORS middleware for handling Cross-Origin Resource Sharing
-func CORS() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		origin := c.GetHeader("Origin")
-		
-		// Allow specific origins or use * for development
-		allowedOrigins := []string{
-			"http://localhost:4000",
-			"http://localhost:3000",
-			"https://yourdomain.com", // Add your production domain
-		}
-		
-		allowed := false
-		for _, allowedOrigin := range allowedOrigins {
-			if origin == allowedOrigin {
-				allowed = true
-				break
-			}
-		}
-		
-		if allowed {
-			c.Header("Access-Control-Allow-Origin", origin)
-		}
-		
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With")
-		c.Header("Access-Control-Allow-Credentials", "true")
-		c.Header("Access-Control-Max-Age", "86400")
-		
-		// Handle preflight requests
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(http.StatusNoContent)
-			return
-		}
-		
-		c.Next()
-	}
-}
-
-// RequestLogger logs incoming requests
-func RequestLogger() gin.HandlerFunc {
-	return gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
-		// Custom log format
-		return fmt.Sprintf("%s - [%s] \"%s %s %s %d %s \"%s\" %s\"\n",
-			param.ClientIP,
-			param.TimeStamp.Format("02/Jan/2006:15:04:05 -0700"),
-			param.Method,
-			param.Path,
-			param.Request.Proto,
-			param.StatusCode,
-			param.Latency,
-			param.Request.UserAgent(),
-			param.ErrorMessage,
-		)
-	})
-}
-
 // URLValidation validates URL format
 func URLValidation() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -121,12 +66,13 @@ func URLValidation() gin.HandlerFunc {
 		// For example, validate short codes format
 		shortCode := c.Param("shortCode")
 		if shortCode != "" {
-			// Validate short code format (alphanumeric, 3-50 characters)
-			if len(shortCode) < 3 || len(shortCode) > 50 {
-				c.JSON(http.StatusBadRequest, gin.H{
+			// Validate short code format (alphanumeric, up to 50 characters;
+			// codes migrated from other shorteners can be shorter than the 3
+			// characters required at creation)
+			if len(shortCode) > 50 {
+				abortWithError(c, http.StatusBadRequest, gin.H{
 					"error": "Invalid short code format",
 				})
-				c.Abort()
 				return
 			}
 			
@@ -136,10 +82,9 @@ func URLValidation() gin.HandlerFunc {
 					 (char >= 'A' && char <= 'Z') || 
 					 (char >= '0' && char <= '9') ||
 					 char == '-' || char == '_') {
-					c.JSON(http.StatusBadRequest, gin.H{
+					abortWithError(c, http.StatusBadRequest, gin.H{
 						"error": "Short code can only contain letters, numbers, hyphens, and underscores",
 					})
-					c.Abort()
 					return
 				}
 			}
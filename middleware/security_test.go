@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestURLValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(URLValidation())
+	router.GET("/:shortCode", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		code   string
+		status int
+	}{
+		{"spring-sale", http.StatusOK},
+		// Codes migrated from other shorteners may be short or use underscores
+		{"ab", http.StatusOK},
+		{"my_link", http.StatusOK},
+		{strings.Repeat("a", 51), http.StatusBadRequest},
+		{"a.b", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", "/"+tt.code, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, tt.status, w.Code, tt.code)
+	}
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "url-shortener/middleware"
+
+// Tracing starts a server span for every request, continuing any trace
+// passed in through the W3C traceparent header
+func Tracing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		propagator := otel.GetTextMapPropagator()
+		ctx := propagator.Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+		spanName := c.Request.Method
+		route := c.FullPath()
+		if route != "" {
+			spanName = fmt.Sprintf("%s %s", c.Request.Method, route)
+		}
+
+		ctx, span := otel.Tracer(tracerName).Start(ctx, spanName,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodOriginal(c.Request.Method),
+				semconv.URLPath(c.Request.URL.Path),
+				semconv.ClientAddress(c.ClientIP()),
+				semconv.UserAgentOriginal(c.Request.UserAgent()),
+			),
+		)
+		defer span.End()
+
+		// Hand the trace context to handlers and back to the caller
+		c.Request = c.Request.WithContext(ctx)
+		propagator.Inject(ctx, propagation.HeaderCarrier(c.Writer.Header()))
+
+		c.Next()
+
+		if route != "" {
+			span.SetAttributes(semconv.HTTPRoute(route))
+		}
+
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+		if len(c.Errors) > 0 {
+			span.RecordError(c.Errors.Last())
+		}
+	}
+}
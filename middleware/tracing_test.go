@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+func setupTracingTest(t *testing.T) *tracetest.SpanRecorder {
+	gin.SetMode(gin.TestMode)
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+
+	return recorder
+}
+
+func TestTracingContinuesIncomingTrace(t *testing.T) {
+	recorder := setupTracingTest(t)
+
+	router := gin.New()
+	router.Use(Tracing())
+	router.GET("/:shortCode", func(c *gin.Context) {
+		c.Status(http.StatusMovedPermanently)
+	})
+
+	req, _ := http.NewRequest("GET", "/abc123", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+
+	span := spans[0]
+	assert.Equal(t, "GET /:shortCode", span.Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", span.Parent().SpanID().String())
+	assert.Contains(t, span.Attributes(), semconv.HTTPRoute("/:shortCode"))
+	assert.Contains(t, span.Attributes(), semconv.HTTPResponseStatusCode(http.StatusMovedPermanently))
+
+	// The response carries the trace context back to the caller
+	assert.Contains(t, w.Header().Get("traceparent"), "4bf92f3577b34da6a3ce929d0e0e4736")
+}
+
+func TestTracingMarksServerErrors(t *testing.T) {
+	recorder := setupTracingTest(t)
+
+	router := gin.New()
+	router.Use(Tracing())
+	router.GET("/fail", func(c *gin.Context) {
+		c.Status(http.StatusInternalServerError)
+	})
+
+	req, _ := http.NewRequest("GET", "/fail", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+}
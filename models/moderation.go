@@ -0,0 +1,130 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Abuse report reasons
+const (
+	ReportReasonPhishing = "phishing"
+	ReportReasonMalware  = "malware"
+	ReportReasonSpam     = "spam"
+	ReportReasonIllegal  = "illegal"
+	ReportReasonOther    = "other"
+)
+
+// Abuse report statuses
+const (
+	ReportStatusOpen      = "open"
+	ReportStatusActioned  = "actioned"
+	ReportStatusDismissed = "dismissed"
+)
+
+// Moderation actions
+const (
+	ModerationDisable    = "disable"
+	ModerationDelete     = "delete"
+	ModerationBanCreator = "ban_creator"
+	ModerationBanIP      = "ban_ip"
+	ModerationDismiss    = "dismiss"
+)
+
+// Ban kinds
+const (
+	BanKindUser = "user"
+	BanKindIP   = "ip"
+)
+
+// ValidReportReason reports whether reason is a known report reason
+func ValidReportReason(reason string) bool {
+	switch reason {
+	case ReportReasonPhishing, ReportReasonMalware, ReportReasonSpam, ReportReasonIllegal, ReportReasonOther:
+		return true
+	}
+	return false
+}
+
+// CreateReportRequest is a public report that a short link is abusive. The
+// link is identified by its short code or full short URL.
+type CreateReportRequest struct {
+	ShortCode string  `json:"short_code"`
+	ShortURL  string  `json:"short_url"`
+	Reason    string  `json:"reason" binding:"required"`
+	Details   *string `json:"details,omitempty"`
+}
+
+// AbuseReport is a stored abuse report
+type AbuseReport struct {
+	ID             string     `json:"id"`
+	URLID          *string    `json:"url_id,omitempty"`
+	ShortCode      string     `json:"short_code"`
+	Reason         string     `json:"reason"`
+	Details        *string    `json:"details,omitempty"`
+	ReporterIP     string     `json:"reporter_ip"`
+	Status         string     `json:"status"`
+	ResolvedAction *string    `json:"resolved_action,omitempty"`
+	ResolvedAt     *time.Time `json:"resolved_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// ModerationQueueItem summarizes the reports against one link
+type ModerationQueueItem struct {
+	URLID           string           `json:"url_id"`
+	ShortCode       string           `json:"short_code"`
+	OriginalURL     string           `json:"original_url"`
+	IsActive        bool             `json:"is_active"`
+	OpenReports     int64            `json:"open_reports"`
+	TotalReports    int64            `json:"total_reports"`
+	Reasons         map[string]int64 `json:"reasons"`
+	FirstReportedAt time.Time        `json:"first_reported_at"`
+	LastReportedAt  time.Time        `json:"last_reported_at"`
+}
+
+// ModerationRequest carries the optional reason for a moderation action
+type ModerationRequest struct {
+	Reason string `json:"reason"`
+}
+
+// BanRequest bans an IP address from creating links
+type BanRequest struct {
+	IP     string `json:"ip" binding:"required"`
+	Reason string `json:"reason"`
+}
+
+// Ban prevents a user or IP address from creating links
+type Ban struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`
+	Value     string    `json:"value"`
+	Reason    *string   `json:"reason,omitempty"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ModerationAction is a stored record of a moderator's action
+type ModerationAction struct {
+	ID        string          `json:"id"`
+	URLID     *string         `json:"url_id,omitempty"`
+	Action    string          `json:"action"`
+	Reason    *string         `json:"reason,omitempty"`
+	Actor     string          `json:"actor"`
+	Details   json.RawMessage `json:"details,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// AuditLogEntry is a recorded mutation. Before and After are snapshots of
+// the target; Changes holds only the fields that differ.
+type AuditLogEntry struct {
+	ID         string          `json:"id"`
+	Actor      string          `json:"actor"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	Changes    json.RawMessage `json:"changes,omitempty"`
+	IP         *string         `json:"ip,omitempty"`
+	RequestID  *string         `json:"request_id,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
@@ -1,24 +1,33 @@
 package models
 
 import (
+	"crypto/rand"
+	"fmt"
 	"time"
+
 	"github.com/google/uuid"
 )
 
 // URL represents a shortened URL
 type URL struct {
-	ID          string    `json:"id" db:"id"`
-	OriginalURL string    `json:"original_url" db:"original_url"`
-	ShortCode   string    `json:"short_code" db:"short_code"`
-	CustomCode  *string   `json:"custom_code,omitempty" db:"custom_code"`
-	Title       *string   `json:"title,omitempty" db:"title"`
-	Description *string   `json:"description,omitempty" db:"description"`
-	UserID      *string   `json:"user_id,omitempty" db:"user_id"`
-	IsActive    bool      `json:"is_active" db:"is_active"`
-	ExpiresAt   *time.Time `json:"expires_at,omitempty" db:"expires_at"`
-	ClickCount  int64     `json:"click_count" db:"click_count"`
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+	ID             string     `json:"id" db:"id"`
+	OriginalURL    string     `json:"original_url" db:"original_url"`
+	ShortCode      string     `json:"short_code" db:"short_code"`
+	CustomCode     *string    `json:"custom_code,omitempty" db:"custom_code"`
+	Title          *string    `json:"title,omitempty" db:"title"`
+	Description    *string    `json:"description,omitempty" db:"description"`
+	UserID         *string    `json:"user_id,omitempty" db:"user_id"`
+	IsActive       bool       `json:"is_active" db:"is_active"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	ClickCount     int64      `json:"click_count" db:"click_count"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at" db:"updated_at"`
+	DisabledReason *string    `json:"disabled_reason,omitempty" db:"disabled_reason"`
+	DisabledAt     *time.Time `json:"disabled_at,omitempty" db:"disabled_at"`
+	ScreenedAt     *time.Time `json:"screened_at,omitempty" db:"screened_at"`
+	CreatorIP      *string    `json:"-" db:"creator_ip"`
+	DeletedAt      *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	Revision       int        `json:"revision" db:"revision"`
 }
 
 // CreateURLRequest represents the request to create a new short URL
@@ -32,43 +41,86 @@ type CreateURLRequest struct {
 
 // URLResponse represents the response for URL operations
 type URLResponse struct {
-	ID          string     `json:"id"`
-	OriginalURL string     `json:"original_url"`
-	ShortURL    string     `json:"short_url"`
-	CustomCode  *string    `json:"custom_code,omitempty"`
-	Title       *string    `json:"title,omitempty"`
-	Description *string    `json:"description,omitempty"`
-	QRCode      string     `json:"qr_code,omitempty"`
-	ClickCount  int64      `json:"click_count"`
-	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
-	CreatedAt   time.Time  `json:"created_at"`
+	ID             string     `json:"id"`
+	OriginalURL    string     `json:"original_url"`
+	ShortURL       string     `json:"short_url"`
+	CustomCode     *string    `json:"custom_code,omitempty"`
+	Title          *string    `json:"title,omitempty"`
+	Description    *string    `json:"description,omitempty"`
+	QRCode         string     `json:"qr_code,omitempty"`
+	ClickCount     int64      `json:"click_count"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	IsActive       bool       `json:"is_active"`
+	DisabledReason *string    `json:"disabled_reason,omitempty"`
+	DisabledAt     *time.Time `json:"disabled_at,omitempty"`
+	DeletedAt      *time.Time `json:"deleted_at,omitempty"`
+	Revision       int        `json:"revision"`
 }
 
 // Click represents a click on a shortened URL
 type Click struct {
-	ID        string    `json:"id" db:"id"`
-	URLID     string    `json:"url_id" db:"url_id"`
-	IPAddress string    `json:"ip_address" db:"ip_address"`
-	UserAgent string    `json:"user_agent" db:"user_agent"`
-	Referer   *string   `json:"referer,omitempty" db:"referer"`
-	Country   *string   `json:"country,omitempty" db:"country"`
-	City      *string   `json:"city,omitempty" db:"city"`
-	Device    *string   `json:"device,omitempty" db:"device"`
-	Browser   *string   `json:"browser,omitempty" db:"browser"`
-	OS        *string   `json:"os,omitempty" db:"os"`
+	ID        string  `json:"id" db:"id"`
+	URLID     string  `json:"url_id" db:"url_id"`
+	IPAddress string  `json:"ip_address" db:"ip_address"`
+	UserAgent string  `json:"user_agent" db:"user_agent"`
+	Referer   *string `json:"referer,omitempty" db:"referer"`
+	Country   *string `json:"country,omitempty" db:"country"`
+	City      *string `json:"city,omitempty" db:"city"`
+	Device    *string `json:"device,omitempty" db:"device"`
+	Browser   *string `json:"browser,omitempty" db:"browser"`
+	OS        *string `json:"os,omitempty" db:"os"`
+	Revision  int     `json:"revision" db:"revision"`
+	// Source is how the visitor reached the link, ClickSourceLink or
+	// ClickSourceQR
+	Source string `json:"source" db:"source"`
+	// ReferrerDomain and ReferrerType are the normalized Referer and its
+	// kind, such as search or social
+	ReferrerDomain *string `json:"referrer_domain,omitempty" db:"referrer_domain"`
+	ReferrerType   string  `json:"referrer_type" db:"referrer_type"`
+	// UTMSource, UTMMedium and UTMCampaign are the campaign the click is
+	// attributed to, from the short URL's or the destination's query
+	UTMSource   *string `json:"utm_source,omitempty" db:"utm_source"`
+	UTMMedium   *string `json:"utm_medium,omitempty" db:"utm_medium"`
+	UTMCampaign *string `json:"utm_campaign,omitempty" db:"utm_campaign"`
+	// VisitorID is a hash of the visitor's IP address and user agent with
+	// a salt that rotates daily, counted for unique visitors
+	VisitorID *string   `json:"visitor_id,omitempty" db:"visitor_id"`
 	ClickedAt time.Time `json:"clicked_at" db:"clicked_at"`
 }
 
-// Analytics represents analytics data for a URL
+// Click sources
+const (
+	// ClickSourceLink is a visit from a typed, pasted or clicked short URL
+	ClickSourceLink = "link"
+	// ClickSourceQR is a visit from a scanned QR code
+	ClickSourceQR = "qr"
+)
+
+// Analytics represents analytics data for a URL. TotalClicks counts every
+// click the link received; the other figures cover From up to To.
+// UniqueClicks counts visitors once per day they visited.
 type Analytics struct {
-	URLID           string    `json:"url_id"`
-	TotalClicks     int64     `json:"total_clicks"`
-	UniqueClicks    int64     `json:"unique_clicks"`
-	TopCountries    []Country `json:"top_countries"`
-	TopDevices      []Device  `json:"top_devices"`
-	TopBrowsers     []Browser `json:"top_browsers"`
-	ClickTimeline   []Timeline `json:"click_timeline"`
-	LastClickedAt   *time.Time `json:"last_clicked_at"`
+	URLID            string           `json:"url_id"`
+	From             time.Time        `json:"from"`
+	To               time.Time        `json:"to"`
+	Granularity      string           `json:"granularity"`
+	Timezone         string           `json:"timezone"`
+	TotalClicks      int64            `json:"total_clicks"`
+	PeriodClicks     int64            `json:"period_clicks"`
+	UniqueClicks     int64            `json:"unique_clicks"`
+	TopCountries     []Country        `json:"top_countries"`
+	TopDevices       []Device         `json:"top_devices"`
+	TopBrowsers      []Browser        `json:"top_browsers"`
+	ClickTimeline    []Timeline       `json:"click_timeline"`
+	ClicksByRevision []RevisionClicks `json:"clicks_by_revision"`
+	ClicksBySource   []SourceClicks   `json:"clicks_by_source"`
+	TopReferrers     []ReferrerClicks `json:"top_referrers"`
+	ReferrerTypes    []ReferrerType   `json:"referrer_types"`
+	TopUTMSources    []UTMClicks      `json:"top_utm_sources"`
+	TopUTMMediums    []UTMClicks      `json:"top_utm_mediums"`
+	TopUTMCampaigns  []UTMClicks      `json:"top_utm_campaigns"`
+	LastClickedAt    *time.Time       `json:"last_clicked_at"`
 }
 
 // Country represents country analytics
@@ -89,12 +141,50 @@ type Browser struct {
 	Clicks  int64  `json:"clicks"`
 }
 
-// Timeline represents click timeline
-type Timeline struct {
-	Date  string `json:"date"`
+// RevisionClicks represents the clicks a link received while one revision
+// of its destination was active
+type RevisionClicks struct {
+	Revision    int    `json:"revision"`
+	OriginalURL string `json:"original_url"`
+	Clicks      int64  `json:"clicks"`
+}
+
+// SourceClicks represents the clicks a link received from one source
+type SourceClicks struct {
+	Source string `json:"source"`
+	Clicks int64  `json:"clicks"`
+}
+
+// ReferrerClicks represents the clicks a link received from one referring
+// domain. Visits without a referrer are counted under "direct".
+type ReferrerClicks struct {
+	Referrer string `json:"referrer"`
+	Type     string `json:"type"`
+	Clicks   int64  `json:"clicks"`
+}
+
+// ReferrerType represents the clicks a link received from one kind of
+// referrer: direct, search, social, email or other
+type ReferrerType struct {
+	Type   string `json:"type"`
+	Clicks int64  `json:"clicks"`
+}
+
+// UTMClicks represents the clicks attributed to one value of a UTM
+// parameter
+type UTMClicks struct {
+	Value  string `json:"value"`
 	Clicks int64  `json:"clicks"`
 }
 
+// Timeline represents the clicks and unique visitors in one bucket of a
+// click timeline, starting at Date
+type Timeline struct {
+	Date           string `json:"date"`
+	Clicks         int64  `json:"clicks"`
+	UniqueVisitors int64  `json:"unique_visitors"`
+}
+
 // NewURL creates a new URL instance
 func NewURL(originalURL string, customCode *string) *URL {
 	return &URL{
@@ -104,6 +194,7 @@ func NewURL(originalURL string, customCode *string) *URL {
 		CustomCode:  customCode,
 		IsActive:    true,
 		ClickCount:  0,
+		Revision:    1,
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
 	}
@@ -112,13 +203,34 @@ func NewURL(originalURL string, customCode *string) *URL {
 // generateShortCode generates a random 6-character short code
 func generateShortCode() string {
 	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	// Bytes at or above this are rejected so every character is equally likely
+	const limit = 256 - 256%len(charset)
+
 	b := make([]byte, 6)
-	for i := range b {
-		b[i] = charset[time.Now().UnixNano()%int64(len(charset))]
+	buf := make([]byte, 16)
+	for i := 0; i < len(b); {
+		if _, err := rand.Read(buf); err != nil {
+			panic(fmt.Sprintf("failed to read random bytes: %v", err))
+		}
+		for _, r := range buf {
+			if int(r) < limit && i < len(b) {
+				b[i] = charset[int(r)%len(charset)]
+				i++
+			}
+		}
 	}
 	return string(b)
 }
 
+// Code returns the code the link is reached by: the custom code if set,
+// otherwise the generated short code
+func (u *URL) Code() string {
+	if u.CustomCode != nil {
+		return *u.CustomCode
+	}
+	return u.ShortCode
+}
+
 // IsExpired checks if the URL has expired
 func (u *URL) IsExpired() bool {
 	if u.ExpiresAt == nil {
@@ -141,14 +253,98 @@ func (u *URL) ToResponse(baseURL string) URLResponse {
 	}
 
 	return URLResponse{
-		ID:          u.ID,
-		OriginalURL: u.OriginalURL,
-		ShortURL:    baseURL + "/" + shortCode,
-		CustomCode:  u.CustomCode,
-		Title:       u.Title,
-		Description: u.Description,
-		ClickCount:  u.ClickCount,
-		ExpiresAt:   u.ExpiresAt,
-		CreatedAt:   u.CreatedAt,
+		ID:             u.ID,
+		OriginalURL:    u.OriginalURL,
+		ShortURL:       baseURL + "/" + shortCode,
+		CustomCode:     u.CustomCode,
+		Title:          u.Title,
+		Description:    u.Description,
+		ClickCount:     u.ClickCount,
+		ExpiresAt:      u.ExpiresAt,
+		CreatedAt:      u.CreatedAt,
+		IsActive:       u.IsActive,
+		DisabledReason: u.DisabledReason,
+		DisabledAt:     u.DisabledAt,
+		DeletedAt:      u.DeletedAt,
+		Revision:       u.Revision,
 	}
-} 
\ No newline at end of file
+}
+
+// TrashItem is a soft-deleted link that can still be restored
+type TrashItem struct {
+	URLResponse
+	RestorableUntil time.Time `json:"restorable_until"`
+}
+
+// URLRevision is one version of a link's mutable fields. Every change,
+// including a rollback, adds a revision; existing revisions never change.
+type URLRevision struct {
+	Revision    int        `json:"revision"`
+	OriginalURL string     `json:"original_url"`
+	Title       *string    `json:"title,omitempty"`
+	Description *string    `json:"description,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	CreatedBy   string     `json:"created_by"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Current     bool       `json:"current"`
+	Clicks      int64      `json:"clicks"`
+}
+
+// BulkResult is the outcome of one item of a bulk create request
+type BulkResult struct {
+	Index   int          `json:"index"`
+	Created bool         `json:"created"`
+	Data    *URLResponse `json:"data,omitempty"`
+	Error   string       `json:"error,omitempty"`
+	Code    string       `json:"code,omitempty"`
+}
+
+// ImportReport summarizes a CSV import. Rows are numbered by their line in
+// the file, the header being line 1.
+type ImportReport struct {
+	DryRun  bool `json:"dry_run"`
+	Rows    int  `json:"rows"`
+	Valid   int  `json:"valid"`
+	Created int  `json:"created"`
+	Failed  int  `json:"failed"`
+	// Conflicts counts the failed rows whose custom code is already in use
+	Conflicts       int           `json:"conflicts"`
+	Errors          []ImportError `json:"errors"`
+	ErrorsTruncated bool          `json:"errors_truncated,omitempty"`
+	// Aborted explains why the file could not be read to the end
+	Aborted string `json:"aborted,omitempty"`
+}
+
+// ImportError is the reason one imported row was rejected
+type ImportError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+	Code  string `json:"code,omitempty"`
+}
+
+// ExportedLink is one link in an export
+type ExportedLink struct {
+	ID          string     `json:"id"`
+	ShortCode   string     `json:"short_code"`
+	CustomCode  *string    `json:"custom_code"`
+	ShortURL    string     `json:"short_url"`
+	OriginalURL string     `json:"original_url"`
+	Title       *string    `json:"title"`
+	Description *string    `json:"description"`
+	IsActive    bool       `json:"is_active"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	ClickCount  int64      `json:"click_count"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// QRLogo describes a logo drawn in QR codes. A logo without a URL ID is the
+// workspace logo, used for links without their own.
+type QRLogo struct {
+	ID        string    `json:"id"`
+	URLID     *string   `json:"url_id"`
+	Width     int       `json:"width"`
+	Height    int       `json:"height"`
+	Bytes     int       `json:"bytes"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,81 @@
+package qr
+
+import (
+	"container/list"
+	"encoding/base64"
+	"sync"
+)
+
+// DataURI embeds a PNG image in a data URI
+func DataURI(png []byte) string {
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(png)
+}
+
+// InlineCache renders the QR codes embedded in API responses and keeps the
+// most recently used ones, since a short URL's inline code never changes.
+// It is safe for concurrent use.
+type InlineCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	order      *list.List
+	entries    map[string]*list.Element
+}
+
+type inlineEntry struct {
+	content string
+	uri     string
+}
+
+// NewInlineCache creates a cache holding up to maxEntries codes. With
+// maxEntries 0 every code is rendered on demand.
+func NewInlineCache(maxEntries int) *InlineCache {
+	return &InlineCache{
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+// DataURI returns the QR code of content as a data URI holding a PNG
+// rendered with the default options
+func (c *InlineCache) DataURI(content string) (string, error) {
+	c.mu.Lock()
+	if e, ok := c.entries[content]; ok {
+		c.order.MoveToFront(e)
+		c.mu.Unlock()
+		return e.Value.(*inlineEntry).uri, nil
+	}
+	c.mu.Unlock()
+
+	// Render outside the lock; concurrent misses for one URL render the
+	// same image, so whichever is stored last is as good as the first
+	png, err := PNG(content, DefaultOptions())
+	if err != nil {
+		return "", err
+	}
+	uri := DataURI(png)
+	if c.maxEntries <= 0 {
+		return uri, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[content]; ok {
+		c.order.MoveToFront(e)
+		return uri, nil
+	}
+	c.entries[content] = c.order.PushFront(&inlineEntry{content: content, uri: uri})
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*inlineEntry).content)
+	}
+	return uri, nil
+}
+
+// Len is the number of cached codes
+func (c *InlineCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
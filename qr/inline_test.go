@@ -0,0 +1,48 @@
+package qr
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataURI(t *testing.T) {
+	png, err := PNG("https://sho.rt/abc123", DefaultOptions())
+	require.NoError(t, err)
+
+	uri := DataURI(png)
+	require.True(t, strings.HasPrefix(uri, "data:image/png;base64,"))
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(uri, "data:image/png;base64,"))
+	require.NoError(t, err)
+	assert.Equal(t, png, decoded)
+	assert.Equal(t, "https://sho.rt/abc123", decode(t, decoded))
+}
+
+func TestInlineCache(t *testing.T) {
+	cache := NewInlineCache(2)
+	first, err := cache.DataURI("https://sho.rt/a")
+	require.NoError(t, err)
+	again, err := cache.DataURI("https://sho.rt/a")
+	require.NoError(t, err)
+	assert.Equal(t, first, again)
+
+	_, err = cache.DataURI("https://sho.rt/b")
+	require.NoError(t, err)
+	// Using a moves b to the back, so c evicts b
+	_, err = cache.DataURI("https://sho.rt/a")
+	require.NoError(t, err)
+	_, err = cache.DataURI("https://sho.rt/c")
+	require.NoError(t, err)
+	assert.Equal(t, 2, cache.Len())
+	assert.Contains(t, cache.entries, "https://sho.rt/a")
+	assert.NotContains(t, cache.entries, "https://sho.rt/b")
+
+	uncached := NewInlineCache(0)
+	uri, err := uncached.DataURI("https://sho.rt/a")
+	require.NoError(t, err)
+	assert.Equal(t, first, uri)
+	assert.Equal(t, 0, uncached.Len())
+}
@@ -0,0 +1,198 @@
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	// Logos may be uploaded in any of these formats
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"math"
+
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	// DefaultLogoSize is the default logo width as a share of the code's
+	// width, quiet zone excluded
+	DefaultLogoSize = 0.2
+	// MaxLogoSize bounds the requested logo width
+	MaxLogoSize = 0.3
+	// MaxLogoArea is the largest share of the code's area a logo and its
+	// padding may cover. Codes with a logo use the highest error
+	// correction, which restores up to 30% of the data; staying well below
+	// that leaves room for print and camera damage.
+	MaxLogoArea = 0.12
+	// maxLogoRaster bounds the resolution a logo is embedded at in vector
+	// output
+	maxLogoRaster = 512
+)
+
+// ErrLogoTooLarge reports a logo that would leave the code unscannable
+var ErrLogoTooLarge = errors.New("logo would cover too much of the code to scan reliably; use a smaller logo size")
+
+// maxLogoPixels bounds the dimensions of an uploaded logo, checked before
+// it is decoded
+const maxLogoPixels = 4096
+
+// ReadLogo decodes an uploaded PNG, JPEG or GIF logo, scaled down to the
+// resolution logos are drawn at
+func ReadLogo(r io.Reader) (*image.RGBA, error) {
+	var header bytes.Buffer
+	config, _, err := image.DecodeConfig(io.TeeReader(r, &header))
+	if err != nil {
+		return nil, errors.New("logo must be a PNG, JPEG or GIF image")
+	}
+	if config.Width < 1 || config.Height < 1 || config.Width > maxLogoPixels || config.Height > maxLogoPixels {
+		return nil, fmt.Errorf("logo must be at most %dx%d pixels", maxLogoPixels, maxLogoPixels)
+	}
+	img, _, err := image.Decode(io.MultiReader(&header, r))
+	if err != nil {
+		return nil, errors.New("logo must be a PNG, JPEG or GIF image")
+	}
+	return logoRaster(img), nil
+}
+
+// code is an encoded QR code ready to render
+type code struct {
+	modules [][]bool
+	margin  int
+	// logo is where the logo is drawn, in modules from the image's top
+	// left corner; nil when there is no logo
+	logo *logoPlacement
+}
+
+// total is the side of the image in modules, quiet zone included
+func (c *code) total() int {
+	return len(c.modules) + 2*c.margin
+}
+
+// logoPlacement is the rectangle a logo is drawn in, in modules
+type logoPlacement struct {
+	x, y, width, height float64
+}
+
+// encode encodes content, clearing a padded square in the middle of the
+// code for the logo if there is one. Codes with a logo always use the
+// highest error correction level.
+func encode(content string, opts Options) (*code, error) {
+	level := opts.Level
+	if opts.Logo != nil {
+		level = qrcode.Highest
+	}
+	modules, err := Matrix(content, level)
+	if err != nil {
+		return nil, err
+	}
+	c := &code{modules: modules, margin: opts.Margin}
+	if opts.Logo == nil {
+		return c, nil
+	}
+
+	n := len(modules)
+	start, side, err := logoArea(n, opts.LogoSize)
+	if err != nil {
+		return nil, err
+	}
+	for y := start; y < start+side; y++ {
+		for x := start; x < start+side; x++ {
+			modules[y][x] = false
+		}
+	}
+
+	// The logo keeps its aspect ratio within the square, inside a one
+	// module padding
+	inner := float64(side - 2)
+	bounds := opts.Logo.Bounds()
+	width, height := inner, inner
+	if bounds.Dx() > bounds.Dy() {
+		height = inner * float64(bounds.Dy()) / float64(bounds.Dx())
+	} else {
+		width = inner * float64(bounds.Dx()) / float64(bounds.Dy())
+	}
+	origin := float64(opts.Margin + start + 1)
+	c.logo = &logoPlacement{
+		x:      origin + (inner-width)/2,
+		y:      origin + (inner-height)/2,
+		width:  width,
+		height: height,
+	}
+	return c, nil
+}
+
+// logoArea returns the first module and the side, in modules, of the
+// square cleared for a logo of the given relative size in a code of n
+// modules. The square is centered on the module grid and must stay within
+// MaxLogoArea and clear of the finder patterns in the corners.
+func logoArea(n int, size float64) (start, side int, err error) {
+	side = int(math.Ceil(size*float64(n))) + 2
+	if (n-side)%2 != 0 {
+		side++
+	}
+	start = (n - side) / 2
+	// Finder patterns and their separators take 8 modules from each corner
+	if float64(side*side) > MaxLogoArea*float64(n*n) || start < 8 {
+		return 0, 0, ErrLogoTooLarge
+	}
+	return start, side, nil
+}
+
+// scaleImage resizes src to width by height pixels, averaging the source
+// pixels each destination pixel covers
+func scaleImage(src image.Image, width, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	b := src.Bounds()
+	for dy := 0; dy < height; dy++ {
+		y0 := b.Min.Y + dy*b.Dy()/height
+		y1 := max(b.Min.Y+(dy+1)*b.Dy()/height, y0+1)
+		for dx := 0; dx < width; dx++ {
+			x0 := b.Min.X + dx*b.Dx()/width
+			x1 := max(b.Min.X+(dx+1)*b.Dx()/width, x0+1)
+			var r, g, bl, a, count uint64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					pr, pg, pb, pa := src.At(x, y).RGBA()
+					r, g, bl, a = r+uint64(pr), g+uint64(pg), bl+uint64(pb), a+uint64(pa)
+					count++
+				}
+			}
+			dst.SetRGBA(dx, dy, color.RGBA{
+				R: uint8(r / count >> 8),
+				G: uint8(g / count >> 8),
+				B: uint8(bl / count >> 8),
+				A: uint8(a / count >> 8),
+			})
+		}
+	}
+	return dst
+}
+
+// logoRaster returns the logo at the resolution it is embedded at in
+// vector output
+func logoRaster(logo image.Image) *image.RGBA {
+	b := logo.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if longest := max(width, height); longest > maxLogoRaster {
+		width = max(width*maxLogoRaster/longest, 1)
+		height = max(height*maxLogoRaster/longest, 1)
+	}
+	return scaleImage(logo, width, height)
+}
+
+// flatten composites an image over an opaque color, for formats without
+// transparency
+func flatten(img *image.RGBA, bg color.RGBA) *image.RGBA {
+	out := image.NewRGBA(img.Bounds())
+	for i := 0; i < len(img.Pix); i += 4 {
+		a := uint32(img.Pix[i+3])
+		out.Pix[i] = uint8(uint32(img.Pix[i]) + uint32(bg.R)*(0xff-a)/0xff)
+		out.Pix[i+1] = uint8(uint32(img.Pix[i+1]) + uint32(bg.G)*(0xff-a)/0xff)
+		out.Pix[i+2] = uint8(uint32(img.Pix[i+2]) + uint32(bg.B)*(0xff-a)/0xff)
+		out.Pix[i+3] = 0xff
+	}
+	return out
+}
@@ -0,0 +1,146 @@
+package qr
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/makiuchi-d/gozxing"
+	zxingqr "github.com/makiuchi-d/gozxing/qrcode"
+	"github.com/skip2/go-qrcode"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testLogo is a dark logo with a transparent corner, the worst case for a
+// logo drawn over modules
+func testLogo(width, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.RGBA{R: 0xc0, G: 0x10, B: uint8(x * 0xff / width), A: 0xff}
+			if x < width/4 && y < height/4 {
+				c = color.RGBA{}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// decode reads the QR code in a PNG
+func decode(t *testing.T, data []byte) string {
+	t.Helper()
+	img, err := png.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	bitmap, err := gozxing.NewBinaryBitmapFromImage(img)
+	require.NoError(t, err)
+	result, err := zxingqr.NewQRCodeReader().Decode(bitmap, map[gozxing.DecodeHintType]interface{}{gozxing.DecodeHintType_PURE_BARCODE: true})
+	require.NoError(t, err)
+	return result.GetText()
+}
+
+func TestPNGWithLogoDecodes(t *testing.T) {
+	contents := []string{
+		"https://sho.rt/abc123",
+		"https://links.example.com/spring-sale-2024",
+		"https://sho.rt/" + strings.Repeat("x", 120),
+	}
+	logos := map[string]image.Image{"square": testLogo(200, 200), "wide": testLogo(400, 100), "tiny": testLogo(10, 30)}
+	decoded := 0
+	for _, content := range contents {
+		for name, logo := range logos {
+			for _, size := range []float64{0.1, DefaultLogoSize, 0.25} {
+				opts := DefaultOptions()
+				opts.Size = 512
+				opts.Logo = logo
+				opts.LogoSize = size
+				data, err := PNG(content, opts)
+				if err == ErrLogoTooLarge {
+					// Small logos fit every code
+					require.Greater(t, size, 0.1, content)
+					continue
+				}
+				require.NoError(t, err, "%s logo at %g", name, size)
+				assert.Equal(t, content, decode(t, data), "%s logo at %g", name, size)
+				decoded++
+			}
+		}
+	}
+	// Only larger logos in the smallest code are rejected
+	assert.Greater(t, decoded, len(contents)*len(logos)*2)
+}
+
+func TestPNGWithLogoDrawsLogo(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Logo = testLogo(100, 100)
+	opts.Size = 400
+	data, err := PNG("https://links.example.com/spring-sale-2024", opts)
+	require.NoError(t, err)
+	img, err := png.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+
+	// The middle of the image is the logo's color
+	r, g, _, _ := img.At(200, 200).RGBA()
+	assert.Equal(t, uint32(0xc0), r>>8)
+	assert.Equal(t, uint32(0x10), g>>8)
+}
+
+func TestLogoUsesHighestLevel(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Level = qrcode.Low
+	opts.Logo = testLogo(10, 10)
+	c, err := encode("https://links.example.com/spring-sale-2024", opts)
+	require.NoError(t, err)
+	highest, err := Matrix("https://links.example.com/spring-sale-2024", qrcode.Highest)
+	require.NoError(t, err)
+	assert.Len(t, c.modules, len(highest))
+	require.NotNil(t, c.logo)
+}
+
+func TestLogoArea(t *testing.T) {
+	// A version 1 code has no room outside its finder patterns
+	_, _, err := logoArea(21, DefaultLogoSize)
+	assert.ErrorIs(t, err, ErrLogoTooLarge)
+
+	start, side, err := logoArea(33, 0.2)
+	require.NoError(t, err)
+	assert.Equal(t, 33, 2*start+side)
+	assert.LessOrEqual(t, float64(side*side), MaxLogoArea*33*33)
+
+	// Larger logos exceed the area limit
+	_, _, err = logoArea(57, MaxLogoSize)
+	assert.ErrorIs(t, err, ErrLogoTooLarge)
+}
+
+func TestVectorWithLogo(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Logo = testLogo(600, 300)
+	content := "https://links.example.com/spring-sale-2024"
+
+	svg, err := SVG(content, opts)
+	require.NoError(t, err)
+	assert.Contains(t, string(svg), `href="data:image/png;base64,`)
+
+	pdf, err := PDF(content, opts)
+	require.NoError(t, err)
+	assert.Contains(t, string(pdf), "/XObject << /Logo 5 0 R >>")
+	assert.Contains(t, string(pdf), "/Width 512 /Height 256")
+	assert.Contains(t, string(pdf), "xref\n0 6\n")
+
+	eps, err := EPS(content, opts)
+	require.NoError(t, err)
+	assert.Contains(t, string(eps), "512 256 8 [512 0 0 -256 0 256]")
+	assert.Contains(t, string(eps), "false 3 colorimage\n")
+}
+
+func TestFlatten(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.SetRGBA(0, 0, color.RGBA{R: 0x80, A: 0x80})
+	out := flatten(img, color.RGBA{B: 0xff, A: 0xff})
+	assert.Equal(t, color.RGBA{R: 0x80, B: 0x7f, A: 0xff}, out.RGBAAt(0, 0))
+	assert.Equal(t, color.RGBA{B: 0xff, A: 0xff}, out.RGBAAt(1, 0))
+}
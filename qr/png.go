@@ -0,0 +1,99 @@
+package qr
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+)
+
+// layout places the modules of a code in a square image of size pixels.
+// Modules are whole pixels wide so edges stay sharp; what is left over is
+// split evenly around the quiet zone.
+type layout struct {
+	*code
+	// scale is the width of a module in pixels
+	scale int
+	// offset is the position of the first module, quiet zone included
+	offset int
+	size   int
+}
+
+func newLayout(c *code, size int) (layout, error) {
+	total := c.total()
+	scale := size / total
+	if scale < 1 {
+		return layout{}, fmt.Errorf("size must be at least %d pixels for this code", total)
+	}
+	return layout{code: c, scale: scale, offset: (size - scale*total) / 2, size: size}, nil
+}
+
+// Image renders content as a QR code image
+func Image(content string, opts Options) (image.Image, error) {
+	c, err := encode(content, opts)
+	if err != nil {
+		return nil, err
+	}
+	l, err := newLayout(c, opts.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	// A two-color palette keeps the PNG small; logos need full color
+	var img draw.Image
+	var set func(x, y int)
+	if c.logo == nil {
+		p := image.NewPaletted(image.Rect(0, 0, l.size, l.size), color.Palette{opts.Background, opts.Foreground})
+		img, set = p, func(x, y int) { p.Pix[y*p.Stride+x] = 1 }
+	} else {
+		rgba := image.NewRGBA(image.Rect(0, 0, l.size, l.size))
+		draw.Draw(rgba, rgba.Bounds(), image.NewUniform(opts.Background), image.Point{}, draw.Src)
+		img, set = rgba, func(x, y int) { rgba.SetRGBA(x, y, opts.Foreground) }
+	}
+
+	start := l.offset + l.margin*l.scale
+	for y, row := range l.modules {
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+			px, py := start+x*l.scale, start+y*l.scale
+			for dy := 0; dy < l.scale; dy++ {
+				for dx := 0; dx < l.scale; dx++ {
+					set(px+dx, py+dy)
+				}
+			}
+		}
+	}
+
+	if c.logo != nil {
+		scale := float64(l.scale)
+		rect := image.Rect(
+			l.offset+int(math.Round(c.logo.x*scale)),
+			l.offset+int(math.Round(c.logo.y*scale)),
+			l.offset+int(math.Round((c.logo.x+c.logo.width)*scale)),
+			l.offset+int(math.Round((c.logo.y+c.logo.height)*scale)),
+		)
+		if rect.Dx() > 0 && rect.Dy() > 0 {
+			draw.Draw(img, rect, scaleImage(opts.Logo, rect.Dx(), rect.Dy()), image.Point{}, draw.Over)
+		}
+	}
+	return img, nil
+}
+
+// PNG renders content as a QR code PNG image
+func PNG(content string, opts Options) ([]byte, error) {
+	img, err := Image(content, opts)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := encoder.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,167 @@
+// Package qr renders QR codes for short links with configurable size,
+// error correction, colors and quiet zone
+package qr
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	// DefaultSize is the default image size in pixels per side
+	DefaultSize = 256
+	// MinSize is the smallest image size that can be requested
+	MinSize = 64
+	// DefaultMargin is the quiet zone the QR specification requires, in
+	// modules
+	DefaultMargin = 4
+	// MaxMargin bounds the quiet zone, in modules
+	MaxMargin = 20
+)
+
+// Format is an output format for QR codes
+type Format string
+
+const (
+	FormatPNG Format = "png"
+	// FormatSVG, FormatPDF and FormatEPS are vector formats, which stay
+	// sharp at any print size
+	FormatSVG Format = "svg"
+	FormatPDF Format = "pdf"
+	FormatEPS Format = "eps"
+)
+
+// ParseFormat reads an output format name
+func ParseFormat(value string) (Format, error) {
+	switch format := Format(strings.ToLower(value)); format {
+	case FormatPNG, FormatSVG, FormatPDF, FormatEPS:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown format %q (expected png, svg, pdf or eps)", value)
+}
+
+// ContentType is the media type of the format
+func (f Format) ContentType() string {
+	switch f {
+	case FormatSVG:
+		return "image/svg+xml"
+	case FormatPDF:
+		return "application/pdf"
+	case FormatEPS:
+		return "application/postscript"
+	}
+	return "image/png"
+}
+
+// Render renders content as a QR code in the format
+func Render(content string, format Format, opts Options) ([]byte, error) {
+	switch format {
+	case FormatSVG:
+		return SVG(content, opts)
+	case FormatPDF:
+		return PDF(content, opts)
+	case FormatEPS:
+		return EPS(content, opts)
+	}
+	return PNG(content, opts)
+}
+
+// Options controls how a QR code is rendered
+type Options struct {
+	// Size is the width and height of the image in pixels
+	Size int
+	// Level is the error correction level; higher levels survive more
+	// damage at the cost of denser codes
+	Level      qrcode.RecoveryLevel
+	Foreground color.RGBA
+	Background color.RGBA
+	// Margin is the quiet zone around the code, in modules
+	Margin int
+	// Logo is drawn in the middle of the code when set
+	Logo image.Image
+	// LogoSize is the logo's width as a share of the code's width
+	LogoSize float64
+}
+
+// DefaultOptions returns black-on-white options at the default size,
+// medium error correction and the standard quiet zone
+func DefaultOptions() Options {
+	return Options{
+		Size:       DefaultSize,
+		Level:      qrcode.Medium,
+		Foreground: color.RGBA{A: 0xff},
+		Background: color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff},
+		Margin:     DefaultMargin,
+		LogoSize:   DefaultLogoSize,
+	}
+}
+
+// Validate checks the options against the largest allowed image size
+func (o Options) Validate(maxSize int) error {
+	if o.Size < MinSize || o.Size > maxSize {
+		return fmt.Errorf("size must be between %d and %d", MinSize, maxSize)
+	}
+	if o.Margin < 0 || o.Margin > MaxMargin {
+		return fmt.Errorf("margin must be between 0 and %d", MaxMargin)
+	}
+	if o.Foreground == o.Background {
+		return errors.New("foreground and background colors must differ")
+	}
+	if o.LogoSize <= 0 || o.LogoSize > MaxLogoSize {
+		return fmt.Errorf("logo size must be greater than 0 and at most %g", MaxLogoSize)
+	}
+	return nil
+}
+
+// ParseLevel reads an error correction level: L, M, Q or H, or its name
+// (low, medium, quartile, high)
+func ParseLevel(value string) (qrcode.RecoveryLevel, error) {
+	switch strings.ToLower(value) {
+	case "l", "low":
+		return qrcode.Low, nil
+	case "m", "medium":
+		return qrcode.Medium, nil
+	case "q", "quartile":
+		return qrcode.High, nil
+	case "h", "high", "highest":
+		return qrcode.Highest, nil
+	}
+	return 0, fmt.Errorf("unknown error correction level %q (expected L, M, Q or H)", value)
+}
+
+// ParseColor reads a hex color: RGB, RRGGBB or RRGGBBAA, with or without a
+// leading #
+func ParseColor(value string) (color.RGBA, error) {
+	hex := strings.TrimPrefix(value, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	if len(hex) != 8 {
+		return color.RGBA{}, fmt.Errorf("invalid color %q (expected hex RGB, RRGGBB or RRGGBBAA)", value)
+	}
+	n, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid color %q (expected hex RGB, RRGGBB or RRGGBBAA)", value)
+	}
+	return color.RGBA{R: uint8(n >> 24), G: uint8(n >> 16), B: uint8(n >> 8), A: uint8(n)}, nil
+}
+
+// Matrix encodes content as a QR code and returns its modules, true being
+// dark, without a quiet zone
+func Matrix(content string, level qrcode.RecoveryLevel) ([][]bool, error) {
+	code, err := qrcode.New(content, level)
+	if err != nil {
+		return nil, err
+	}
+	code.DisableBorder = true
+	return code.Bitmap(), nil
+}
@@ -0,0 +1,96 @@
+package qr
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/skip2/go-qrcode"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLevel(t *testing.T) {
+	for value, want := range map[string]qrcode.RecoveryLevel{"L": qrcode.Low, "m": qrcode.Medium, "Q": qrcode.High, "high": qrcode.Highest} {
+		got, err := ParseLevel(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, want, got, value)
+	}
+	_, err := ParseLevel("x")
+	assert.Error(t, err)
+}
+
+func TestParseColor(t *testing.T) {
+	tests := map[string]color.RGBA{
+		"#000":      {A: 0xff},
+		"ff8800":    {R: 0xff, G: 0x88, A: 0xff},
+		"#0A0B0C80": {R: 0x0a, G: 0x0b, B: 0x0c, A: 0x80},
+	}
+	for value, want := range tests {
+		got, err := ParseColor(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, want, got, value)
+	}
+	for _, value := range []string{"", "#12", "red", "#gggggg"} {
+		_, err := ParseColor(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	opts := DefaultOptions()
+	assert.NoError(t, opts.Validate(1024))
+
+	opts.Size = 2048
+	assert.ErrorContains(t, opts.Validate(1024), "size must be between")
+
+	opts = DefaultOptions()
+	opts.Margin = -1
+	assert.ErrorContains(t, opts.Validate(1024), "margin")
+
+	opts = DefaultOptions()
+	opts.Foreground = opts.Background
+	assert.ErrorContains(t, opts.Validate(1024), "must differ")
+}
+
+func TestPNG(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Size = 300
+	opts.Margin = 2
+	opts.Foreground = color.RGBA{B: 0xff, A: 0xff}
+
+	data, err := PNG("https://sho.rt/abc123", opts)
+	require.NoError(t, err)
+	img, err := png.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, 300, img.Bounds().Dx())
+	assert.Equal(t, 300, img.Bounds().Dy())
+
+	// Every module is drawn in its color at the computed position
+	modules, err := Matrix("https://sho.rt/abc123", opts.Level)
+	require.NoError(t, err)
+	l, err := newLayout(&code{modules: modules, margin: opts.Margin}, opts.Size)
+	require.NoError(t, err)
+	start := l.offset + l.margin*l.scale
+	for y, row := range modules {
+		for x, dark := range row {
+			want := opts.Background
+			if dark {
+				want = opts.Foreground
+			}
+			got := color.RGBAModel.Convert(img.At(start+x*l.scale+l.scale/2, start+y*l.scale+l.scale/2))
+			require.Equal(t, want, got, "module %d,%d", x, y)
+		}
+	}
+	// The quiet zone is background
+	assert.Equal(t, opts.Background, color.RGBAModel.Convert(img.At(start-1, start-1)))
+}
+
+func TestPNGTooSmall(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Size = MinSize
+	opts.Level = qrcode.Highest
+	_, err := PNG("https://sho.rt/"+string(bytes.Repeat([]byte("a"), 200)), opts)
+	assert.ErrorContains(t, err, "size must be at least")
+}
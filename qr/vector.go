@@ -0,0 +1,217 @@
+package qr
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"fmt"
+	"image/color"
+	"image/png"
+	"strings"
+)
+
+// run is a horizontal run of dark modules, in module coordinates with the
+// quiet zone included
+type run struct {
+	x, y, width int
+}
+
+// darkRuns merges the dark modules of each row into runs, which keeps
+// vector output compact
+func darkRuns(modules [][]bool, margin int) []run {
+	var runs []run
+	for y, row := range modules {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			start := x
+			for x < len(row) && row[x] {
+				x++
+			}
+			runs = append(runs, run{x: start + margin, y: y + margin, width: x - start})
+		}
+	}
+	return runs
+}
+
+// vectorMatrix encodes content for vector output, returning the code and
+// its dark runs. Vector output scales freely, so unlike raster output any
+// size can hold any code.
+func vectorMatrix(content string, opts Options) (*code, []run, error) {
+	c, err := encode(content, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, darkRuns(c.modules, c.margin), nil
+}
+
+// SVG renders content as a QR code SVG image of opts.Size pixels
+func SVG(content string, opts Options) ([]byte, error) {
+	c, runs, err := vectorMatrix(content, opts)
+	if err != nil {
+		return nil, err
+	}
+	total := c.total()
+
+	var path strings.Builder
+	for _, r := range runs {
+		fmt.Fprintf(&path, "M%d %dh%dv1h-%dz", r.x, r.y, r.width, r.width)
+	}
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+"\n",
+		opts.Size, opts.Size, total, total)
+	if opts.Background.A > 0 {
+		fmt.Fprintf(&buf, `<rect width="%d" height="%d" %s/>`+"\n", total, total, svgFill(opts.Background))
+	}
+	fmt.Fprintf(&buf, `<path d="%s" %s/>`+"\n", path.String(), svgFill(opts.Foreground))
+	if c.logo != nil {
+		var logo bytes.Buffer
+		if err := png.Encode(&logo, logoRaster(opts.Logo)); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&buf, `<image x="%.4f" y="%.4f" width="%.4f" height="%.4f" preserveAspectRatio="none" href="data:image/png;base64,%s"/>`+"\n",
+			c.logo.x, c.logo.y, c.logo.width, c.logo.height, base64.StdEncoding.EncodeToString(logo.Bytes()))
+	}
+	buf.WriteString("</svg>\n")
+	return buf.Bytes(), nil
+}
+
+func svgFill(c color.RGBA) string {
+	fill := fmt.Sprintf(`fill="#%02x%02x%02x"`, c.R, c.G, c.B)
+	if c.A < 0xff {
+		fill += fmt.Sprintf(` fill-opacity="%.3f"`, float64(c.A)/0xff)
+	}
+	return fill
+}
+
+// PDF renders content as a one-page PDF whose page is the QR code,
+// opts.Size points (1/72 inch) per side. Colors are opaque; a fully
+// transparent background is left unpainted.
+func PDF(content string, opts Options) ([]byte, error) {
+	c, runs, err := vectorMatrix(content, opts)
+	if err != nil {
+		return nil, err
+	}
+	total := c.total()
+
+	// PDF coordinates start at the bottom left, so rows are flipped
+	var stream bytes.Buffer
+	scale := float64(opts.Size) / float64(total)
+	fmt.Fprintf(&stream, "%.6f 0 0 %.6f 0 0 cm\n", scale, scale)
+	if opts.Background.A > 0 {
+		fmt.Fprintf(&stream, "%s rg\n0 0 %d %d re f\n", pdfColor(opts.Background), total, total)
+	}
+	fmt.Fprintf(&stream, "%s rg\n", pdfColor(opts.Foreground))
+	for _, r := range runs {
+		fmt.Fprintf(&stream, "%d %d %d 1 re\n", r.x, total-r.y-1, r.width)
+	}
+	stream.WriteString("f\n")
+
+	resources := "<< >>"
+	var logoObject string
+	if c.logo != nil {
+		// The logo is an RGB image drawn over the code's background
+		logo := flatten(logoRaster(opts.Logo), opaque(opts.Background))
+		var pixels bytes.Buffer
+		zw := zlib.NewWriter(&pixels)
+		for i := 0; i < len(logo.Pix); i += 4 {
+			zw.Write(logo.Pix[i : i+3])
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		size := logo.Bounds().Size()
+		fmt.Fprintf(&stream, "q %.4f 0 0 %.4f %.4f %.4f cm /Logo Do Q\n",
+			c.logo.width, c.logo.height, c.logo.x, float64(total)-c.logo.y-c.logo.height)
+		resources = "<< /XObject << /Logo 5 0 R >> >>"
+		logoObject = fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode /Length %d >>\nstream\n%s\nendstream",
+			size.X, size.Y, pixels.Len(), pixels.String())
+	}
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Contents 4 0 R /Resources %s >>", opts.Size, opts.Size, resources),
+		fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", stream.Len(), stream.String()),
+	}
+	if logoObject != "" {
+		objects = append(objects, logoObject)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes(), nil
+}
+
+// opaque returns the color without transparency; a fully transparent
+// color becomes white, the color of paper
+func opaque(c color.RGBA) color.RGBA {
+	if c.A == 0 {
+		return color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	}
+	c.A = 0xff
+	return c
+}
+
+func pdfColor(c color.RGBA) string {
+	return fmt.Sprintf("%.3f %.3f %.3f", float64(c.R)/0xff, float64(c.G)/0xff, float64(c.B)/0xff)
+}
+
+// EPS renders content as an Encapsulated PostScript QR code of opts.Size
+// points per side. Like PDF output, colors are opaque.
+func EPS(content string, opts Options) ([]byte, error) {
+	c, runs, err := vectorMatrix(content, opts)
+	if err != nil {
+		return nil, err
+	}
+	total := c.total()
+
+	var buf bytes.Buffer
+	buf.WriteString("%!PS-Adobe-3.0 EPSF-3.0\n")
+	fmt.Fprintf(&buf, "%%%%BoundingBox: 0 0 %d %d\n", opts.Size, opts.Size)
+	buf.WriteString("%%Creator: url-shortener\n%%Pages: 0\n%%EndComments\n")
+	buf.WriteString("gsave\n")
+	scale := float64(opts.Size) / float64(total)
+	fmt.Fprintf(&buf, "%.6f %.6f scale\n", scale, scale)
+	if opts.Background.A > 0 {
+		fmt.Fprintf(&buf, "%s setrgbcolor\n0 0 %d %d rectfill\n", pdfColor(opts.Background), total, total)
+	}
+	fmt.Fprintf(&buf, "%s setrgbcolor\n", pdfColor(opts.Foreground))
+	for _, r := range runs {
+		fmt.Fprintf(&buf, "%d %d %d 1 rectfill\n", r.x, total-r.y-1, r.width)
+	}
+	if c.logo != nil {
+		logo := flatten(logoRaster(opts.Logo), opaque(opts.Background))
+		size := logo.Bounds().Size()
+		fmt.Fprintf(&buf, "gsave\n%.4f %.4f translate\n%.4f %.4f scale\n",
+			c.logo.x, float64(total)-c.logo.y-c.logo.height, c.logo.width, c.logo.height)
+		fmt.Fprintf(&buf, "/row %d string def\n%d %d 8 [%d 0 0 -%d 0 %d]\n{currentfile row readhexstring pop} false 3 colorimage\n",
+			size.X*3, size.X, size.Y, size.X, size.Y, size.Y)
+		hexRow := make([]byte, 0, size.X*6)
+		for y := 0; y < size.Y; y++ {
+			hexRow = hexRow[:0]
+			for x := 0; x < size.X; x++ {
+				i := logo.PixOffset(x, y)
+				hexRow = fmt.Appendf(hexRow, "%02x%02x%02x", logo.Pix[i], logo.Pix[i+1], logo.Pix[i+2])
+			}
+			buf.Write(hexRow)
+			buf.WriteByte('\n')
+		}
+		buf.WriteString("grestore\n")
+	}
+	buf.WriteString("grestore\n%%EOF\n")
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,123 @@
+package qr
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image/color"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDarkRuns(t *testing.T) {
+	modules := [][]bool{
+		{true, true, false, true},
+		{false, false, false, false},
+		{false, true, true, true},
+	}
+	assert.Equal(t, []run{{x: 1, y: 1, width: 2}, {x: 4, y: 1, width: 1}, {x: 2, y: 3, width: 3}}, darkRuns(modules, 1))
+}
+
+func TestSVG(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Background = color.RGBA{}
+	opts.Foreground = color.RGBA{R: 0x12, G: 0x34, B: 0x56, A: 0xff}
+	data, err := SVG("https://sho.rt/abc123", opts)
+	require.NoError(t, err)
+
+	var doc struct {
+		Width   int        `xml:"width,attr"`
+		ViewBox string     `xml:"viewBox,attr"`
+		Rects   []struct{} `xml:"rect"`
+		Path    struct {
+			D    string `xml:"d,attr"`
+			Fill string `xml:"fill,attr"`
+		} `xml:"path"`
+	}
+	require.NoError(t, xml.Unmarshal(data, &doc))
+	assert.Equal(t, DefaultSize, doc.Width)
+	assert.Equal(t, "#123456", doc.Path.Fill)
+	// A transparent background is not drawn
+	assert.Empty(t, doc.Rects)
+
+	// Redrawing the path gives back the code
+	modules, err := Matrix("https://sho.rt/abc123", opts.Level)
+	require.NoError(t, err)
+	total := len(modules) + 2*opts.Margin
+	assert.Equal(t, fmt.Sprintf("0 0 %d %d", total, total), doc.ViewBox)
+	drawn := make([][]bool, len(modules))
+	for i := range drawn {
+		drawn[i] = make([]bool, len(modules))
+	}
+	moves := regexp.MustCompile(`M(\d+) (\d+)h(\d+)v1h-\d+z`).FindAllStringSubmatch(doc.Path.D, -1)
+	for _, m := range moves {
+		x, _ := strconv.Atoi(m[1])
+		y, _ := strconv.Atoi(m[2])
+		width, _ := strconv.Atoi(m[3])
+		for i := 0; i < width; i++ {
+			drawn[y-opts.Margin][x-opts.Margin+i] = true
+		}
+	}
+	assert.Equal(t, modules, drawn)
+}
+
+func TestPDF(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Size = 144
+	data, err := PDF("https://sho.rt/abc123", opts)
+	require.NoError(t, err)
+
+	assert.True(t, bytes.HasPrefix(data, []byte("%PDF-1.4\n")))
+	assert.True(t, bytes.HasSuffix(data, []byte("%%EOF\n")))
+	assert.Contains(t, string(data), "/MediaBox [0 0 144 144]")
+
+	// The cross-reference table points at each object
+	xref := regexp.MustCompile(`startxref\n(\d+)`).FindSubmatch(data)
+	require.NotNil(t, xref)
+	offset, _ := strconv.Atoi(string(xref[1]))
+	require.True(t, bytes.HasPrefix(data[offset:], []byte("xref\n0 5\n")))
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(data[offset:], -1)
+	require.Len(t, entries, 4)
+	for i, entry := range entries {
+		objOffset, _ := strconv.Atoi(string(entry[1]))
+		assert.True(t, bytes.HasPrefix(data[objOffset:], []byte(fmt.Sprintf("%d 0 obj\n", i+1))), "object %d", i+1)
+	}
+
+	// The stream length matches its content
+	stream := regexp.MustCompile(`(?s)<< /Length (\d+) >>\nstream\n(.*)endstream`).FindSubmatch(data)
+	require.NotNil(t, stream)
+	length, _ := strconv.Atoi(string(stream[1]))
+	assert.Equal(t, length, len(stream[2]))
+}
+
+func TestEPS(t *testing.T) {
+	opts := DefaultOptions()
+	data, err := EPS("https://sho.rt/abc123", opts)
+	require.NoError(t, err)
+	eps := string(data)
+	assert.True(t, strings.HasPrefix(eps, "%!PS-Adobe-3.0 EPSF-3.0\n"))
+	assert.Contains(t, eps, "%%BoundingBox: 0 0 256 256\n")
+	assert.Contains(t, eps, "0.000 0.000 0.000 setrgbcolor\n")
+
+	_, runs, err := vectorMatrix("https://sho.rt/abc123", opts)
+	require.NoError(t, err)
+	assert.Equal(t, len(runs)+1, strings.Count(eps, "rectfill"))
+}
+
+func TestRender(t *testing.T) {
+	for _, name := range []string{"png", "SVG", "pdf", "eps"} {
+		format, err := ParseFormat(name)
+		require.NoError(t, err)
+		data, err := Render("https://sho.rt/abc", format, DefaultOptions())
+		require.NoError(t, err)
+		assert.NotEmpty(t, data)
+	}
+	_, err := ParseFormat("gif")
+	assert.Error(t, err)
+	assert.Equal(t, "image/svg+xml", FormatSVG.ContentType())
+}
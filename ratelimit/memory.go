@@ -0,0 +1,109 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps token buckets in process memory. Limits are per
+// replica, so it suits single-instance deployments and tests.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+	stop    chan struct{}
+	once    sync.Once
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	// fullAt is when the bucket will have refilled completely, after which
+	// it carries no state and can be dropped
+	fullAt time.Time
+}
+
+// NewMemoryStore creates an in-memory store that drops idle buckets every
+// cleanupInterval. Call Close to stop the cleanup goroutine.
+func NewMemoryStore(cleanupInterval time.Duration) *MemoryStore {
+	s := &MemoryStore{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+		stop:    make(chan struct{}),
+	}
+
+	go func() {
+		ticker := time.NewTicker(cleanupInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				s.Cleanup()
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+
+	return s
+}
+
+// Take consumes cost tokens from the bucket for key
+func (s *MemoryStore) Take(_ context.Context, key string, limit Limit, cost int) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	capacity := float64(limit.Capacity())
+	rate := limit.ratePerSecond()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, last: now}
+		s.buckets[key] = b
+	}
+
+	// Refill for the time elapsed since the last request
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(capacity, b.tokens+elapsed*rate)
+		b.last = now
+	}
+
+	allowed := b.tokens >= float64(cost)
+	if allowed {
+		b.tokens -= float64(cost)
+	}
+
+	result := newResult(limit, allowed, b.tokens, cost)
+	b.fullAt = now.Add(result.ResetAfter)
+	return result, nil
+}
+
+// Cleanup removes buckets that have refilled completely
+func (s *MemoryStore) Cleanup() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for key, b := range s.buckets {
+		if !now.Before(b.fullAt) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// Len returns the number of buckets currently tracked
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.buckets)
+}
+
+// Close stops the background cleanup
+func (s *MemoryStore) Close() {
+	s.once.Do(func() { close(s.stop) })
+}
@@ -0,0 +1,117 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"url-shortener/config"
+)
+
+// Limit describes a token bucket holding up to Burst tokens that refills at
+// Requests tokens per Window. A request consumes one token, or one per item
+// for requests doing the work of several.
+type Limit struct {
+	Requests int
+	Window   time.Duration
+	Burst    int
+}
+
+// Capacity returns the bucket size, which defaults to Requests
+func (l Limit) Capacity() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Requests
+}
+
+// ratePerSecond returns how many tokens are added to the bucket per second
+func (l Limit) ratePerSecond() float64 {
+	return float64(l.Requests) / l.Window.Seconds()
+}
+
+// Policy is a named limit applied to requests grouped by identity
+type Policy struct {
+	Name  string
+	Limit Limit
+	// IdentifyBy lists identity kinds in order of preference: the first
+	// one present on a request ("user", "api_key" or "ip") is used as the
+	// bucket key
+	IdentifyBy []string
+}
+
+// NewPolicy builds a named policy from its configuration
+func NewPolicy(name string, cfg config.RateLimitPolicyConfig) Policy {
+	return Policy{
+		Name: name,
+		Limit: Limit{
+			Requests: cfg.Requests,
+			Window:   cfg.Window,
+			Burst:    cfg.Burst,
+		},
+		IdentifyBy: cfg.IdentifyBy,
+	}
+}
+
+// Result is the outcome of taking a token from a bucket
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// ResetAfter is how long until the bucket is full again
+	ResetAfter time.Duration
+	// RetryAfter is how long until enough tokens are available; zero if
+	// allowed
+	RetryAfter time.Duration
+}
+
+// Store keeps token bucket state. Implementations must be safe for
+// concurrent use and apply each Take atomically: cost tokens are taken
+// together or not at all.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit, cost int) (Result, error)
+}
+
+// NewStore creates the backend selected in cfg
+func NewStore(cfg config.RateLimitConfig) (Store, error) {
+	switch strings.ToLower(cfg.Backend) {
+	case "", "memory":
+		return NewMemoryStore(time.Minute), nil
+	case "redis":
+		opts, err := redis.ParseURL(cfg.RedisURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate limit Redis URL: %v", err)
+		}
+		return NewRedisStore(redis.NewClient(opts)), nil
+	default:
+		return nil, fmt.Errorf("unsupported rate limit backend: %s", cfg.Backend)
+	}
+}
+
+// newResult builds a Result from the number of tokens left after a take
+// of cost tokens
+func newResult(limit Limit, allowed bool, tokens float64, cost int) Result {
+	rate := limit.ratePerSecond()
+	capacity := float64(limit.Capacity())
+
+	result := Result{
+		Allowed:    allowed,
+		Limit:      limit.Capacity(),
+		Remaining:  int(math.Floor(tokens)),
+		ResetAfter: secondsToDuration((capacity - tokens) / rate),
+	}
+	if !allowed {
+		result.RetryAfter = secondsToDuration((float64(cost) - tokens) / rate)
+	}
+	return result
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	if seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
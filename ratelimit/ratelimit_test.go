@@ -0,0 +1,123 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testLimit = Limit{Requests: 2, Window: time.Second, Burst: 3}
+
+// exerciseBucket checks token bucket behaviour shared by every store.
+// advance moves the store's clock forward.
+func exerciseBucket(t *testing.T, store Store, advance func(time.Duration)) {
+	ctx := context.Background()
+
+	// A fresh bucket allows a burst up to its capacity
+	for i := 2; i >= 0; i-- {
+		result, err := store.Take(ctx, "client", testLimit, 1)
+		require.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 3, result.Limit)
+		assert.Equal(t, i, result.Remaining)
+	}
+
+	result, err := store.Take(ctx, "client", testLimit, 1)
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+	assert.InDelta(t, 500*time.Millisecond, result.RetryAfter, float64(10*time.Millisecond))
+	assert.InDelta(t, 1500*time.Millisecond, result.ResetAfter, float64(10*time.Millisecond))
+
+	// Other keys have their own bucket
+	result, err = store.Take(ctx, "other", testLimit, 1)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	// Tokens refill at Requests per Window
+	advance(500 * time.Millisecond)
+	result, err = store.Take(ctx, "client", testLimit, 1)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+
+	// ...but never beyond capacity
+	advance(time.Hour)
+	result, err = store.Take(ctx, "client", testLimit, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Remaining)
+
+	// Costlier takes need all their tokens at once and take none otherwise
+	result, err = store.Take(ctx, "client", testLimit, 3)
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 2, result.Remaining)
+	assert.InDelta(t, 500*time.Millisecond, result.RetryAfter, float64(10*time.Millisecond))
+
+	result, err = store.Take(ctx, "client", testLimit, 2)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore(time.Hour)
+	defer store.Close()
+
+	now := time.Unix(1700000000, 0)
+	store.now = func() time.Time { return now }
+
+	exerciseBucket(t, store, func(d time.Duration) { now = now.Add(d) })
+}
+
+func TestMemoryStoreCleanupDropsFullBuckets(t *testing.T) {
+	store := NewMemoryStore(time.Hour)
+	defer store.Close()
+
+	now := time.Unix(1700000000, 0)
+	store.now = func() time.Time { return now }
+
+	_, err := store.Take(context.Background(), "client", testLimit, 1)
+	require.NoError(t, err)
+
+	store.Cleanup()
+	assert.Equal(t, 1, store.Len())
+
+	now = now.Add(time.Second)
+	store.Cleanup()
+	assert.Equal(t, 0, store.Len())
+}
+
+func TestRedisStore(t *testing.T) {
+	server := miniredis.RunT(t)
+	now := time.Unix(1700000000, 0)
+	server.SetTime(now)
+
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	exerciseBucket(t, NewRedisStore(client), func(d time.Duration) {
+		now = now.Add(d)
+		server.SetTime(now)
+	})
+
+	// Buckets expire once they would be full again
+	assert.True(t, server.Exists("client"))
+	server.FastForward(3 * time.Second)
+	assert.False(t, server.Exists("client"))
+}
+
+func TestRedisStoreReportsErrors(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+	server.Close()
+
+	_, err := NewRedisStore(client).Take(context.Background(), "client", testLimit, 1)
+	assert.Error(t, err)
+}
@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// takeScript atomically refills and takes from a token bucket stored as a
+// hash. It uses the Redis server clock so replicas agree on elapsed time,
+// and expires the key once the bucket would be full again.
+//
+// KEYS[1] bucket key
+// ARGV[1] capacity
+// ARGV[2] refill rate in tokens per second
+// ARGV[3] tokens to take
+var takeScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2]) / 1000000
+local cost = tonumber(ARGV[3])
+
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = capacity
+	ts = now
+end
+
+if now > ts then
+	tokens = math.min(capacity, tokens + (now - ts) * rate)
+	ts = now
+end
+
+local allowed = 0
+if tokens >= cost then
+	tokens = tokens - cost
+	allowed = 1
+end
+
+-- Format explicitly: Lua's default number formatting loses precision on
+-- microsecond timestamps
+local tokensStr = string.format('%.6f', tokens)
+redis.call('HSET', KEYS[1], 'tokens', tokensStr, 'ts', string.format('%.0f', ts))
+redis.call('PEXPIRE', KEYS[1], math.ceil((capacity - tokens) / rate / 1000) + 1000)
+
+return {allowed, tokensStr}
+`)
+
+// RedisStore keeps token buckets in Redis (or any server speaking the
+// Redis protocol with Lua scripting), so limits hold across replicas
+type RedisStore struct {
+	client redis.Scripter
+}
+
+// NewRedisStore creates a store backed by client
+func NewRedisStore(client redis.Scripter) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+// Take consumes cost tokens from the bucket for key
+func (s *RedisStore) Take(ctx context.Context, key string, limit Limit, cost int) (Result, error) {
+	reply, err := takeScript.Run(ctx, s.client, []string{key},
+		limit.Capacity(),
+		strconv.FormatFloat(limit.ratePerSecond(), 'f', -1, 64),
+		cost,
+	).Slice()
+	if err != nil {
+		return Result{}, fmt.Errorf("rate limit script failed: %v", err)
+	}
+	if len(reply) != 2 {
+		return Result{}, fmt.Errorf("unexpected rate limit script reply: %v", reply)
+	}
+
+	allowed, _ := reply[0].(int64)
+	tokensStr, _ := reply[1].(string)
+	tokens, err := strconv.ParseFloat(tokensStr, 64)
+	if err != nil {
+		return Result{}, fmt.Errorf("invalid token count %q: %v", tokensStr, err)
+	}
+
+	return newResult(limit, allowed == 1, tokens, cost), nil
+}
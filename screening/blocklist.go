@@ -0,0 +1,231 @@
+package screening
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ThreatBlocklisted is the threat reported for local blocklist matches
+const ThreatBlocklisted = "BLOCKLISTED"
+
+// Blocklist matches URLs against local lists of domains and URL hash
+// prefixes. Lists are read from files and can be reloaded at runtime; a
+// failed reload keeps the previous lists.
+//
+// Hosts files use the /etc/hosts layout ("0.0.0.0 evil.example") or list
+// one bare domain per line. A listed domain also blocks its subdomains.
+//
+// Hash-prefix files list one hex-encoded SHA-256 prefix (4 to 32 bytes) per
+// line, computed over Safe-Browsing-style URL expressions such as
+// "evil.example/phish/login.html" (see HashPrefix).
+type Blocklist struct {
+	hostsFiles      []string
+	hashPrefixFiles []string
+
+	mu           sync.RWMutex
+	domains      map[string]string
+	hashPrefixes map[string]string
+	prefixLens   []int
+}
+
+// LoadBlocklist reads the given hosts and hash-prefix files
+func LoadBlocklist(hostsFiles, hashPrefixFiles []string) (*Blocklist, error) {
+	b := &Blocklist{hostsFiles: hostsFiles, hashPrefixFiles: hashPrefixFiles}
+	if err := b.Reload(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Reload re-reads every list file and atomically swaps in the new entries
+func (b *Blocklist) Reload() error {
+	domains := make(map[string]string)
+	for _, path := range b.hostsFiles {
+		if err := readListFile(path, func(line string) error {
+			return parseHostsLine(line, filepath.Base(path), domains)
+		}); err != nil {
+			return err
+		}
+	}
+
+	hashPrefixes := make(map[string]string)
+	lens := make(map[int]bool)
+	for _, path := range b.hashPrefixFiles {
+		if err := readListFile(path, func(line string) error {
+			prefix, err := parseHashPrefix(line)
+			if err != nil {
+				return err
+			}
+			hashPrefixes[prefix] = filepath.Base(path)
+			lens[len(prefix)] = true
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	var prefixLens []int
+	for n := range lens {
+		prefixLens = append(prefixLens, n)
+	}
+
+	b.mu.Lock()
+	b.domains = domains
+	b.hashPrefixes = hashPrefixes
+	b.prefixLens = prefixLens
+	b.mu.Unlock()
+	return nil
+}
+
+// Len returns the number of listed domains and hash prefixes
+func (b *Blocklist) Len() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.domains) + len(b.hashPrefixes)
+}
+
+// Match reports whether rawURL is blocklisted. Unparseable URLs never match.
+func (b *Blocklist) Match(rawURL string) (Verdict, bool) {
+	host, path, query, err := canonicalize(rawURL)
+	if err != nil {
+		return Verdict{}, false
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, suffix := range hostSuffixes(host) {
+		if source, ok := b.domains[suffix]; ok {
+			return Verdict{Threat: ThreatBlocklisted, Source: source}, true
+		}
+	}
+
+	if len(b.hashPrefixes) == 0 {
+		return Verdict{}, false
+	}
+	for _, expr := range urlExpressions(host, path, query) {
+		sum := sha256.Sum256([]byte(expr))
+		full := hex.EncodeToString(sum[:])
+		for _, n := range b.prefixLens {
+			if source, ok := b.hashPrefixes[full[:n]]; ok {
+				return Verdict{Threat: ThreatBlocklisted, Source: source}, true
+			}
+		}
+	}
+	return Verdict{}, false
+}
+
+// HashPrefix returns the hex-encoded SHA-256 prefix of length bytes for a
+// URL expression, as written to hash-prefix files
+func HashPrefix(expr string, length int) string {
+	sum := sha256.Sum256([]byte(expr))
+	return hex.EncodeToString(sum[:length])
+}
+
+// readListFile calls fn for every non-empty, non-comment line of path
+func readListFile(path string, fn func(line string) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open blocklist: %v", err)
+	}
+	defer f.Close()
+	return readList(f, path, fn)
+}
+
+func readList(r io.Reader, name string, fn func(line string) error) error {
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if err := fn(line); err != nil {
+			return fmt.Errorf("%s:%d: %v", name, lineNo, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read blocklist %s: %v", name, err)
+	}
+	return nil
+}
+
+// parseHostsLine adds the domains of a hosts-file line to domains. Loopback
+// names that hosts files commonly include are ignored.
+func parseHostsLine(line, source string, domains map[string]string) error {
+	fields := strings.Fields(line)
+	if len(fields) > 1 {
+		// "<address> <name> [<name>...]"
+		fields = fields[1:]
+	}
+	for _, name := range fields {
+		name = strings.TrimSuffix(strings.ToLower(name), ".")
+		switch name {
+		case "localhost", "localhost.localdomain", "local", "broadcasthost", "ip6-localhost", "ip6-loopback", "0.0.0.0":
+			continue
+		}
+		if strings.ContainsAny(name, "/:") {
+			return fmt.Errorf("invalid domain %q", name)
+		}
+		domains[name] = source
+	}
+	return nil
+}
+
+// parseHashPrefix validates a hex-encoded hash prefix
+func parseHashPrefix(line string) (string, error) {
+	prefix := strings.ToLower(line)
+	raw, err := hex.DecodeString(prefix)
+	if err != nil || len(raw) < 4 || len(raw) > sha256.Size {
+		return "", fmt.Errorf("invalid hash prefix %q", line)
+	}
+	return prefix, nil
+}
+
+// urlExpressions returns the host suffix and path prefix combinations
+// checked against hash prefixes, following the Safe Browsing scheme: up to
+// five hosts (the exact host and the last four parents) and up to six paths
+// (the exact path with and without query, and up to four leading path
+// segments starting at "/")
+func urlExpressions(host, path, query string) []string {
+	hosts := hostSuffixes(host)
+	if len(hosts) > 5 {
+		hosts = append([]string{hosts[0]}, hosts[len(hosts)-4:]...)
+	}
+
+	var paths []string
+	if query != "" {
+		paths = append(paths, path+"?"+query)
+	}
+	paths = append(paths, path)
+	prefix := "/"
+	if path != prefix {
+		paths = append(paths, prefix)
+	}
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i := 0; i < len(segments)-1 && i < 3; i++ {
+		prefix += segments[i] + "/"
+		if prefix != path {
+			paths = append(paths, prefix)
+		}
+	}
+
+	exprs := make([]string, 0, len(hosts)*len(paths))
+	for _, h := range hosts {
+		for _, p := range paths {
+			exprs = append(exprs, h+p)
+		}
+	}
+	return exprs
+}
@@ -0,0 +1,215 @@
+package screening
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+
+	"url-shortener/config"
+)
+
+// Destination error codes returned to API clients
+const (
+	CodeInvalidDestination      = "invalid_destination"
+	CodePrivateDestination      = "private_destination"
+	CodeSelfReferential         = "self_referential_destination"
+	CodeShortenerDestination    = "shortener_destination"
+	CodeUnresolvableDestination = "unresolvable_destination"
+)
+
+// DestinationError explains why a destination URL was rejected
+type DestinationError struct {
+	Code    string
+	Message string
+}
+
+func (e *DestinationError) Error() string {
+	return e.Message
+}
+
+// Resolver looks up the addresses of a host. *net.Resolver satisfies it.
+type Resolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+// DestinationPolicy rejects destinations that point into private networks,
+// back at this service, or at other URL shorteners. Checks happen when a
+// link is created; a host may later resolve elsewhere, so consumers that
+// fetch links must still guard their own requests.
+type DestinationPolicy struct {
+	resolver       Resolver
+	resolveTimeout time.Duration
+	resolve        bool
+	allowPrivate   bool
+	selfHosts      []string
+	blockedDomains []string
+}
+
+// nonPublicPrefixes are special-purpose ranges not covered by the netip
+// predicates used in isPrivateAddr
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("100::/64"),
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+// NewDestinationPolicy builds a policy from its configuration. The host of
+// appURL, when set, is treated as this service's own host.
+func NewDestinationPolicy(cfg config.DestinationConfig, appURL string) *DestinationPolicy {
+	p := &DestinationPolicy{
+		resolver:       net.DefaultResolver,
+		resolveTimeout: cfg.ResolveTimeout,
+		resolve:        cfg.ResolveHosts,
+		allowPrivate:   cfg.AllowPrivateNetworks,
+	}
+	if u, err := url.Parse(appURL); err == nil && u.Hostname() != "" {
+		p.selfHosts = append(p.selfHosts, normalizeHost(u.Hostname()))
+	}
+	for _, domain := range cfg.BlockedDomains {
+		if domain = normalizeHost(domain); domain != "" {
+			p.blockedDomains = append(p.blockedDomains, domain)
+		}
+	}
+	return p
+}
+
+// WithResolver returns a copy of the policy that resolves hosts with r
+func (p *DestinationPolicy) WithResolver(r Resolver) *DestinationPolicy {
+	copied := *p
+	copied.resolver = r
+	return &copied
+}
+
+// Validate checks rawURL and returns a *DestinationError if it is not
+// allowed. requestHosts are additional names this service is reached by,
+// such as the Host of the current request.
+func (p *DestinationPolicy) Validate(ctx context.Context, rawURL string, requestHosts ...string) error {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return &DestinationError{Code: CodeInvalidDestination, Message: "URL must be an absolute http:// or https:// URL"}
+	}
+	if u.User != nil {
+		return &DestinationError{Code: CodeInvalidDestination, Message: "URL must not contain credentials"}
+	}
+	host := normalizeHost(u.Hostname())
+
+	for _, self := range p.selfHosts {
+		if host == self {
+			return &DestinationError{Code: CodeSelfReferential, Message: "URL cannot point to this service"}
+		}
+	}
+	for _, requestHost := range requestHosts {
+		if h, _, err := net.SplitHostPort(requestHost); err == nil {
+			requestHost = h
+		}
+		if requestHost != "" && host == normalizeHost(requestHost) {
+			return &DestinationError{Code: CodeSelfReferential, Message: "URL cannot point to this service"}
+		}
+	}
+	for _, domain := range p.blockedDomains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return &DestinationError{Code: CodeShortenerDestination, Message: "URL cannot point to another URL shortener"}
+		}
+	}
+
+	if p.allowPrivate {
+		return nil
+	}
+
+	if addr, err := netip.ParseAddr(strings.Trim(host, "[]")); err == nil {
+		if isPrivateAddr(addr) {
+			return privateDestinationError()
+		}
+		return nil
+	}
+	if isNumericHost(host) {
+		// Shorthand or hex IPv4 forms such as 0x7f.1 are resolved
+		// inconsistently by clients, so they are never accepted
+		return &DestinationError{Code: CodeInvalidDestination, Message: "URL host must be a domain name or a standard IP address"}
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return privateDestinationError()
+	}
+
+	if !p.resolve {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.resolveTimeout)
+	defer cancel()
+	addrs, err := p.resolver.LookupNetIP(ctx, "ip", host)
+	if err != nil || len(addrs) == 0 {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && (dnsErr.IsTimeout || dnsErr.IsTemporary) {
+			return &DestinationError{Code: CodeUnresolvableDestination, Message: fmt.Sprintf("could not resolve host %s, please try again", host)}
+		}
+		return &DestinationError{Code: CodeUnresolvableDestination, Message: fmt.Sprintf("host %s does not resolve", host)}
+	}
+	for _, addr := range addrs {
+		if isPrivateAddr(addr) {
+			return privateDestinationError()
+		}
+	}
+	return nil
+}
+
+func privateDestinationError() *DestinationError {
+	return &DestinationError{Code: CodePrivateDestination, Message: "URL cannot point to a private, loopback or link-local address"}
+}
+
+// isPrivateAddr reports whether addr is not a publicly routable unicast
+// address
+func isPrivateAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() {
+		return true
+	}
+	if addr == netip.AddrFrom4([4]byte{255, 255, 255, 255}) {
+		return true
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// isNumericHost reports whether every label of host is a decimal, octal or
+// hex number, i.e. the host could be read as a non-standard IPv4 address
+func isNumericHost(host string) bool {
+	for _, label := range strings.Split(host, ".") {
+		digits := strings.TrimPrefix(label, "0x")
+		if digits == "" {
+			return false
+		}
+		hex := digits != label
+		for _, r := range digits {
+			isDigit := r >= '0' && r <= '9'
+			isHex := isDigit || (r >= 'a' && r <= 'f')
+			if !isDigit && !(hex && isHex) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// normalizeHost lowercases host and strips a trailing dot
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
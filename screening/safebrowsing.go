@@ -0,0 +1,122 @@
+package screening
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DefaultSafeBrowsingURL is the Google Safe Browsing v4 Lookup API endpoint
+const DefaultSafeBrowsingURL = "https://safebrowsing.googleapis.com/v4/threatMatches:find"
+
+// safeBrowsingBatchSize is the maximum number of URLs per lookup request
+const safeBrowsingBatchSize = 500
+
+// SafeBrowsingLookup queries a Safe Browsing v4 compatible Lookup API
+type SafeBrowsingLookup struct {
+	endpoint string
+	apiKey   string
+	client   *http.Client
+}
+
+// NewSafeBrowsingLookup creates a lookup client. An empty endpoint uses
+// DefaultSafeBrowsingURL.
+func NewSafeBrowsingLookup(endpoint, apiKey string, timeout time.Duration) *SafeBrowsingLookup {
+	if endpoint == "" {
+		endpoint = DefaultSafeBrowsingURL
+	}
+	return &SafeBrowsingLookup{
+		endpoint: endpoint,
+		apiKey:   apiKey,
+		client:   &http.Client{Timeout: timeout},
+	}
+}
+
+type safeBrowsingEntry struct {
+	URL string `json:"url"`
+}
+
+type safeBrowsingRequest struct {
+	Client struct {
+		ClientID      string `json:"clientId"`
+		ClientVersion string `json:"clientVersion"`
+	} `json:"client"`
+	ThreatInfo struct {
+		ThreatTypes      []string            `json:"threatTypes"`
+		PlatformTypes    []string            `json:"platformTypes"`
+		ThreatEntryTypes []string            `json:"threatEntryTypes"`
+		ThreatEntries    []safeBrowsingEntry `json:"threatEntries"`
+	} `json:"threatInfo"`
+}
+
+type safeBrowsingResponse struct {
+	Matches []struct {
+		ThreatType string            `json:"threatType"`
+		Threat     safeBrowsingEntry `json:"threat"`
+	} `json:"matches"`
+}
+
+// Lookup checks urls in batches and returns verdicts for matches
+func (l *SafeBrowsingLookup) Lookup(ctx context.Context, urls []string) (map[string]Verdict, error) {
+	verdicts := make(map[string]Verdict)
+	for start := 0; start < len(urls); start += safeBrowsingBatchSize {
+		end := start + safeBrowsingBatchSize
+		if end > len(urls) {
+			end = len(urls)
+		}
+		if err := l.lookupBatch(ctx, urls[start:end], verdicts); err != nil {
+			return verdicts, err
+		}
+	}
+	return verdicts, nil
+}
+
+func (l *SafeBrowsingLookup) lookupBatch(ctx context.Context, urls []string, verdicts map[string]Verdict) error {
+	var body safeBrowsingRequest
+	body.Client.ClientID = "url-shortener"
+	body.Client.ClientVersion = "1.0.0"
+	body.ThreatInfo.ThreatTypes = []string{"MALWARE", "SOCIAL_ENGINEERING", "UNWANTED_SOFTWARE", "POTENTIALLY_HARMFUL_APPLICATION"}
+	body.ThreatInfo.PlatformTypes = []string{"ANY_PLATFORM"}
+	body.ThreatInfo.ThreatEntryTypes = []string{"URL"}
+	for _, u := range urls {
+		body.ThreatInfo.ThreatEntries = append(body.ThreatInfo.ThreatEntries, safeBrowsingEntry{URL: u})
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	endpoint := l.endpoint
+	if l.apiKey != "" {
+		endpoint += "?key=" + url.QueryEscape(l.apiKey)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("safe browsing lookup returned %s", resp.Status)
+	}
+
+	var result safeBrowsingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("invalid safe browsing response: %v", err)
+	}
+	for _, match := range result.Matches {
+		verdicts[match.Threat.URL] = Verdict{Threat: match.ThreatType, Source: "safe_browsing"}
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package screening
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// Verdict describes why a URL was flagged
+type Verdict struct {
+	// Threat is the kind of threat, e.g. BLOCKLISTED or SOCIAL_ENGINEERING
+	Threat string `json:"threat"`
+	// Source names the list or service that flagged the URL
+	Source string `json:"source"`
+}
+
+// Reason returns a short human readable description of the verdict
+func (v Verdict) Reason() string {
+	return fmt.Sprintf("%s (%s)", v.Threat, v.Source)
+}
+
+// Lookup is a Safe-Browsing-style reputation service. It returns a verdict
+// for each of the given URLs that is known to be unsafe; URLs missing from
+// the result are considered safe.
+type Lookup interface {
+	Lookup(ctx context.Context, urls []string) (map[string]Verdict, error)
+}
+
+// Screener checks destination URLs against local blocklists and an
+// optional remote lookup service
+type Screener struct {
+	blocklist *Blocklist
+	lookup    Lookup
+}
+
+// New creates a screener. Either argument may be nil.
+func New(blocklist *Blocklist, lookup Lookup) *Screener {
+	return &Screener{blocklist: blocklist, lookup: lookup}
+}
+
+// Blocklist returns the screener's local blocklist, which may be nil
+func (s *Screener) Blocklist() *Blocklist {
+	return s.blocklist
+}
+
+// Check screens a single URL. flagged is false when the URL is not known to
+// be unsafe.
+func (s *Screener) Check(ctx context.Context, rawURL string) (verdict Verdict, flagged bool, err error) {
+	verdicts, err := s.CheckAll(ctx, []string{rawURL})
+	verdict, flagged = verdicts[rawURL]
+	return verdict, flagged, err
+}
+
+// CheckAll screens urls and returns verdicts for those that are flagged.
+// Local blocklists are consulted first; only URLs they pass are sent to the
+// lookup service. When the lookup fails, the blocklist verdicts are still
+// returned along with the error.
+func (s *Screener) CheckAll(ctx context.Context, urls []string) (map[string]Verdict, error) {
+	verdicts := make(map[string]Verdict)
+	var remaining []string
+	for _, rawURL := range urls {
+		if s.blocklist != nil {
+			if verdict, ok := s.blocklist.Match(rawURL); ok {
+				verdicts[rawURL] = verdict
+				continue
+			}
+		}
+		remaining = append(remaining, rawURL)
+	}
+
+	if s.lookup == nil || len(remaining) == 0 {
+		return verdicts, nil
+	}
+	found, err := s.lookup.Lookup(ctx, remaining)
+	for rawURL, verdict := range found {
+		verdicts[rawURL] = verdict
+	}
+	if err != nil {
+		return verdicts, fmt.Errorf("URL lookup failed: %v", err)
+	}
+	return verdicts, nil
+}
+
+// errInvalidURL is returned when a URL cannot be canonicalized
+var errInvalidURL = errors.New("invalid URL")
+
+// canonicalize splits rawURL into a lowercase host without port or trailing
+// dot and a path (with query, without fragment) that always starts with "/"
+func canonicalize(rawURL string) (host, path, query string, err error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Host == "" {
+		return "", "", "", errInvalidURL
+	}
+	host = strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return "", "", "", errInvalidURL
+	}
+	path = u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	return host, path, u.RawQuery, nil
+}
+
+// hostSuffixes returns host followed by its parent domains, stopping before
+// the top-level domain. IP addresses have no parents.
+func hostSuffixes(host string) []string {
+	if net.ParseIP(host) != nil {
+		return []string{host}
+	}
+	suffixes := []string{host}
+	for {
+		i := strings.IndexByte(host, '.')
+		if i < 0 {
+			break
+		}
+		host = host[i+1:]
+		if !strings.Contains(host, ".") {
+			break
+		}
+		suffixes = append(suffixes, host)
+	}
+	return suffixes
+}
@@ -0,0 +1,167 @@
+package screening
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeList(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestBlocklistHostsFile(t *testing.T) {
+	hosts := writeList(t, "hosts.txt", `
+# Malware domains
+127.0.0.1 localhost
+0.0.0.0 evil.example phish.test # trailing comment
+bad.example
+`)
+	b, err := LoadBlocklist([]string{hosts}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, b.Len())
+
+	verdict, ok := b.Match("https://login.evil.example/account?id=1")
+	assert.True(t, ok, "subdomains of listed domains are blocked")
+	assert.Equal(t, Verdict{Threat: ThreatBlocklisted, Source: "hosts.txt"}, verdict)
+
+	_, ok = b.Match("http://BAD.example.:8080/")
+	assert.True(t, ok, "host matching ignores case, port and trailing dot")
+
+	_, ok = b.Match("https://notevil.example/")
+	assert.False(t, ok)
+	_, ok = b.Match("http://localhost/")
+	assert.False(t, ok, "loopback names from hosts files are not blocked")
+}
+
+func TestBlocklistHashPrefixes(t *testing.T) {
+	prefixes := writeList(t, "prefixes.txt", HashPrefix("shady.example/phish/", 4)+"\n"+HashPrefix("other.example/exact.html?x=1", 32)+"\n")
+	b, err := LoadBlocklist(nil, []string{prefixes})
+	require.NoError(t, err)
+
+	_, ok := b.Match("https://www.shady.example/phish/login.html")
+	assert.True(t, ok, "path prefix expression matches")
+	_, ok = b.Match("https://shady.example/safe/page")
+	assert.False(t, ok)
+	_, ok = b.Match("http://other.example/exact.html?x=1#frag")
+	assert.True(t, ok, "full URL expression matches without the fragment")
+	_, ok = b.Match("http://other.example/exact.html?x=2")
+	assert.False(t, ok)
+}
+
+func TestBlocklistReload(t *testing.T) {
+	hosts := writeList(t, "hosts.txt", "evil.example\n")
+	b, err := LoadBlocklist([]string{hosts}, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(hosts, []byte("worse.example\n"), 0o600))
+	require.NoError(t, b.Reload())
+	_, ok := b.Match("https://evil.example/")
+	assert.False(t, ok)
+	_, ok = b.Match("https://worse.example/")
+	assert.True(t, ok)
+
+	// A broken list keeps the previous entries
+	require.NoError(t, os.WriteFile(hosts, []byte("http://not-a-domain/\n"), 0o600))
+	assert.Error(t, b.Reload())
+	_, ok = b.Match("https://worse.example/")
+	assert.True(t, ok)
+}
+
+func TestLoadBlocklistRejectsInvalidPrefix(t *testing.T) {
+	prefixes := writeList(t, "prefixes.txt", "abc\n")
+	_, err := LoadBlocklist(nil, []string{prefixes})
+	assert.ErrorContains(t, err, "invalid hash prefix")
+}
+
+// stubLookup is a Lookup with a fixed set of unsafe URLs
+type stubLookup struct {
+	unsafe map[string]string
+	err    error
+	calls  [][]string
+}
+
+func (s *stubLookup) Lookup(_ context.Context, urls []string) (map[string]Verdict, error) {
+	s.calls = append(s.calls, urls)
+	verdicts := make(map[string]Verdict)
+	for _, u := range urls {
+		if threat, ok := s.unsafe[u]; ok {
+			verdicts[u] = Verdict{Threat: threat, Source: "stub"}
+		}
+	}
+	return verdicts, s.err
+}
+
+func TestScreenerConsultsBlocklistBeforeLookup(t *testing.T) {
+	hosts := writeList(t, "hosts.txt", "evil.example\n")
+	b, err := LoadBlocklist([]string{hosts}, nil)
+	require.NoError(t, err)
+	lookup := &stubLookup{unsafe: map[string]string{"https://phish.example/": "SOCIAL_ENGINEERING"}}
+	s := New(b, lookup)
+
+	verdicts, err := s.CheckAll(context.Background(), []string{
+		"https://evil.example/",
+		"https://phish.example/",
+		"https://fine.example/",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Verdict{
+		"https://evil.example/":  {Threat: ThreatBlocklisted, Source: "hosts.txt"},
+		"https://phish.example/": {Threat: "SOCIAL_ENGINEERING", Source: "stub"},
+	}, verdicts)
+	assert.Equal(t, [][]string{{"https://phish.example/", "https://fine.example/"}}, lookup.calls)
+
+	_, flagged, err := s.Check(context.Background(), "https://fine.example/")
+	require.NoError(t, err)
+	assert.False(t, flagged)
+}
+
+func TestScreenerReturnsBlocklistVerdictsWhenLookupFails(t *testing.T) {
+	hosts := writeList(t, "hosts.txt", "evil.example\n")
+	b, err := LoadBlocklist([]string{hosts}, nil)
+	require.NoError(t, err)
+	s := New(b, &stubLookup{err: errors.New("unavailable")})
+
+	verdicts, err := s.CheckAll(context.Background(), []string{"https://evil.example/", "https://fine.example/"})
+	assert.Error(t, err)
+	assert.Contains(t, verdicts, "https://evil.example/")
+}
+
+func TestSafeBrowsingLookup(t *testing.T) {
+	var received safeBrowsingRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secret", r.URL.Query().Get("key"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"matches":[{"threatType":"MALWARE","threat":{"url":"https://bad.example/"}}]}`))
+	}))
+	defer server.Close()
+
+	lookup := NewSafeBrowsingLookup(server.URL, "secret", time.Second)
+	verdicts, err := lookup.Lookup(context.Background(), []string{"https://bad.example/", "https://good.example/"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Verdict{"https://bad.example/": {Threat: "MALWARE", Source: "safe_browsing"}}, verdicts)
+	assert.Len(t, received.ThreatInfo.ThreatEntries, 2)
+}
+
+func TestSafeBrowsingLookupError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	_, err := NewSafeBrowsingLookup(server.URL, "", time.Second).Lookup(context.Background(), []string{"https://a.example/"})
+	assert.ErrorContains(t, err, "403")
+}
@@ -0,0 +1,88 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+// ShutdownFunc flushes pending spans and stops the exporter
+type ShutdownFunc func(context.Context) error
+
+// InitTracing configures the global tracer provider and W3C propagators.
+//
+// The exporter is selected with OTEL_TRACES_EXPORTER ("otlp", "stdout" or
+// "none"). When it is unset, OTLP is used if an OTLP endpoint is configured
+// and tracing is otherwise disabled. The OTLP exporter honours the standard
+// OTEL_EXPORTER_OTLP_* variables, and sampling follows OTEL_TRACES_SAMPLER.
+func InitTracing(ctx context.Context) (ShutdownFunc, error) {
+	// Always propagate traceparent/baggage, even if we don't export spans
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch exporterName() {
+	case "otlp":
+		exporter, err = otlptracehttp.New(ctx)
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case "none", "":
+		slog.Info("Tracing exporter disabled")
+		return func(context.Context) error { return nil }, nil
+	default:
+		return nil, fmt.Errorf("unsupported OTEL_TRACES_EXPORTER: %s", exporterName())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace exporter: %v", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(serviceName()),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build trace resource: %v", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	slog.Info("Tracing enabled", "exporter", exporterName())
+	return provider.Shutdown, nil
+}
+
+// exporterName resolves which span exporter should be used
+func exporterName() string {
+	if name := os.Getenv("OTEL_TRACES_EXPORTER"); name != "" {
+		return strings.ToLower(name)
+	}
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "" {
+		return "otlp"
+	}
+	return "none"
+}
+
+// serviceName returns the service name reported on every span
+func serviceName() string {
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		return name
+	}
+	return "url-shortener"
+}
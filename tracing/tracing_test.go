@@ -0,0 +1,55 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+)
+
+// TestInitTracingExportsToCollector points the OTLP exporter at a local
+// stand-in collector and checks that spans are delivered on shutdown
+func TestInitTracingExportsToCollector(t *testing.T) {
+	var received int32
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/traces" {
+			atomic.AddInt32(&received, 1)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer collector.Close()
+
+	t.Setenv("OTEL_TRACES_EXPORTER", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", collector.URL)
+
+	shutdown, err := InitTracing(context.Background())
+	require.NoError(t, err)
+
+	_, span := otel.Tracer("test").Start(context.Background(), "test-span")
+	span.End()
+
+	require.NoError(t, shutdown(context.Background()))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&received))
+}
+
+func TestInitTracingDisabledByDefault(t *testing.T) {
+	t.Setenv("OTEL_TRACES_EXPORTER", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+
+	shutdown, err := InitTracing(context.Background())
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+}
+
+func TestInitTracingRejectsUnknownExporter(t *testing.T) {
+	t.Setenv("OTEL_TRACES_EXPORTER", "zipkin")
+
+	_, err := InitTracing(context.Background())
+	assert.Error(t, err)
+}